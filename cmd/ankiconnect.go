@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/anki"
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
+	"github.com/fbngrm/zh-audio/pkg/input"
+	"golang.org/x/exp/slog"
+)
+
+// runAnkiConnect attaches synthesized audio to the notes of a running anki through the
+// AnkiConnect add-on.
+func runAnkiConnect(args []string) {
+	fs := flag.NewFlagSet("ankiconnect", flag.ExitOnError)
+	url := fs.String("url", envOr("ANKICONNECT_URL", anki.DefaultConnectURL), "url of the AnkiConnect api")
+	deck := fs.String("deck", "", "deck of the notes")
+	query := fs.String("query", "", "anki search of the notes, e.g. \"deck:zh tag:hsk3\", combined with -deck")
+	kind := fs.String("kind", "words", "kind of the notes: words or clozes")
+	fields := fs.String("fields", "", "note fields by key, e.g. chinese=Hanzi,english=Meaning,audio=Sound; keys: chinese, english, word, meaning, note, audio")
+	dryRun := fs.Bool("dry-run", false, "show the changes without synthesizing or updating notes")
+	cedict := fs.String("cedict", os.Getenv("CEDICT_PATH"), "CC-CEDICT file to fill in missing definitions and tones")
+	senses := fs.Int("senses", dict.DefaultSenses, "senses of a word's meaning read aloud")
+	fs.Parse(args)
+
+	search := *query
+	if *deck != "" {
+		search = strings.TrimSpace(fmt.Sprintf("%q %s", "deck:"+*deck, search))
+	}
+	if search == "" {
+		log.Fatal("need notes to update, specified with -deck or -query")
+	}
+	mapping, err := input.ParseAnkiFields(*kind, *fields)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sync := &input.AnkiSync{
+		Connect: anki.NewConnect(*url, os.Getenv("ANKICONNECT_KEY")),
+		Kind:    *kind,
+		Fields:  mapping,
+		DryRun:  *dryRun,
+	}
+	if !*dryRun {
+		azureClient, err := newAzureClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		d := loadDict(*cedict)
+		sync.Words = &input.WordProcessor{AzureDownloader: azureClient, Dict: d, Senses: *senses}
+		sync.Clozes = &input.ClozeProcessor{AzureDownloader: azureClient, Dict: d, Senses: *senses}
+	}
+
+	changes, err := sync.Sync(context.Background(), search)
+	for _, c := range changes {
+		if *dryRun {
+			fmt.Printf("would set %s of note %d (%s) to %s\n", c.Field, c.NoteID, c.Item, c.Value)
+		} else {
+			slog.Info("updated note", "note", c.NoteID, "item", c.Item, "field", c.Field, "value", c.Value)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("attached audio to notes", "count", len(changes), "dry-run", *dryRun)
+}
+
+// newAzureClient configures the azure client from the environment, clips are
+// synthesized by the team cache server if one is configured.
+func newAzureClient() (*audio.AzureClient, error) {
+	teamCache := cacheServer()
+	azureApiKey := os.Getenv("SPEECH_KEY")
+	azureEndpoint := os.Getenv("AZURE_ENDPOINT")
+	if teamCache == nil && (azureApiKey == "" || azureEndpoint == "") {
+		return nil, fmt.Errorf("environment variables SPEECH_KEY and AZURE_ENDPOINT are not set")
+	}
+	azureClient, err := audio.NewAzureClient(azureApiKey, azureEndpoint, out)
+	if err != nil {
+		return nil, err
+	}
+	azureClient.Remote = teamCache
+	azureClient.Lexicon = loadLexicon(os.Getenv("LEXICON_PATH"))
+	azureClient.LexiconURI = os.Getenv("LEXICON_URI")
+	return azureClient, nil
+}
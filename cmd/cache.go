@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/input"
+	"golang.org/x/exp/slog"
+)
+
+const cacheUsage = `usage: zh-audio cache <command> [flags]
+
+commands:
+  stats          report entries, size, voices, providers and hit rate
+  gc             evict entries by lru or age until the cache fits the size cap
+  prune-orphans  delete entries no manifest references
+  serve          expose the cache over http to other machines`
+
+// runCache implements the cache subcommand group.
+func runCache(args []string) {
+	if len(args) == 0 {
+		log.Fatal(cacheUsage)
+	}
+	audioCacheDir := os.Getenv("AUDIO_CACHE_DIR")
+	if audioCacheDir == "" {
+		log.Fatal("Environment variable AUDIO_CACHE_DIR is not set")
+	}
+	cache := &audio.Cache{
+		AudioCacheDir: audioCacheDir,
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	var pins string
+	fs.StringVar(&pins, "pin", "", "comma separated texts to keep in addition to the narration")
+	dryRun := fs.Bool("dry-run", false, "only print what would be deleted")
+
+	switch args[0] {
+	case "stats":
+		runs := fs.Int("runs", 10, "number of recent runs to compute the hit rate from")
+		fs.Parse(args[1:])
+		stats, err := cache.Stats(*runs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("entries:  %d\n", stats.Entries)
+		fmt.Printf("size:     %s\n", formatSize(stats.Size))
+		fmt.Printf("hit rate: %.1f%% (%d hits, %d misses in %d runs)\n",
+			stats.HitRate()*100, stats.Hits, stats.Misses, stats.Runs)
+		printCounts("providers", stats.ByProvider)
+		printCounts("voices", stats.ByVoice)
+	case "gc":
+		policy := fs.String("policy", string(audio.EvictLRU), "eviction policy, lru or age")
+		maxSize := fs.String("max-size", "", "size cap of the cache, e.g. 500MB or 2GB")
+		maxAge := fs.Duration("max-age", 0, "evict entries older than this, e.g. 2160h")
+		fs.Parse(args[1:])
+		size, err := parseSize(*maxSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		evicted, err := cache.GC(audio.GCOptions{
+			Policy:  audio.EvictionPolicy(*policy),
+			MaxSize: size,
+			MaxAge:  *maxAge,
+			Pinned:  pinned(pins),
+			DryRun:  *dryRun,
+		})
+		printRemoved(evicted, *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "prune-orphans":
+		force := fs.Bool("force", false, "prune even if no manifest references any entry, which removes all unpinned entries")
+		fs.Parse(args[1:])
+		pruned, err := cache.PruneOrphans(audio.PruneOptions{
+			Pinned: pinned(pins),
+			DryRun: *dryRun,
+			Force:  *force,
+		})
+		printRemoved(pruned, *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "serve":
+		addr := fs.String("addr", "localhost:8089", "listen address")
+		tokens := fs.String("tokens", os.Getenv("AUDIO_CACHE_TOKENS"), "comma separated bearer tokens, required unless the server listens on localhost only")
+		fs.Parse(args[1:])
+		serveCache(cache, *addr, *tokens)
+	default:
+		log.Fatal(cacheUsage)
+	}
+}
+
+// serveCache runs the team cache server. With azure credentials set, it synthesizes
+// clips missing in the cache on behalf of its clients.
+func serveCache(cache *audio.Cache, addr, tokens string) {
+	var store audio.CacheStore = &audio.FileStore{Dir: cache.AudioCacheDir}
+	if remote := remoteStore(); remote != nil {
+		store = &audio.ReadThroughStore{Local: store.(*audio.FileStore), Remote: remote}
+	}
+	server := &audio.CacheServer{Store: store}
+	for _, t := range strings.Split(tokens, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			server.Tokens = append(server.Tokens, t)
+		}
+	}
+	if len(server.Tokens) == 0 {
+		if !isLoopback(addr) {
+			log.Fatalf("refusing to serve the cache on %s without auth tokens, set -tokens or listen on localhost", addr)
+		}
+		slog.Warn("cache server runs without auth tokens")
+	}
+
+	azureApiKey := os.Getenv("SPEECH_KEY")
+	azureEndpoint := os.Getenv("AZURE_ENDPOINT")
+	if azureApiKey != "" && azureEndpoint != "" {
+		tmp, err := os.MkdirTemp("", "zh-audio-serve")
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.Azure, err = audio.NewAzureClient(azureApiKey, azureEndpoint, tmp)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	slog.Info("serving audio cache", "addr", addr, "dir", cache.AudioCacheDir, "synthesize", server.Azure != nil)
+	log.Fatal(http.ListenAndServe(addr, server.Handler()))
+}
+
+// isLoopback reports whether a listen address binds to the loopback interface only.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func pinned(pins string) []string {
+	p := append([]string{}, input.Narration...)
+	for _, pin := range strings.Split(pins, ",") {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			p = append(p, pin)
+		}
+	}
+	return p
+}
+
+func printCounts(title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+	fmt.Printf("%s:\n", title)
+	for _, k := range keys {
+		fmt.Printf("  %-32s %d\n", k, counts[k])
+	}
+}
+
+func printRemoved(entries []*audio.CacheEntry, dryRun bool) {
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+		fmt.Println(e.Key)
+	}
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("%s %d entries, %s\n", verb, len(entries), formatSize(size))
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGT"[exp])
+}
+
+// parseSize parses sizes like 500MB or 2GB, plain numbers are bytes.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	for i, u := range "KMGT" {
+		if strings.HasSuffix(s, string(u)) {
+			mult = int64(1) << (10 * (i + 1))
+			s = strings.TrimSuffix(s, string(u))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %w", err)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// remoteStore configures the shared cache backend from the environment, nil if unset.
+func remoteStore() audio.CacheStore {
+	if store := cacheServer(); store != nil {
+		return store
+	}
+	endpoint := os.Getenv("AUDIO_CACHE_S3_ENDPOINT")
+	if endpoint == "" {
+		return nil
+	}
+	bucket := os.Getenv("AUDIO_CACHE_S3_BUCKET")
+	if bucket == "" {
+		log.Fatal("Environment variable AUDIO_CACHE_S3_BUCKET is not set")
+	}
+	return audio.NewS3Store(
+		endpoint,
+		bucket,
+		os.Getenv("AUDIO_CACHE_S3_REGION"),
+		os.Getenv("AUDIO_CACHE_S3_PREFIX"),
+		os.Getenv("AWS_ACCESS_KEY_ID"),
+		os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	)
+}
+
+// cacheServer configures the client of a team cache server from the environment, nil if unset.
+func cacheServer() *audio.HTTPStore {
+	url := os.Getenv("AUDIO_CACHE_URL")
+	if url == "" {
+		return nil
+	}
+	return audio.NewHTTPStore(url, os.Getenv("AUDIO_CACHE_TOKEN"))
+}
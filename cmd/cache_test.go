@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fbngrm/zh-audio/pkg/input"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+		ok   bool
+	}{
+		{"", 0, true},
+		{"512", 512, true},
+		{"100B", 100, true},
+		{"500MB", 500 << 20, true},
+		{"2GB", 2 << 30, true},
+		{"2gb", 2 << 30, true},
+		{" 1.5K ", 1536, true},
+		{"1T", 1 << 40, true},
+		{"MB", 0, false},
+		{"lots", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.size)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.size, got, err, tt.want)
+		}
+	}
+}
+
+func TestPinned(t *testing.T) {
+	want := append(append([]string{}, input.Narration...), "你好", "再见")
+	if got := pinned(" 你好, ,再见"); !reflect.DeepEqual(got, want) {
+		t.Errorf("pinned = %v, want %v", got, want)
+	}
+}
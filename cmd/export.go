@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/input"
+	"golang.org/x/exp/slog"
+)
+
+const sinkUsage = `sink to export to, repeatable:
+  dir:PATH[?dated]       local directory, dated keeps a directory per day
+  zip:PATH               zip bundle per export in a local directory
+  webdav:URL             webdav collection, auth from WEBDAV_USER and WEBDAV_PASSWORD
+  s3:BUCKET[/PREFIX]     s3 compatible bucket, endpoint from EXPORT_S3_ENDPOINT or AUDIO_CACHE_S3_ENDPOINT
+retention is appended as query, e.g. dir:/loops?dated&keep-days=30&keep-last=10`
+
+// sinkFlags collects the repeatable -sink flag.
+type sinkFlags []audio.SinkConfig
+
+func (s *sinkFlags) String() string {
+	var specs []string
+	for _, c := range *s {
+		specs = append(specs, c.Sink.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+func (s *sinkFlags) Set(spec string) error {
+	c, err := parseSink(spec)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, c)
+	return nil
+}
+
+// runExport delivers the files of a directory to all sinks, either all of them get the
+// export or none.
+func runExport(args []string) {
+	if len(args) > 0 && args[0] == "anki" {
+		runExportAnki(args[1:])
+		return
+	}
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	src := fs.String("src", "", "directory with the files to export")
+	label := fs.String("label", "", "label of the export, e.g. the mode, names zip bundles")
+	var sinks sinkFlags
+	fs.Var(&sinks, "sink", sinkUsage)
+	fs.Parse(args)
+
+	if *src == "" {
+		log.Fatal("need a directory to export, specified with -src path/to/dir")
+	}
+	if len(sinks) == 0 {
+		log.Fatal("need at least one sink, specified with -sink")
+	}
+	if *label == "" {
+		*label = filepath.Base(filepath.Clean(*src))
+	}
+	e, err := audio.NewExport(*src, *label)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter := &audio.Exporter{Sinks: sinks}
+	if err := exporter.Export(context.Background(), e); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseSink parses a sink spec of the form kind:target?options.
+func parseSink(spec string) (audio.SinkConfig, error) {
+	var c audio.SinkConfig
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return c, fmt.Errorf("invalid sink %q, expected kind:target", spec)
+	}
+	target, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return c, fmt.Errorf("invalid options of sink %q: %v", spec, err)
+	}
+	if c.Retention.KeepDays, err = intOption(query, "keep-days"); err != nil {
+		return c, err
+	}
+	if c.Retention.KeepLast, err = intOption(query, "keep-last"); err != nil {
+		return c, err
+	}
+	if target == "" {
+		return c, fmt.Errorf("sink %q has no target", spec)
+	}
+
+	switch kind {
+	case "dir":
+		c.Sink = &audio.DirSink{Dir: target, Dated: query.Has("dated")}
+	case "zip":
+		c.Sink = &audio.ZipSink{Dir: target}
+	case "webdav":
+		c.Sink = audio.NewWebDAVSink(target, os.Getenv("WEBDAV_USER"), os.Getenv("WEBDAV_PASSWORD"))
+	case "s3":
+		endpoint := envOr("EXPORT_S3_ENDPOINT", os.Getenv("AUDIO_CACHE_S3_ENDPOINT"))
+		if endpoint == "" {
+			return c, fmt.Errorf("sink %q needs EXPORT_S3_ENDPOINT or AUDIO_CACHE_S3_ENDPOINT", spec)
+		}
+		bucket, prefix, _ := strings.Cut(target, "/")
+		c.Sink = &audio.S3Sink{Store: audio.NewS3Store(
+			endpoint,
+			bucket,
+			envOr("EXPORT_S3_REGION", os.Getenv("AUDIO_CACHE_S3_REGION")),
+			prefix,
+			os.Getenv("AWS_ACCESS_KEY_ID"),
+			os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		)}
+	default:
+		return c, fmt.Errorf("unknown sink %q, expected dir, zip, webdav or s3", kind)
+	}
+	return c, nil
+}
+
+func intOption(query url.Values, key string) (int, error) {
+	v := query.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
+
+// runExportAnki writes the json items of a kind as anki deck with their clips attached.
+func runExportAnki(args []string) {
+	fs := flag.NewFlagSet("export anki", flag.ExitOnError)
+	src := fs.String("src", "", "directory with the json items")
+	kind := fs.String("kind", "words", "kind of the items: words, clozes or patterns")
+	output := fs.String("out", "", "path of the .apkg, <kind>.apkg in the output dir if empty")
+	deck := fs.String("deck", "", "name of the deck, zh-audio::<kind> if empty")
+	audioDirs := fs.String("audio", "", "comma separated directories with the clips, the output dirs of the kind if empty")
+	noteTypes := fs.String("note-types", "", "json file with note types by kind, overriding the defaults")
+	tags := fs.String("tags", "zh-audio", "comma separated tags of the notes")
+	fs.Parse(args)
+
+	if *src == "" {
+		log.Fatal("need a directory with items, specified with -src path/to/dir")
+	}
+	types, err := input.LoadAnkiNoteTypes(*noteTypes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	noteType, ok := types[*kind]
+	if !ok {
+		log.Fatalf("unknown kind %s, expected words, clozes or patterns", *kind)
+	}
+	exporter := &input.AnkiExporter{
+		Kind:     *kind,
+		NoteType: noteType,
+		Deck:     *deck,
+	}
+	if exporter.Deck == "" {
+		exporter.Deck = "zh-audio::" + *kind
+	}
+	if *audioDirs == "" {
+		// words and clozes are synthesized into the zh dir and finished into concat
+		*audioDirs = strings.Join([]string{filepath.Join(out, "concat"), filepath.Join(out, "zh")}, ",")
+		if *kind == "patterns" {
+			*audioDirs = filepath.Join(out, "patterns")
+		}
+	}
+	exporter.AudioDirs = splitList(*audioDirs)
+	exporter.Tags = splitList(*tags)
+	if *output == "" {
+		*output = filepath.Join(out, *kind+".apkg")
+	}
+
+	d, err := exporter.Build(*src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := d.WritePackage(*output); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("wrote anki deck", "path", *output, "notes", len(d.Notes), "media", len(d.Media))
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
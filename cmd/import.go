@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/fbngrm/zh-audio/pkg/input"
+	"golang.org/x/exp/slog"
+)
+
+// runImport converts a word list into the json input of the words mode.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	src := fs.String("src", "", "word list: csv, tsv, pleco flashcard export or a word per line")
+	dst := fs.String("out", "", "directory the json files of the words are written to")
+	format := fs.String("format", "", "format of the list: csv, tsv, pleco or list, detected from the file extension if empty")
+	columns := fs.String("columns", "", "columns of csv and tsv lists by 1-based index or header name, e.g. chinese=1,pinyin=2,english=Meaning; keys: chinese, pinyin, english, note")
+	header := fs.Bool("header", false, "skip the header line of csv and tsv lists")
+	cedict := fs.String("cedict", os.Getenv("CEDICT_PATH"), "CC-CEDICT file to fill in missing definitions and tones")
+	fs.Parse(args)
+
+	if *src == "" || *dst == "" {
+		log.Fatal("need a word list and an output dir, specified with -src path/to/list -out path/to/dir")
+	}
+	importer := &input.WordImporter{
+		Format: *format,
+		Header: *header,
+	}
+	if *columns != "" {
+		c, err := input.ParseColumns(*columns)
+		if err != nil {
+			log.Fatal(err)
+		}
+		importer.Columns = c
+	}
+	importer.Dict = loadDict(*cedict)
+	if importer.Dict == nil {
+		slog.Warn("no cedict configured, words are imported without dictionary definitions")
+	}
+
+	words, err := importer.Import(*src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := input.WriteWords(*dst, words); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("imported words", "count", len(words), "out", *dst)
+}
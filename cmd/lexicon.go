@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fbngrm/zh-audio/pkg/input"
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
+	"golang.org/x/exp/slog"
+)
+
+// runLexicon writes the pronunciation lexicon as azure custom lexicon and lists the
+// polyphonic characters of an input that have no override.
+func runLexicon(args []string) {
+	fs := flag.NewFlagSet("lexicon", flag.ExitOnError)
+	path := fs.String("lexicon", os.Getenv("LEXICON_PATH"), "pronunciation lexicon of words and their pinyin")
+	pls := fs.String("pls", "", "write the lexicon as azure custom lexicon to this file")
+	src := fs.String("src", "", "input to check for polyphonic characters without override")
+	kind := fs.String("kind", "words", "kind of the input: words, clozes, patterns, sentences or dialog")
+	cedict := fs.String("cedict", os.Getenv("CEDICT_PATH"), "CC-CEDICT file, skips words with a single reading and lists the readings of the characters")
+	fs.Parse(args)
+
+	if *pls == "" && *src == "" {
+		log.Fatal("need a file to write the lexicon to or an input to check, specified with -pls path/to/lexicon.xml or -src path/to/input")
+	}
+	lexicon := loadLexicon(*path)
+	if *pls != "" {
+		if lexicon == nil {
+			log.Fatal("need a lexicon, specified with -lexicon path/to/lexicon.txt or LEXICON_PATH")
+		}
+		if err := writePLS(lexicon, *pls); err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("wrote custom lexicon", "path", *pls, "words", len(lexicon.Words()))
+	}
+	if *src == "" {
+		return
+	}
+	polyphones, err := input.CheckPolyphones(*kind, *src, lexicon, loadDict(*cedict))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range polyphones {
+		fmt.Println(p)
+	}
+	slog.Info("polyphonic characters without override", "count", len(polyphones))
+}
+
+func writePLS(lexicon *textnorm.Lexicon, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := lexicon.WritePLS(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadLexicon loads the pronunciation lexicon, nil if no path is configured.
+func loadLexicon(path string) *textnorm.Lexicon {
+	if path == "" {
+		return nil
+	}
+	l, err := textnorm.LoadLexicon(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return l
+}
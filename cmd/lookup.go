@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/dict"
+)
+
+// runLookup prints the dictionary entries of words or of a pinyin.
+func runLookup(args []string) {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	cedict := fs.String("cedict", os.Getenv("CEDICT_PATH"), "CC-CEDICT file")
+	byPinyin := fs.Bool("pinyin", false, "look up the arguments as pinyin, e.g. ni3hao3, nǐhǎo or nihao")
+	speak := fs.Bool("speak", false, "also print the meaning as read by the english voice")
+	senses := fs.Int("senses", dict.DefaultSenses, "senses of the spoken meaning")
+	check := fs.String("check", "", "check the spoken meanings of a corpus of glosses, e.g. pkg/dict/testdata/speakable.tsv")
+	fs.Parse(args)
+
+	if *check != "" {
+		checkSpeakable(*check)
+		return
+	}
+	if fs.NArg() == 0 {
+		log.Fatal("need words to look up, e.g. zh-audio lookup 你好")
+	}
+	d := loadDict(*cedict)
+	if d == nil {
+		log.Fatal("need a dictionary, specified with -cedict path/to/cedict_ts.u8 or CEDICT_PATH")
+	}
+	queries := fs.Args()
+	if *byPinyin {
+		queries = []string{strings.Join(fs.Args(), " ")}
+	}
+	for _, q := range queries {
+		entries := d.Lookup(q)
+		if *byPinyin {
+			entries = d.LookupPinyin(q)
+		}
+		if len(entries) == 0 {
+			fmt.Printf("%s: not found\n", q)
+			continue
+		}
+		for _, e := range entries {
+			headword := e.Simplified
+			if e.Traditional != e.Simplified {
+				headword += " (" + e.Traditional + ")"
+			}
+			fmt.Printf("%s [%s] %s\n", headword, dict.Marked(e.Pinyin), strings.Join(e.Definitions(), "; "))
+			if cl := e.Classifiers(); len(cl) > 0 {
+				fmt.Printf("  measure words: %s\n", strings.Join(cl, ", "))
+			}
+			if *speak {
+				fmt.Printf("  spoken: %s\n", strings.Join(dict.Speakable(e.Glosses, *senses), ", "))
+			}
+		}
+	}
+}
+
+// checkSpeakable runs a corpus of glosses and exits with an error on mismatches.
+func checkSpeakable(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	mismatches, err := dict.CheckSpeakable(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	if len(mismatches) > 0 {
+		log.Fatalf("%d spoken meanings do not match the corpus", len(mismatches))
+	}
+	fmt.Println("ok")
+}
+
+// loadDict loads the dictionary, nil if no path is configured.
+func loadDict(path string) *dict.Dict {
+	if path == "" {
+		return nil
+	}
+	d, err := dict.Load(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return d
+}
@@ -1,27 +1,98 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
 	"github.com/fbngrm/zh-audio/pkg/input"
+	"golang.org/x/exp/slog"
 )
 
 var out = "./out"
 var in string
 var isDialog, isSentences, isPatterns, isClozes, isWords bool
+var isRolePlay, isBilingual, withCue bool
+var drill, drillEnglish bool
+var role, profile string
+var noTrim, join, cues, subtitles bool
+var tag bool
+var album, coverFont string
+var audiobook, interstitial string
+var cedict string
+var lexicon, lexiconURI string
+var beep string
+var pad int
+var senses int
+var trimOpts = audio.DefaultTrim
 var key string
-var ignoreChars = []string{"!", "！", "？", "?", "，", ",", ".", "。", "", " ", "、"}
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "cache":
+			runCache(os.Args[2:])
+			return
+		case "publish":
+			runPublish(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "ankiconnect":
+			runAnkiConnect(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "lookup":
+			runLookup(os.Args[2:])
+			return
+		case "lexicon":
+			runLexicon(os.Args[2:])
+			return
+		}
+	}
+
 	flag.StringVar(&in, "src", "", "source file")
 	flag.BoolVar(&isDialog, "d", false, "is this a dialog input")
 	flag.BoolVar(&isPatterns, "p", false, "is this a pattern input")
 	flag.BoolVar(&isSentences, "s", false, "is this a sentence input")
 	flag.BoolVar(&isClozes, "c", false, "is this a cloze input")
 	flag.BoolVar(&isWords, "w", false, "is this a words input")
+	flag.BoolVar(&isRolePlay, "r", false, "render a dialog input as role-play")
+	flag.BoolVar(&isBilingual, "b", false, "render a dialog input line by line in chinese and english")
+	flag.BoolVar(&drill, "drill", false, "render a words, clozes, sentences or patterns input as production drill, english first and the chinese after a gap")
+	flag.BoolVar(&drillEnglish, "drill-english", false, "play the english prompt again after the answer of the production drill")
+	flag.StringVar(&role, "role", "", "speaker played by the learner in role-play, all speakers if empty")
+	flag.BoolVar(&withCue, "cue", false, "play an english cue before the learner's turn in role-play")
+	flag.StringVar(&profile, "profile", "", "loudness profile of the rendered loops: default, earbuds or car")
+	flag.BoolVar(&noTrim, "no-trim", false, "keep the leading and trailing silence of every clip, it is trimmed by default")
+	flag.Float64Var(&trimOpts.Threshold, "trim-threshold", trimOpts.Threshold, "level in dBFS below which audio counts as silence")
+	flag.IntVar(&trimOpts.Padding, "trim-padding", trimOpts.Padding, "silence in ms kept around trimmed clips")
+	flag.StringVar(&beep, "beep", "", "audio file or cue played at the end of each item, e.g. cue:end or peep_silence.mp3")
+	flag.BoolVar(&cues, "cues", false, "mark item start, english parts and response gaps with cue sounds")
+	flag.IntVar(&pad, "pad", 0, "silence in ms added to the end of each item, before the beep")
+	flag.BoolVar(&subtitles, "subtitles", false, "write .lrc and .vtt subtitles for every rendered loop, the words, clozes and dialogs modes synthesize every voice on its own then")
+	flag.BoolVar(&tag, "tag", false, "write id3 tags with transcript and cover art to the outputs")
+	flag.StringVar(&album, "album", "", "album of the tagged outputs, e.g. the lesson, today's date if empty")
+	flag.StringVar(&coverFont, "cover-font", "", "font with chinese glyphs for the cover art, common system fonts are tried if empty")
+	flag.BoolVar(&join, "join", false, "join all items of the run into a single loop")
+	flag.StringVar(&audiobook, "audiobook", "", "export the items of the run as an audiobook with a chapter per item: mp3 or m4b")
+	flag.StringVar(&interstitial, "interstitial", "", "audio file or cue played between the chapters of the audiobook, e.g. cue:start")
+	flag.StringVar(&cedict, "cedict", os.Getenv("CEDICT_PATH"), "CC-CEDICT file to fill in missing definitions and tones and to romanize transcripts")
+	flag.StringVar(&lexicon, "lexicon", os.Getenv("LEXICON_PATH"), "pronunciation lexicon of words and their pinyin, overrides the readings azure picks")
+	flag.StringVar(&lexiconURI, "lexicon-uri", os.Getenv("LEXICON_URI"), "url of an azure custom lexicon referenced by the queries, e.g. written by zh-audio lexicon -pls")
+	flag.IntVar(&senses, "senses", dict.DefaultSenses, "senses of a word's meaning read aloud by the words and clozes modes")
 	flag.Parse()
 
 	if in == "" {
@@ -32,39 +103,126 @@ func main() {
 	if audioCacheDir == "" {
 		log.Fatal("Environment variable AUDIO_CACHE_DIR is not set")
 	}
+	// with a team cache server, clips are synthesized by the server holding the azure key
+	teamCache := cacheServer()
 	azureApiKey := os.Getenv("SPEECH_KEY")
-	if azureApiKey == "" {
+	if azureApiKey == "" && teamCache == nil {
 		log.Fatal("Environment variable SPEECH_KEY is not set")
 	}
 	azureEndpoint := os.Getenv("AZURE_ENDPOINT")
-	if azureEndpoint == "" {
+	if azureEndpoint == "" && teamCache == nil {
 		log.Fatal("Environment variable AZURE_ENDPOINT is not set")
 	}
-	azureClient, err := audio.NewAzureClient(azureApiKey, azureEndpoint, out, ignoreChars)
+	azureClient, err := audio.NewAzureClient(azureApiKey, azureEndpoint, out)
 	if err != nil {
 		log.Fatal(err)
 	}
+	azureClient.Remote = teamCache
+	azureClient.Lexicon = loadLexicon(lexicon)
+	azureClient.LexiconURI = lexiconURI
 
 	gcpClient, err := audio.NewGCPClient(out)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	concatenator := audio.NewConcatenator()
+	loudness, err := audio.LookupProfile(profile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dictionary := loadDict(cedict)
+	manifest := audio.NewManifest(mode())
+	render := audio.RenderOptions{
+		Profile:   loudness,
+		Pad:       pad,
+		Beep:      beep,
+		Cues:      cues,
+		Subtitles: subtitles,
+		Manifest:  manifest,
+	}
+	if !noTrim {
+		render.Trim = &trimOpts
+	}
+	if dictionary != nil {
+		render.Pinyin = dictionary.Pinyin
+	}
+	if tag {
+		tags, err := tagOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dictionary != nil {
+			tags.Pinyin = dictionary.Pinyin
+		}
+		render.Tags = tags
+		// modes synthesized in one piece are tagged on download
+		if (isWords || isClozes || isDialog) && !drill && !subtitles {
+			azureClient.Tags = tags
+		}
+	}
+	concatenator := audio.NewConcatenatorWithOptions(render)
+	// modes synthesized in one piece have no timings to write subtitles for, with subtitles
+	// they render every voice on their own
+	var segmented *audio.RenderOptions
+	if subtitles {
+		segmented = &render
+	}
 
+	azureClient.Manifest = manifest
+	gcpClient.Manifest = manifest
 	cache := &audio.Cache{
 		AudioCacheDir: audioCacheDir,
+		Manifest:      manifest,
+		Lexicon:       azureClient.Lexicon,
+	}
+	cache.Remote = remoteStore()
+	defer func() {
+		if _, err := manifest.Save(audioCacheDir); err != nil {
+			log.Fatal(err)
+		}
+		if err := cache.Upload(context.Background(), azureClient.AudioDir); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if drill {
+		drillProcessor := input.DrillProcessor{
+			AzureDownloader: azureClient,
+			Cache:           cache,
+			OutDir:          out,
+			Render:          render,
+			Dict:            dictionary,
+			Senses:          senses,
+			RepeatEnglish:   drillEnglish,
+		}
+		if err := drillProcessor.GetDrillAudio(mode(), in); err != nil {
+			log.Fatal(err)
+		}
+		if err := finish(azureClient.AudioDir, render); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	if isDialog {
+	if isDialog || isRolePlay || isBilingual {
 		dialogProcessor := input.DialogProcessor{
 			GCPDownloader:   gcpClient,
 			AzureDownloader: azureClient,
+			Cache:           cache,
+			OutDir:          out,
+			Render:          render,
 		}
-		if err := dialogProcessor.GetAzureAudio(in); err != nil {
+		if isRolePlay {
+			if err := dialogProcessor.GetRolePlayAudio(in, role, withCue); err != nil {
+				log.Fatal(err)
+			}
+		} else if isBilingual {
+			if err := dialogProcessor.GetBilingualAudio(in); err != nil {
+				log.Fatal(err)
+			}
+		} else if err := dialogProcessor.GetAzureAudio(in); err != nil {
 			log.Fatal(err)
 		}
-		os.Exit(0)
 	}
 	if isSentences {
 		sentenceProcessor, err := input.NewSentenceProcessor(
@@ -104,6 +262,9 @@ func main() {
 	if isClozes {
 		clozesProcessor := input.ClozeProcessor{
 			AzureDownloader: azureClient,
+			Dict:            dictionary,
+			Senses:          senses,
+			Render:          segmented,
 		}
 		if err := clozesProcessor.GetAzureAudio(in); err != nil {
 			log.Fatal(err)
@@ -112,9 +273,104 @@ func main() {
 	if isWords {
 		wordsProcessor := input.WordProcessor{
 			AzureDownloader: azureClient,
+			Dict:            dictionary,
+			Senses:          senses,
+			Render:          segmented,
 		}
 		if err := wordsProcessor.GetAzureAudio(in); err != nil {
 			log.Fatal(err)
 		}
 	}
+
+	if err := finish(azureClient.AudioDir, render); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// finish adds the trailing pad and beep to modes synthesized in one piece by azure and
+// joins the items of the run into a loop or an audiobook if requested. Modes rendered by
+// the concatenator already got the pad and beep applied.
+func finish(audioDir string, render audio.RenderOptions) error {
+	var dir string
+	switch {
+	case drill:
+		dir = filepath.Join(out, "drill")
+	case isWords, isClozes, isDialog:
+		dir = audioDir
+		// rendered by segment, the pad and beep are applied already
+		if (render.Pad > 0 || render.Beep != "") && !render.Subtitles {
+			dir = filepath.Join(out, "concat")
+			if _, err := audio.Finish(audioDir, dir, render); err != nil {
+				return err
+			}
+		}
+	case isSentences:
+		dir = filepath.Join(out, "sentences")
+	case isPatterns:
+		dir = filepath.Join(out, "patterns")
+	case isRolePlay:
+		dir = filepath.Join(out, "roleplay")
+	default:
+		// bilingual dialogs come with a combined file already
+		return nil
+	}
+	name := mode()
+	if drill {
+		name += "_drill"
+	}
+	if join {
+		if err := audio.Join(filepath.Join(out, name+".mp3"), dir, 0); err != nil {
+			return err
+		}
+	}
+	if audiobook != "" {
+		return audio.ExportAudiobook(filepath.Join(out, name+"_audiobook."+audiobook), dir, audio.AudiobookOptions{
+			Format:       audiobook,
+			Title:        strings.TrimSuffix(filepath.Base(in), filepath.Ext(in)),
+			Interstitial: interstitial,
+			Pause:        1000,
+			Tags:         render.Tags,
+		})
+	}
+	return nil
+}
+
+func tagOptions() (*audio.TagOptions, error) {
+	font, err := audio.LoadCoverFont(coverFont)
+	if err != nil {
+		return nil, err
+	}
+	if font == nil {
+		slog.Warn("no cover font found, drawing covers without characters")
+	}
+	if album == "" {
+		album = time.Now().Format("2006-01-02")
+	}
+	return &audio.TagOptions{
+		Album:  album,
+		Genre:  mode(),
+		Artist: "zh-audio",
+		Font:   font,
+	}, nil
+}
+
+// mode names the kind of input for the manifest of the run.
+func mode() string {
+	switch {
+	case isRolePlay:
+		return "roleplay"
+	case isBilingual:
+		return "bilingual"
+	case isDialog:
+		return "dialogs"
+	case isSentences:
+		return "sentences"
+	case isPatterns:
+		return "patterns"
+	case isClozes:
+		return "clozes"
+	case isWords:
+		return "words"
+	}
+	return "unknown"
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"golang.org/x/exp/slog"
+)
+
+const publishUsage = `usage: zh-audio publish <command> [flags]
+
+commands:
+  podcast  add the loops of a run to the podcast feed
+  serve    serve the podcast feed and episodes over http`
+
+// runPublish implements the publish subcommand group.
+func runPublish(args []string) {
+	if len(args) == 0 {
+		log.Fatal(publishUsage)
+	}
+	fs := flag.NewFlagSet("publish "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", envOr("PODCAST_DIR", "./podcast"), "podcast directory holding the feed and episodes")
+
+	switch args[0] {
+	case "podcast":
+		src := fs.String("src", "", "directory with the loops of the run, e.g. out/patterns")
+		run := fs.String("run", "", "name of the run, today's date and the directory name if empty")
+		perLoop := fs.Bool("per-loop", false, "publish an episode per loop instead of one per run")
+		baseURL := fs.String("base-url", os.Getenv("PODCAST_BASE_URL"), "url the podcast directory is served at")
+		title := fs.String("title", "", "title of the feed")
+		author := fs.String("author", "", "author of the feed")
+		image := fs.String("image", "", "url of the cover image of the feed")
+		fs.Parse(args[1:])
+		if *src == "" {
+			log.Fatal("need a run directory, specified with -src out/patterns")
+		}
+		if *run == "" {
+			*run = time.Now().Format("2006-01-02") + " " + filepath.Base(*src)
+		}
+		if err := os.MkdirAll(*dir, os.ModePerm); err != nil {
+			log.Fatal(err)
+		}
+		podcast, err := audio.LoadPodcast(*dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// flags update the feed, which keeps them for later runs
+		setIf(&podcast.BaseURL, *baseURL)
+		setIf(&podcast.Title, *title)
+		setIf(&podcast.Author, *author)
+		setIf(&podcast.Image, *image)
+		if podcast.BaseURL == "" {
+			log.Fatal("need the url the podcast is served at, specified with -base-url or PODCAST_BASE_URL")
+		}
+		episodes, err := podcast.PublishRun(*dir, *src, *run, *perLoop)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := podcast.Save(*dir); err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("published podcast", "dir", *dir, "episodes", len(episodes), "total", len(podcast.Episodes))
+	case "serve":
+		addr := fs.String("addr", ":8090", "listen address")
+		fs.Parse(args[1:])
+		slog.Info("serving podcast", "addr", *addr, "dir", *dir)
+		log.Fatal(http.ListenAndServe(*addr, audio.PodcastHandler(*dir)))
+	default:
+		log.Fatal(publishUsage)
+	}
+}
+
+func setIf(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"golang.org/x/exp/slog"
+)
+
+// runServe serves a web ui to browse and play the loops of the output and loop cache
+// dirs, e.g. from a phone on the same network.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	dirs := fs.String("dirs", strings.Join([]string{out, os.Getenv("LOOP_CACHE_DIR")}, ","), "comma separated directories with loops")
+	fs.Parse(args)
+
+	library := &audio.Library{
+		CacheDir: os.Getenv("AUDIO_CACHE_DIR"),
+	}
+	for _, d := range strings.Split(*dirs, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			library.Dirs = append(library.Dirs, d)
+		}
+	}
+	if library.CacheDir == "" {
+		slog.Warn("AUDIO_CACHE_DIR is not set, serving loops without the transcripts of the manifests")
+	}
+	if err := library.Scan(); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("serving loops", "addr", *addr, "dirs", library.Dirs)
+	log.Fatal(http.ListenAndServe(*addr, library.Handler()))
+}
@@ -0,0 +1,372 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// NoteType is an anki model. Standard note types get a card per template, cloze note
+// types a card per cloze number used in the fields.
+type NoteType struct {
+	Name      string     `json:"name"`
+	Cloze     bool       `json:"cloze"`
+	Fields    []string   `json:"fields"`
+	Templates []Template `json:"templates"`
+	CSS       string     `json:"css"`
+}
+
+// Template is a card template in anki's own template syntax, e.g. {{Chinese}}.
+type Template struct {
+	Name  string `json:"name"`
+	Front string `json:"front"`
+	Back  string `json:"back"`
+}
+
+// Note holds the field values in the order of the fields of its type.
+type Note struct {
+	Type   *NoteType
+	GUID   string
+	Fields []string
+	Tags   []string
+}
+
+// Deck is written as an .apkg package. Media are local files referenced by their media
+// name from the fields, e.g. [sound:zh-audio_2cd57668ab768098.mp3], see MediaName.
+type Deck struct {
+	Name  string
+	Notes []*Note
+	Media []string
+}
+
+// GUID derives a note guid from the given parts. Anki identifies notes by their guid on
+// import, notes with a stable guid get updated instead of duplicated.
+func GUID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return base91(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// MediaName names a file in the media folder of a collection. The folder is shared by all
+// decks, so the name is prefixed and the base name of the file hashed: a plain 好.mp3
+// would replace the clip of another deck.
+func MediaName(file string) string {
+	base := filepath.Base(file)
+	sum := sha256.Sum256([]byte(base))
+	return "zh-audio_" + hex.EncodeToString(sum[:8]) + filepath.Ext(base)
+}
+
+const base91Table = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_`{|}~"
+
+// base91 encodes like anki's own guids.
+func base91(n uint64) string {
+	if n == 0 {
+		return base91Table[:1]
+	}
+	var out []byte
+	for n > 0 {
+		out = append([]byte{base91Table[n%91]}, out...)
+		n /= 91
+	}
+	return string(out)
+}
+
+// id derives a stable id from a name. Ids stay below 2^53 since anki handles them in
+// javascript as well.
+func id(parts ...string) int64 {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return int64(binary.BigEndian.Uint64(sum[:8])>>11) + 1
+}
+
+func (t *NoteType) id() int64 {
+	return id("model", t.Name)
+}
+
+func (d *Deck) id() int64 {
+	return id("deck", d.Name)
+}
+
+// WritePackage writes the deck as .apkg, a zip with the sqlite collection, the media
+// files numbered from 0 and a media map of the numbers to their media names.
+func (d *Deck) WritePackage(path string) error {
+	tmp, err := os.MkdirTemp("", "apkg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	collection := filepath.Join(tmp, "collection.anki2")
+	if err := d.writeCollection(collection); err != nil {
+		return fmt.Errorf("failed to write anki collection: %w", err)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := zip.NewWriter(out)
+	if err := addFile(w, "collection.anki2", collection); err != nil {
+		return err
+	}
+	media := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, file := range d.Media {
+		name := MediaName(file)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		key := strconv.Itoa(len(media))
+		media[key] = name
+		if err := addFile(w, key, file); err != nil {
+			return err
+		}
+	}
+	mw, err := w.Create("media")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(mw).Encode(media); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addFile(w *zip.Writer, name, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zw, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zw, in)
+	return err
+}
+
+// schema of anki collections version 11, which all anki versions import
+const schema = `
+CREATE TABLE col (
+	id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+	ver integer not null, dty integer not null, usn integer not null, ls integer not null,
+	conf text not null, models text not null, decks text not null, dconf text not null, tags text not null
+);
+CREATE TABLE notes (
+	id integer primary key, guid text not null, mid integer not null, mod integer not null,
+	usn integer not null, tags text not null, flds text not null, sfld integer not null,
+	csum integer not null, flags integer not null, data text not null
+);
+CREATE TABLE cards (
+	id integer primary key, nid integer not null, did integer not null, ord integer not null,
+	mod integer not null, usn integer not null, type integer not null, queue integer not null,
+	due integer not null, ivl integer not null, factor integer not null, reps integer not null,
+	lapses integer not null, left integer not null, odue integer not null, odid integer not null,
+	flags integer not null, data text not null
+);
+CREATE TABLE revlog (
+	id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+	ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null,
+	type integer not null
+);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+func (d *Deck) writeCollection(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	models, err := d.models(now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		now.Unix(), now.UnixMilli(), now.UnixMilli(),
+		mustJSON(collectionConf(d.id())), mustJSON(models), mustJSON(d.decks(now)), defaultDeckConf)
+	if err != nil {
+		return err
+	}
+
+	for i, n := range d.Notes {
+		if len(n.Fields) != len(n.Type.Fields) {
+			return fmt.Errorf("note %s has %d fields, note type %s has %d", n.GUID, len(n.Fields), n.Type.Name, len(n.Type.Fields))
+		}
+		nid := id("note", n.GUID)
+		sortField := stripHTML(n.Fields[0])
+		sum := sha1.Sum([]byte(sortField))
+		csum, _ := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+		tags := ""
+		if len(n.Tags) > 0 {
+			tags = " " + strings.Join(n.Tags, " ") + " "
+		}
+		_, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			nid, n.GUID, n.Type.id(), now.Unix(), tags, strings.Join(n.Fields, "\x1f"), sortField, csum)
+		if err != nil {
+			return err
+		}
+		for _, ord := range n.cards() {
+			_, err := tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')`,
+				id("card", n.GUID, strconv.Itoa(ord)), nid, d.id(), ord, now.Unix(), i+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+var clozeRe = regexp.MustCompile(`{{c(\d+)::`)
+
+// cards returns the template ords of the cards of a note.
+func (n *Note) cards() []int {
+	if !n.Type.Cloze {
+		ords := make([]int, len(n.Type.Templates))
+		for i := range ords {
+			ords[i] = i
+		}
+		return ords
+	}
+	seen := make(map[int]bool)
+	var ords []int
+	for _, f := range n.Fields {
+		for _, m := range clozeRe.FindAllStringSubmatch(f, -1) {
+			num, _ := strconv.Atoi(m[1])
+			if num > 0 && !seen[num-1] {
+				seen[num-1] = true
+				ords = append(ords, num-1)
+			}
+		}
+	}
+	sort.Ints(ords)
+	return ords
+}
+
+var htmlRe = regexp.MustCompile(`<[^>]*>|\[sound:[^\]]*\]`)
+
+func stripHTML(s string) string {
+	return strings.TrimSpace(htmlRe.ReplaceAllString(s, ""))
+}
+
+func (d *Deck) models(now time.Time) (map[string]any, error) {
+	models := make(map[string]any)
+	for _, n := range d.Notes {
+		t := n.Type
+		if _, ok := models[strconv.FormatInt(t.id(), 10)]; ok {
+			continue
+		}
+		if len(t.Fields) == 0 || len(t.Templates) == 0 {
+			return nil, fmt.Errorf("note type %s needs fields and templates", t.Name)
+		}
+		var fields, templates []map[string]any
+		ords := make([]int, len(t.Fields))
+		for i, f := range t.Fields {
+			ords[i] = i
+			fields = append(fields, map[string]any{
+				"name": f, "ord": i, "font": "Arial", "size": 20, "media": []any{}, "rtl": false, "sticky": false,
+			})
+		}
+		var req []any
+		for i, tmpl := range t.Templates {
+			templates = append(templates, map[string]any{
+				"name": tmpl.Name, "ord": i, "qfmt": tmpl.Front, "afmt": tmpl.Back,
+				"bqfmt": "", "bafmt": "", "did": nil,
+			})
+			req = append(req, []any{i, "any", ords})
+		}
+		typ := 0
+		if t.Cloze {
+			typ = 1
+		}
+		models[strconv.FormatInt(t.id(), 10)] = map[string]any{
+			"id":        t.id(),
+			"name":      t.Name,
+			"type":      typ,
+			"mod":       now.Unix(),
+			"usn":       -1,
+			"sortf":     0,
+			"did":       d.id(),
+			"flds":      fields,
+			"tmpls":     templates,
+			"req":       req,
+			"css":       t.CSS,
+			"tags":      []any{},
+			"vers":      []any{},
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+		}
+	}
+	return models, nil
+}
+
+func (d *Deck) decks(now time.Time) map[string]any {
+	deck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "desc": "", "mod": now.Unix(), "usn": -1, "conf": 1, "dyn": 0,
+			"collapsed": false, "extendNew": 10, "extendRev": 50,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	return map[string]any{
+		"1":                           deck(1, "Default"),
+		strconv.FormatInt(d.id(), 10): deck(d.id(), d.Name),
+	}
+}
+
+func collectionConf(deck int64) map[string]any {
+	return map[string]any{
+		"activeDecks": []int64{deck}, "curDeck": deck, "newSpread": 0, "collapseTime": 1200,
+		"timeLim": 0, "estTimes": true, "dueCounts": true, "curModel": nil, "nextPos": 1,
+		"sortType": "noteFld", "sortBackwards": false, "addToCur": true,
+	}
+}
+
+const defaultDeckConf = `{"1": {"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true,
+"timer": 0, "replayq": true, "dyn": false,
+"new": {"bury": true, "delays": [1, 10], "initialFactor": 2500, "ints": [1, 4, 7], "order": 1, "perDay": 20, "separate": true},
+"lapse": {"delays": [10], "leechAction": 0, "leechFails": 8, "minInt": 1, "mult": 0},
+"rev": {"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "perDay": 100}}}`
+
+func mustJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
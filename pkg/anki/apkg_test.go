@@ -0,0 +1,285 @@
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGUID(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		equal bool
+	}{
+		{"stable", []string{"zh-audio", "words", "你好"}, []string{"zh-audio", "words", "你好"}, true},
+		{"kind", []string{"zh-audio", "words", "你好"}, []string{"zh-audio", "clozes", "你好"}, false},
+		{"key", []string{"zh-audio", "words", "你好"}, []string{"zh-audio", "words", "您好"}, false},
+		{"separator", []string{"ab", "c"}, []string{"a", "bc"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := GUID(tt.a...), GUID(tt.b...)
+			if (a == b) != tt.equal {
+				t.Errorf("GUID(%q) = %s, GUID(%q) = %s", tt.a, a, tt.b, b)
+			}
+			if strings.Trim(a, base91Table) != "" || len(a) == 0 || len(a) > 10 {
+				t.Errorf("GUID(%q) = %s is no base91 of 64 bits", tt.a, a)
+			}
+		})
+	}
+	if got := GUID("zh-audio", "words", "你好"); got != "EFB%}A2E/k" {
+		t.Errorf("guid changed to %s, notes would be duplicated on import", got)
+	}
+}
+
+func TestBase91(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "a"},
+		{1, "b"},
+		{90, "~"},
+		{91, "ba"},
+		{91*91 + 2, "bac"},
+	}
+	for _, tt := range tests {
+		if got := base91(tt.n); got != tt.want {
+			t.Errorf("base91(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMediaName(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"/clips/你好.mp3", "zh-audio_2cd57668ab768098.mp3"},
+		{"你好.mp3", "zh-audio_2cd57668ab768098.mp3"},
+		{"/clips/你好.wav", "zh-audio_"},
+	}
+	for _, tt := range tests {
+		got := MediaName(tt.file)
+		if !strings.HasPrefix(got, tt.want) || filepath.Ext(got) != filepath.Ext(tt.file) {
+			t.Errorf("MediaName(%s) = %s, want %s", tt.file, got, tt.want)
+		}
+	}
+	if MediaName("a/好.mp3") == MediaName("a/你好.mp3") {
+		t.Error("media names of different clips collide")
+	}
+}
+
+func TestWritePackageNamesMedia(t *testing.T) {
+	dir := t.TempDir()
+	clip := filepath.Join(dir, "好.mp3")
+	if err := os.WriteFile(clip, []byte("mp3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	typ := &NoteType{Name: "zh", Fields: []string{"Chinese", "Audio"}, Templates: []Template{{Name: "Card", Front: "{{Chinese}}", Back: "{{Audio}}"}}}
+	deck := &Deck{
+		Name:  "zh",
+		Notes: []*Note{{Type: typ, GUID: GUID("好"), Fields: []string{"好", "[sound:" + MediaName(clip) + "]"}}},
+		Media: []string{clip, clip},
+	}
+	path := filepath.Join(dir, "zh.apkg")
+	if err := deck.WritePackage(path); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f, err := r.Open("media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var media map[string]string
+	if err := json.NewDecoder(f).Decode(&media); err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 1 || media["0"] != MediaName(clip) {
+		t.Errorf("media = %v, want 0: %s", media, MediaName(clip))
+	}
+}
+
+func TestWritePackageCollection(t *testing.T) {
+	dir := t.TempDir()
+	word := &NoteType{
+		Name:   "zh word",
+		Fields: []string{"Chinese", "English"},
+		Templates: []Template{
+			{Name: "Listening", Front: "{{English}}", Back: "{{Chinese}}"},
+			{Name: "Reading", Front: "{{Chinese}}", Back: "{{English}}"},
+		},
+		CSS: ".card { color: red; }",
+	}
+	cloze := &NoteType{
+		Name:      "zh cloze",
+		Cloze:     true,
+		Fields:    []string{"Text", "English"},
+		Templates: []Template{{Name: "Cloze", Front: "{{cloze:Text}}", Back: "{{cloze:Text}}<br>{{English}}"}},
+	}
+	deck := &Deck{
+		Name: "zh::words",
+		Notes: []*Note{
+			{Type: word, GUID: GUID("你好"), Fields: []string{"<b>你好</b>[sound:a.mp3]", "hello"}, Tags: []string{"hsk1", "zh-audio"}},
+			{Type: cloze, GUID: GUID("我很好"), Fields: []string{"{{c3::我}}{{c1::很}}{{c1::好}}", "I am fine"}},
+		},
+	}
+	path := filepath.Join(dir, "zh.apkg")
+	if err := deck.WritePackage(path); err != nil {
+		t.Fatal(err)
+	}
+	db := openCollection(t, path, dir)
+
+	type note struct {
+		guid, tags, flds, sfld string
+		mid                    int64
+		ords                   []int
+	}
+	want := []note{
+		{guid: GUID("你好"), tags: " hsk1 zh-audio ", flds: "<b>你好</b>[sound:a.mp3]\x1fhello", sfld: "你好", mid: word.id(), ords: []int{0, 1}},
+		// a card per cloze number, not per template
+		{guid: GUID("我很好"), flds: "{{c3::我}}{{c1::很}}{{c1::好}}\x1fI am fine", sfld: "{{c3::我}}{{c1::很}}{{c1::好}}", mid: cloze.id(), ords: []int{0, 2}},
+	}
+	var got []note
+	rows, err := db.Query(`SELECT id, guid, tags, flds, sfld, mid FROM notes ORDER BY guid = ?`, GUID("我很好"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var n note
+		var nid int64
+		if err := rows.Scan(&nid, &n.guid, &n.tags, &n.flds, &n.sfld, &n.mid); err != nil {
+			t.Fatal(err)
+		}
+		cards, err := db.Query(`SELECT ord FROM cards WHERE nid = ? AND did = ? ORDER BY ord`, nid, deck.id())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for cards.Next() {
+			var ord int
+			if err := cards.Scan(&ord); err != nil {
+				t.Fatal(err)
+			}
+			n.ords = append(n.ords, ord)
+		}
+		cards.Close()
+		got = append(got, n)
+	}
+	rows.Close()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("notes\n%+v\nwant\n%+v", got, want)
+	}
+
+	var models, decks string
+	if err := db.QueryRow(`SELECT models, decks FROM col`).Scan(&models, &decks); err != nil {
+		t.Fatal(err)
+	}
+	type model struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Type  int    `json:"type"`
+		CSS   string `json:"css"`
+		Did   int64  `json:"did"`
+		Sortf int    `json:"sortf"`
+		Flds  []struct {
+			Name string `json:"name"`
+			Ord  int    `json:"ord"`
+		} `json:"flds"`
+		Tmpls []struct {
+			Name string `json:"name"`
+			Ord  int    `json:"ord"`
+			Qfmt string `json:"qfmt"`
+			Afmt string `json:"afmt"`
+		} `json:"tmpls"`
+		Req [][]any `json:"req"`
+	}
+	var byID map[string]model
+	if err := json.Unmarshal([]byte(models), &byID); err != nil {
+		t.Fatal(err)
+	}
+	if len(byID) != 2 {
+		t.Fatalf("models %s", models)
+	}
+	for _, typ := range []*NoteType{word, cloze} {
+		m, ok := byID[strconv.FormatInt(typ.id(), 10)]
+		if !ok {
+			t.Errorf("no model %s", typ.Name)
+			continue
+		}
+		kind := 0
+		if typ.Cloze {
+			kind = 1
+		}
+		if m.ID != typ.id() || m.Name != typ.Name || m.Type != kind || m.CSS != typ.CSS || m.Did != deck.id() || m.Sortf != 0 {
+			t.Errorf("model %+v of %s", m, typ.Name)
+		}
+		if len(m.Flds) != len(typ.Fields) || len(m.Tmpls) != len(typ.Templates) || len(m.Req) != len(typ.Templates) {
+			t.Fatalf("model %+v of %s", m, typ.Name)
+		}
+		for i, f := range typ.Fields {
+			if m.Flds[i].Name != f || m.Flds[i].Ord != i {
+				t.Errorf("field %d of %s: %+v", i, typ.Name, m.Flds[i])
+			}
+		}
+		for i, tmpl := range typ.Templates {
+			if m.Tmpls[i].Name != tmpl.Name || m.Tmpls[i].Ord != i || m.Tmpls[i].Qfmt != tmpl.Front || m.Tmpls[i].Afmt != tmpl.Back {
+				t.Errorf("template %d of %s: %+v", i, typ.Name, m.Tmpls[i])
+			}
+		}
+	}
+
+	var deckByID map[string]struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(decks), &deckByID); err != nil {
+		t.Fatal(err)
+	}
+	if deckByID[strconv.FormatInt(deck.id(), 10)].Name != deck.Name || deckByID["1"].Name != "Default" {
+		t.Errorf("decks %s", decks)
+	}
+}
+
+// openCollection extracts the sqlite collection of a package to dir and opens it.
+func openCollection(t *testing.T, path, dir string) *sql.DB {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f, err := r.Open("collection.anki2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	collection := filepath.Join(dir, "collection.anki2")
+	out, err := os.Create(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,126 @@
+package anki
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const DefaultConnectURL = "http://127.0.0.1:8765"
+
+// Connect is a client of the AnkiConnect add-on, which exposes the collection of a
+// running anki as json api.
+type Connect struct {
+	URL    string
+	Key    string // only needed if the add-on is configured with an api key
+	Client *http.Client
+}
+
+func NewConnect(url, key string) *Connect {
+	if url == "" {
+		url = DefaultConnectURL
+	}
+	return &Connect{
+		URL:    url,
+		Key:    key,
+		Client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// NoteInfo is a note as returned by notesInfo.
+type NoteInfo struct {
+	NoteID    int64                `json:"noteId"`
+	ModelName string               `json:"modelName"`
+	Tags      []string             `json:"tags"`
+	Fields    map[string]NoteField `json:"fields"`
+}
+
+type NoteField struct {
+	Value string `json:"value"`
+	Order int    `json:"order"`
+}
+
+// Field returns the value of a field, empty if the note has no such field.
+func (n NoteInfo) Field(name string) string {
+	return n.Fields[name].Value
+}
+
+// invoke calls an action of api version 6, which wraps results as {result, error}.
+func (c *Connect) invoke(ctx context.Context, action string, params any, result any) error {
+	body := map[string]any{"action": action, "version": 6}
+	if params != nil {
+		body["params"] = params
+	}
+	if c.Key != "" {
+		body["key"] = c.Key
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ankiconnect %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ankiconnect %s: %s", action, resp.Status)
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *string         `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("ankiconnect %s: failed to decode reply: %w", action, err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("ankiconnect %s: %s", action, *reply.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// FindNotes returns the ids of the notes matching a search, e.g. "deck:zh".
+func (c *Connect) FindNotes(ctx context.Context, query string) ([]int64, error) {
+	var ids []int64
+	err := c.invoke(ctx, "findNotes", map[string]any{"query": query}, &ids)
+	return ids, err
+}
+
+func (c *Connect) NotesInfo(ctx context.Context, ids []int64) ([]NoteInfo, error) {
+	var notes []NoteInfo
+	err := c.invoke(ctx, "notesInfo", map[string]any{"notes": ids}, &notes)
+	return notes, err
+}
+
+// StoreMediaFile stores a file in the media folder of the collection and returns the
+// name it was stored under.
+func (c *Connect) StoreMediaFile(ctx context.Context, filename string, data []byte) (string, error) {
+	var stored string
+	err := c.invoke(ctx, "storeMediaFile", map[string]any{
+		"filename": filename,
+		"data":     base64.StdEncoding.EncodeToString(data),
+	}, &stored)
+	if stored == "" {
+		stored = filename
+	}
+	return stored, err
+}
+
+// UpdateNoteFields sets the given fields of a note, other fields are kept.
+func (c *Connect) UpdateNoteFields(ctx context.Context, id int64, fields map[string]string) error {
+	return c.invoke(ctx, "updateNoteFields", map[string]any{
+		"note": map[string]any{"id": id, "fields": fields},
+	}, nil)
+}
@@ -0,0 +1,167 @@
+package audio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	"golang.org/x/exp/slog"
+)
+
+// audiobook formats
+const (
+	AudiobookMP3 = "mp3" // chapters as ID3 CHAP and CTOC frames
+	AudiobookM4B = "m4b" // chapters as mp4 chapter atom
+)
+
+type AudiobookOptions struct {
+	// mp3 or m4b
+	Format string
+	// title of the book
+	Title string
+	// optional, audio file or cue reference like cue:start played between chapters
+	Interstitial string
+	// silence in ms between chapters
+	Pause int
+	// optional, album, genre and cover font of the book
+	Tags *TagOptions
+}
+
+// ExportAudiobook joins all audio files of dir in name order into a single file with a
+// chapter per file. Chapters are named after the title tag of each file, or the file name
+// for untagged files, and carry the chinese text of the transcript. Each chapter is
+// rendered on its own and appended to the book, so the run is never held in memory. Mp3
+// chapters are encoded at a constant bitrate without a xing header, so that their frames
+// form a single stream and players compute chapter offsets from the bitrate, m4b chapters
+// are stored as pcm.
+func ExportAudiobook(outputFile, dir string, opts AudiobookOptions) error {
+	if opts.Format != AudiobookMP3 && opts.Format != AudiobookM4B {
+		return fmt.Errorf("unknown audiobook format %s, use %s or %s", opts.Format, AudiobookMP3, AudiobookM4B)
+	}
+	files, err := AudioFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no audio files to export in %s", dir)
+	}
+	if len(files) > 255 {
+		return fmt.Errorf("too many chapters: %d, at most 255 are supported", len(files))
+	}
+	tmp, err := os.MkdirTemp("", "zh-audio-audiobook-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	// m4b chapters are collected as pcm, mp3 chapters are encoded to parts
+	var pcm *os.File
+	if opts.Format == AudiobookM4B {
+		if pcm, err = os.Create(filepath.Join(tmp, "book.pcm")); err != nil {
+			return err
+		}
+		defer pcm.Close()
+	}
+
+	chapters := make([]Chapter, len(files))
+	parts := make([]string, len(files))
+	var start time.Duration
+	var rate beep.SampleRate
+	for i, file := range files {
+		tags, err := ReadTags(file)
+		if err != nil {
+			return err
+		}
+		chapters[i] = Chapter{
+			Title: tags.Title,
+			Text:  chineseLines(tags.Lyrics),
+		}
+		if chapters[i].Title == "" {
+			chapters[i].Title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+
+		// all chapters share the sample rate of the first, the interstitial closes the
+		// chapter before it
+		c := NewConcatenatorWithOptions(RenderOptions{SampleRate: rate})
+		if i == len(files)-1 {
+			c.AddWithPause(file, 0)
+		} else {
+			c.AddWithPause(file, opts.Pause)
+			if opts.Interstitial != "" {
+				c.AddWithPause(opts.Interstitial, opts.Pause)
+			}
+		}
+		samples, format, err := c.Render()
+		if err != nil {
+			return err
+		}
+		rate = format.SampleRate
+		d := rate.D(len(samples))
+		if opts.Format == AudiobookM4B {
+			if err := appendPCM(pcm, samples); err != nil {
+				return fmt.Errorf("failed to write chapter %s: %v", file, err)
+			}
+		} else {
+			parts[i] = filepath.Join(tmp, fmt.Sprintf("%03d.mp3", i))
+			if err := encodeMP3(parts[i], samples, format); err != nil {
+				return err
+			}
+			// the chapter lasts as long as its frames, including the padding of the encoder
+			if d, err = Duration(parts[i]); err != nil {
+				return err
+			}
+		}
+		chapters[i].Start, chapters[i].End = start, start+d
+		start += d
+	}
+
+	if opts.Format == AudiobookM4B {
+		if err := pcm.Close(); err != nil {
+			return err
+		}
+		if err := writeM4B(outputFile, pcm.Name(), rate, opts.Title, chapters); err != nil {
+			return err
+		}
+		slog.Info("exported audiobook", "path", outputFile, "chapters", len(chapters))
+		return nil
+	}
+
+	tags := Tags{Title: opts.Title, Chapters: chapters}
+	if opts.Tags != nil {
+		tags.Album = opts.Tags.Album
+		tags.Genre = opts.Tags.Genre
+		tags.Artist = opts.Tags.Artist
+		if cover, err := RenderCover(opts.Title, opts.Tags.Font); err == nil {
+			tags.Cover = cover
+		}
+	}
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer out.Close()
+	if _, err := out.Write(tags.ID3()); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	if err := joinMP3(out, parts); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	slog.Info("exported audiobook", "path", outputFile, "chapters", len(chapters))
+	return nil
+}
+
+// chineseLines returns the distinct lines of a transcript containing chinese.
+func chineseLines(transcript string) string {
+	var lines []string
+	for _, l := range strings.Split(transcript, "\n") {
+		if l = strings.TrimSpace(l); hasHan(l) {
+			lines = appendDistinct(lines, l)
+		}
+	}
+	return strings.Join(lines, " ")
+}
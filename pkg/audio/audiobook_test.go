@@ -0,0 +1,135 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportAudiobook(t *testing.T) {
+	dir := t.TempDir()
+	if err := ExportAudiobook(filepath.Join(t.TempDir(), "book.ogg"), dir, AudiobookOptions{Format: "ogg"}); err == nil {
+		t.Error("exported an ogg audiobook")
+	}
+	for _, name := range []string{"01.wav", "02.wav"} {
+		c := NewConcatenatorWithOptions(RenderOptions{Cues: true})
+		c.AddCue(CueStart, 500)
+		if err := c.Merge(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(t.TempDir(), "book.mp3")
+	if err := ExportAudiobook(out, dir, AudiobookOptions{Format: AudiobookMP3, Title: "book", Pause: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("ID3")) || !bytes.Contains(data, []byte("CHAP")) {
+		t.Error("audiobook has no chapters")
+	}
+	if _, err := Duration(out); err != nil {
+		t.Errorf("audiobook does not decode: %v", err)
+	}
+}
+
+func TestExportAudiobookM4B(t *testing.T) {
+	dir := t.TempDir()
+	var lengths []int
+	for _, name := range []string{"01.wav", "02.wav"} {
+		c := NewConcatenatorWithOptions(RenderOptions{Cues: true})
+		c.AddCue(CueStart, 500)
+		if err := c.Merge(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		samples, _, err := decodeFile(OutputPath(filepath.Join(dir, name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lengths = append(lengths, len(samples))
+	}
+	out := filepath.Join(t.TempDir(), "book.m4b")
+	if err := ExportAudiobook(out, dir, AudiobookOptions{Format: AudiobookM4B, Title: "book", Pause: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ftyp := mp4Box(data, "ftyp"); !bytes.HasPrefix(ftyp, []byte("M4B ")) {
+		t.Errorf("ftyp %q", ftyp)
+	}
+	// the chapters follow each other, the first one lasts until the pause after it is over
+	rate := DefaultSampleRate
+	n := lengths[0] + rate.N(100*time.Millisecond)
+	if mdat := mp4Box(data, "mdat"); len(mdat) != 4*(n+lengths[1]) {
+		t.Errorf("mdat of %d bytes, want %d samples of 4 bytes", len(mdat), n+lengths[1])
+	}
+	chpl := mp4Box(data, "moov", "udta", "chpl")
+	if len(chpl) < 9 || chpl[8] != 2 {
+		t.Fatalf("chapter atom %q, want 2 chapters", chpl)
+	}
+	var starts []time.Duration
+	var names []string
+	for pos := 9; pos+9 <= len(chpl); {
+		starts = append(starts, time.Duration(binary.BigEndian.Uint64(chpl[pos:]))*100)
+		size := int(chpl[pos+8])
+		names = append(names, string(chpl[pos+9:pos+9+size]))
+		pos += 9 + size
+	}
+	if want := []time.Duration{0, rate.D(n) / 100 * 100}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("chapters start at %v, want %v", starts, want)
+	}
+	if want := []string{"01", "02"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("chapters %q, want %q", names, want)
+	}
+}
+
+// mp4Box returns the payload of the box at path.
+func mp4Box(data []byte, path ...string) []byte {
+	for pos := 0; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		if size < 8 || pos+size > len(data) {
+			return nil
+		}
+		if string(data[pos+4:pos+8]) == path[0] {
+			payload := data[pos+8 : pos+size]
+			if len(path) == 1 {
+				return payload
+			}
+			return mp4Box(payload, path[1:]...)
+		}
+		pos += size
+	}
+	return nil
+}
+
+func TestJoinMP3StripsTags(t *testing.T) {
+	dir := t.TempDir()
+	tag := Tags{Title: "你好"}.ID3()
+	frames := [][]byte{[]byte("\xff\xfbframe1"), []byte("\xff\xfbframe2")}
+	var files []string
+	for i, f := range frames {
+		file := filepath.Join(dir, string(rune('a'+i))+".mp3")
+		if err := os.WriteFile(file, append(append([]byte{}, tag...), f...), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	out := filepath.Join(dir, "joined.mp3")
+	if err := JoinMP3(out, files); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(frames, nil); !bytes.Equal(data, want) {
+		t.Errorf("joined %q, want %q", data, want)
+	}
+}
@@ -4,29 +4,46 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"html"
 	"io"
 	"math"
 	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/fbngrm/zh-audio/pkg/segment"
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
 	"golang.org/x/exp/slog"
 )
 
 // speed
 const rate = "0.7"
 
+// rate of the slow, word by word reading
+const slowRate = "0.5"
+
 type AzureClient struct {
-	endpoint    string
-	apiKey      string
-	AudioDir    string
-	ignoreChars []string
+	endpoint string
+	apiKey   string
+	AudioDir string
+	Manifest *Manifest
+	// optional, synthesizes through a cache server instead of calling azure directly
+	Remote *HTTPStore
+	// optional, tags the clips with the text of the query
+	Tags *TagOptions
+	// optional, overrides the reading of words in chinese queries
+	Lexicon *textnorm.Lexicon
+	// optional, url of a custom lexicon file referenced by the queries
+	LexiconURI string
 }
 
-func NewAzureClient(apiKey, endpoint, dir string, ignoreChars []string) (*AzureClient, error) {
+func NewAzureClient(apiKey, endpoint, dir string) (*AzureClient, error) {
 	if err := os.RemoveAll(dir); err != nil {
 		return nil, err
 	}
@@ -35,10 +52,9 @@ func NewAzureClient(apiKey, endpoint, dir string, ignoreChars []string) (*AzureC
 		return nil, err
 	}
 	return &AzureClient{
-		endpoint:    endpoint,
-		apiKey:      apiKey,
-		AudioDir:    dir,
-		ignoreChars: ignoreChars,
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		AudioDir: dir,
 	}, nil
 }
 
@@ -57,18 +73,23 @@ func (c *AzureClient) GetRandomVoice() string {
 }
 
 func (c *AzureClient) GetVoices(speakers map[string]struct{}) map[string]string {
-	v := make(map[string]string)
-	var i int
+	// speakers get their voices in name order, so that a speaker keeps the voice across runs
+	names := make([]string, 0, len(speakers))
 	for speaker := range speakers {
-		v[speaker] = Voices[i]
-		i++
+		names = append(names, speaker)
+	}
+	sort.Strings(names)
+	v := make(map[string]string)
+	for i, speaker := range names {
+		v[speaker] = Voices[i%len(Voices)]
 	}
 	return v
 }
 
 // download audio file from azure text-to-speech api if it doesn't exist in cache dir.
 func (c *AzureClient) Fetch(ctx context.Context, query, filename string) (string, error) {
-	if contains(c.ignoreChars, query) {
+	// queries of punctuation only are not synthesized
+	if !textnorm.Speakable(queryText(query)) {
 		return "", nil
 	}
 	if err := os.MkdirAll(c.AudioDir, os.ModePerm); err != nil {
@@ -76,6 +97,13 @@ func (c *AzureClient) Fetch(ctx context.Context, query, filename string) (string
 	}
 	lessonPath := filepath.Join(c.AudioDir, filename)
 
+	if c.Remote != nil {
+		if err := c.fetchRemote(ctx, query, lessonPath); err != nil {
+			return "", err
+		}
+		return lessonPath, c.tag(query, lessonPath)
+	}
+
 	resp, err := c.fetch(ctx, query, 0)
 	if err != nil {
 		return "", err
@@ -89,18 +117,101 @@ func (c *AzureClient) Fetch(ctx context.Context, query, filename string) (string
 	// 	}
 	// }
 
-	out, err := os.Create(lessonPath)
+	if err := writeAtomic(lessonPath, func(w io.Writer) error {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	c.Manifest.SetSource(lessonPath, "azure", voicesOf(query))
+	slog.Info("audio content generated", "path", lessonPath)
+	return lessonPath, c.tag(query, lessonPath)
+}
+
+var (
+	voiceElemRe = regexp.MustCompile(`(?s)<voice name="([^"]*)">.*?</voice>`)
+	silenceRe   = regexp.MustCompile(`(<mstts:silence\s+type="Tailing-exact" value=")([^"]*)(")`)
+)
+
+// FetchSegments synthesizes every voice of a query on its own and renders the clips into
+// a single file with render, the pauses between them are taken from their tailing
+// silence. Unlike Fetch the result carries the timings of each voice, so that subtitles,
+// tags and the manifest know what is read when.
+func (c *AzureClient) FetchSegments(ctx context.Context, query, filename string, render RenderOptions) (string, error) {
+	tmp, err := os.MkdirTemp("", "zh-audio-segments-*")
 	if err != nil {
 		return "", err
 	}
-	defer out.Close()
+	defer os.RemoveAll(tmp)
+	parts := *c
+	parts.AudioDir, parts.Manifest, parts.Tags = tmp, nil, nil
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
+	concatenator := NewConcatenatorWithOptions(render)
+	for i, m := range voiceElemRe.FindAllStringSubmatch(query, -1) {
+		part, voice := m[0], m[1]
+		var pause int
+		if s := silenceRe.FindStringSubmatch(part); s != nil {
+			// values without a unit like 0.0 are ignored by azure
+			if d, err := time.ParseDuration(s[2]); err == nil {
+				pause = int(d / time.Millisecond)
+			}
+			part = silenceRe.ReplaceAllString(part, "${1}0ms${3}")
+		}
+		path, err := parts.Fetch(ctx, part, fmt.Sprintf("%03d.mp3", i))
+		if err != nil {
+			return "", err
+		}
+		if path == "" {
+			continue
+		}
+		concatenator.AddWithText(path, pause, segmentText(queryText(part), voice))
+	}
+	if len(concatenator.Files) == 0 {
+		return "", nil
+	}
+	outputFile := OutputPath(filepath.Join(c.AudioDir, filename))
+	if err := os.MkdirAll(c.AudioDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := concatenator.Merge(outputFile); err != nil {
 		return "", err
 	}
+	slog.Info("audio content rendered by segment", "path", outputFile, "segments", len(concatenator.Files))
+	return outputFile, nil
+}
 
-	slog.Info("audio content generated", "path", lessonPath)
-	return lessonPath, nil
+// segmentText returns the transcript of a voice, text without han characters read by a
+// chinese voice is pinyin.
+func segmentText(text, voice string) SegmentText {
+	text = strings.Join(strings.Fields(text), " ")
+	switch {
+	case hasHan(text):
+		return SegmentText{Chinese: text}
+	case strings.HasPrefix(voice, "zh-"):
+		return SegmentText{Pinyin: text}
+	default:
+		return SegmentText{English: text}
+	}
+}
+
+func (c *AzureClient) tag(query, path string) error {
+	if c.Tags == nil {
+		return nil
+	}
+	return WriteTags(path, c.Tags.FromQuery(query))
+}
+
+func (c *AzureClient) fetchRemote(ctx context.Context, query, lessonPath string) error {
+	// the server keys the clip by its query, the file name is only the local name
+	if err := writeAtomic(lessonPath, func(w io.Writer) error {
+		return c.Remote.Synthesize(ctx, query, w)
+	}); err != nil {
+		return err
+	}
+	c.Manifest.SetSource(lessonPath, "azure", voicesOf(query))
+	slog.Info("audio content synthesized by cache server", "path", lessonPath)
+	return nil
 }
 
 func (c *AzureClient) fetch(ctx context.Context, query string, retryCount int) (*http.Response, error) {
@@ -169,27 +280,155 @@ func (c *AzureClient) PrepareEnglishQuery(text, pause string) string {
 		    %s
         </prosody>
     </voice>`
-	return fmt.Sprintf(queryFmt, speaker, pause, "1.0", text)
+	return fmt.Sprintf(queryFmt, speaker, pause, "1.0", html.EscapeString(text))
 }
 
 // if text contains whitespaces and addSplitAudio is true, text is added twice, once with all
 // whitespaces stipped off and once with whitespaces. azure api renders whitespaces as pauses in the audio.
+// numbers and latin words of the text are normalized, text without anything to read is dropped.
 func (c *AzureClient) PrepareQuery(text, speaker, pause string, addSplitAudio bool) string {
 	slog.Debug("prepare azure query", "voice", speaker, "text", text)
+	if !textnorm.Speakable(text) {
+		return ""
+	}
+	opts := textnorm.Options{
+		Multilingual: strings.Contains(speaker, "Multilingual"),
+		Lexicon:      c.Lexicon,
+	}
 	queryFmt := `
-    <voice name="%s">
+    <voice name="%s">%s
         <mstts:silence  type="Tailing-exact" value="%s"/>
         <prosody rate="%s">
 		    %s
         </prosody>
     </voice>`
-	query := fmt.Sprintf(queryFmt, speaker, pause, rate, strings.ReplaceAll(text, " ", ""))
+	lexicon := ""
+	if c.LexiconURI != "" {
+		lexicon = fmt.Sprintf(`
+        <lexicon uri="%s"/>`, html.EscapeString(c.LexiconURI))
+	}
+	query := fmt.Sprintf(queryFmt, speaker, lexicon, pause, rate, textnorm.SSML(joinWords(text), opts))
 	if addSplitAudio {
-		query += fmt.Sprintf(queryFmt, speaker, pause, rate, text)
+		query += fmt.Sprintf(queryFmt, speaker, lexicon, pause, rate, textnorm.SSML(text, opts))
 	}
 	return query
 }
 
+// PrepareSlowQuery reads the words of a chinese text one by one, slower than PrepareQuery
+// and with a break between the words.
+func (c *AzureClient) PrepareSlowQuery(words []string, speaker, pause string) string {
+	slog.Debug("prepare azure slow query", "voice", speaker, "words", words)
+	opts := textnorm.Options{
+		Multilingual: strings.Contains(speaker, "Multilingual"),
+		Lexicon:      c.Lexicon,
+	}
+	var ssml []string
+	for _, w := range words {
+		if textnorm.Speakable(w) {
+			ssml = append(ssml, textnorm.SSML(joinWords(w), opts))
+		}
+	}
+	if len(ssml) == 0 {
+		return ""
+	}
+	queryFmt := `
+    <voice name="%s">%s
+        <mstts:silence  type="Tailing-exact" value="%s"/>
+        <prosody rate="%s">
+		    %s
+        </prosody>
+    </voice>`
+	lexicon := ""
+	if c.LexiconURI != "" {
+		lexicon = fmt.Sprintf(`
+        <lexicon uri="%s"/>`, html.EscapeString(c.LexiconURI))
+	}
+	return fmt.Sprintf(queryFmt, speaker, lexicon, pause, slowRate, strings.Join(ssml, `<break time="400ms"/>`))
+}
+
+// PreparePinyinQuery reads pinyin like "nǐ hǎo" by a chinese voice, numbered is the pinyin
+// with tone numbers.
+func (c *AzureClient) PreparePinyinQuery(text, numbered, speaker, pause string) string {
+	slog.Debug("prepare azure pinyin query", "voice", speaker, "text", text)
+	queryFmt := `
+    <voice name="%s">
+        <mstts:silence  type="Tailing-exact" value="%s"/>
+        <prosody rate="%s">
+		    <phoneme alphabet="sapi" ph="%s">%s</phoneme>
+        </prosody>
+    </voice>`
+	return fmt.Sprintf(queryFmt, speaker, pause, rate, textnorm.Sapi(numbered), html.EscapeString(text))
+}
+
+// PrepareMixedQuery reads text of mixed languages like notes: english by the english voice,
+// chinese and pinyin by a chinese voice and numbers by the voice of the text before them.
+// Punctuation between the spans is dropped.
+func (c *AzureClient) PrepareMixedQuery(text, pause string) string {
+	query := ""
+	speaker := ""
+	for _, s := range segment.Split(text) {
+		switch s.Kind {
+		case segment.English:
+			speaker = ""
+			query += c.PrepareEnglishQuery(s.Text, pause)
+		case segment.Chinese:
+			speaker = c.GetRandomVoice()
+			query += c.PrepareQuery(s.Text, speaker, pause, false)
+		case segment.Pinyin:
+			speaker = c.GetRandomVoice()
+			query += c.PreparePinyinQuery(s.Text, s.Pinyin, speaker, pause)
+		case segment.Numeric:
+			if speaker == "" {
+				query += c.PrepareEnglishQuery(s.Text, pause)
+				continue
+			}
+			query += c.PrepareQuery(s.Text, speaker, pause, false)
+		}
+	}
+	return query
+}
+
+// WithOverride returns a copy of the client that reads word by pinyin, e.g. for the
+// pinyin of an input item. The client itself is not changed, so overrides of one item do
+// not leak into others.
+func (c *AzureClient) WithOverride(word, pinyin string) (*AzureClient, error) {
+	lexicon, err := c.Lexicon.With(word, pinyin)
+	if err != nil {
+		return nil, err
+	}
+	o := *c
+	o.Lexicon = lexicon
+	return &o, nil
+}
+
+// joinWords strips the whitespaces between chinese words, spaces between latin words and
+// numbers are kept.
+func joinWords(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i, r := range runes {
+		if r == ' ' && i > 0 && i < len(runes)-1 && isLatin(runes[i-1]) && isLatin(runes[i+1]) {
+			b.WriteRune(r)
+			continue
+		}
+		if r != ' ' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isLatin(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+var markupRe = regexp.MustCompile(`<[^>]*>`)
+
+// queryText returns the text read by a query, without markup.
+func queryText(query string) string {
+	return html.UnescapeString(markupRe.ReplaceAllString(query, ""))
+}
+
 func contains[T comparable](s []T, e T) bool {
 	for _, v := range s {
 		if v == e {
@@ -1,30 +1,343 @@
 package audio
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
+	"golang.org/x/exp/slog"
 )
 
 type Cache struct {
 	AudioCacheDir string
+	Manifest      *Manifest
+	// optional shared backend, entries missing in AudioCacheDir are fetched from it
+	Remote CacheStore
+	// optional, the lexicon the clips are synthesized with
+	Lexicon *textnorm.Lexicon
 }
 
+// GetCachePath returns the path of the clip of a text. Clips of text with words of the
+// lexicon are keyed by their readings as well, a changed reading misses the cache instead
+// of serving the clip synthesized before.
 func (c *Cache) GetCachePath(query string) string {
-	query = strings.ReplaceAll(query, " ", "")
-	filename := ""
-	for _, c := range query {
-		filename += string(c)
-		if len(filename) >= 150 { // possible collisions
-			break
-		}
+	return c.GetVoiceCachePath(query, "")
+}
+
+// GetVoiceCachePath returns the path of the clip of a text read by a given voice, e.g. a
+// line of a dialog whose speakers have voices of their own. Clips of the same text read by
+// other voices are kept apart.
+func (c *Cache) GetVoiceCachePath(query, voice string) string {
+	name := strings.TrimSuffix(GetFilename(query), ".mp3")
+	if key := c.Lexicon.Key(query); key != "" {
+		name += "_" + key
+	}
+	if voice != "" {
+		name += "_" + voice
 	}
-	return path.Join(c.AudioCacheDir, filename) + ".mp3"
+	return path.Join(c.AudioCacheDir, name) + ".mp3"
+}
+
+// WithLexicon returns a copy of the cache keyed by another lexicon, e.g. the one of an
+// AzureClient with overrides.
+func (c *Cache) WithLexicon(lexicon *textnorm.Lexicon) *Cache {
+	o := *c
+	o.Lexicon = lexicon
+	return &o
 }
 
 func (c *Cache) IsInCache(src string) bool {
-	if _, err := os.Stat(src); os.IsNotExist(err) {
+	if _, err := os.Stat(src); os.IsNotExist(err) && !c.fetchRemote(src) {
+		c.Manifest.AddLookup(src, false)
 		return false
 	}
+	c.Manifest.AddLookup(src, true)
 	return true
 }
+
+// fetchRemote copies an entry from the remote backend into the cache dir.
+func (c *Cache) fetchRemote(src string) bool {
+	if c.Remote == nil {
+		return false
+	}
+	store := c.store()
+	key := filepath.Base(src)
+	if err := store.fill(context.Background(), key); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			slog.Error("fetch from remote cache", "key", key, "error", err)
+		}
+		return false
+	}
+	return true
+}
+
+func (c *Cache) store() *ReadThroughStore {
+	return &ReadThroughStore{
+		Local:  &FileStore{Dir: c.AudioCacheDir},
+		Remote: c.Remote,
+	}
+}
+
+// Upload puts the clips synthesized during the run into the cache dir and the remote
+// backend, if configured. Those are the entries the manifest records as missing from the
+// cache, other files in dir like whole items are not cache entries.
+func (c *Cache) Upload(ctx context.Context, dir string) error {
+	if c.Remote == nil {
+		return nil
+	}
+	store := c.store()
+	for _, key := range c.Manifest.Missed() {
+		file := filepath.Join(dir, key)
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			// not synthesized, e.g. a query of punctuation only
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = store.Put(ctx, key, f, -1)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", file, err)
+		}
+		slog.Debug("uploaded to remote cache", "key", key)
+	}
+	return nil
+}
+
+type CacheEntry struct {
+	Key      string
+	Size     int64
+	ModTime  time.Time
+	LastUsed time.Time // last run that referenced the entry or the modification time
+	Provider string
+	Voice    string
+	Pinned   bool
+}
+
+// Entries lists all audio files in the cache dir. Provider, voice and last usage are taken
+// from the manifests of previous runs. Keys of entries that must never be evicted are
+// given as texts, the same way they are passed to GetCachePath.
+func (c *Cache) Entries(manifests []*Manifest, pinned []string) ([]*CacheEntry, error) {
+	pins := make(map[string]bool)
+	for _, p := range pinned {
+		pins[filepath.Base(c.GetCachePath(p))] = true
+	}
+	files, err := os.ReadDir(c.AudioCacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache dir: %w", err)
+	}
+	var entries []*CacheEntry
+	index := make(map[string]*CacheEntry)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".mp3") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		e := &CacheEntry{
+			Key:      file.Name(),
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			LastUsed: info.ModTime(),
+			Provider: "unknown",
+			Voice:    "unknown",
+			Pinned:   pins[file.Name()],
+		}
+		entries = append(entries, e)
+		index[e.Key] = e
+	}
+	// manifests are sorted oldest first, so later runs win
+	for _, m := range manifests {
+		for _, me := range m.Entries {
+			e, ok := index[me.Key]
+			if !ok {
+				continue
+			}
+			if m.Created.After(e.LastUsed) {
+				e.LastUsed = m.Created
+			}
+			if me.Provider != "" {
+				e.Provider = me.Provider
+			}
+			if me.Voice != "" {
+				e.Voice = me.Voice
+			}
+		}
+	}
+	return entries, nil
+}
+
+type CacheStats struct {
+	Entries    int
+	Size       int64
+	ByVoice    map[string]int
+	ByProvider map[string]int
+	Runs       int // number of recent runs the hit rate is based on
+	Hits       int
+	Misses     int
+}
+
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Stats summarizes the cache entries and the hit rate of the given number of most recent runs.
+func (c *Cache) Stats(recentRuns int) (CacheStats, error) {
+	manifests, err := LoadManifests(c.AudioCacheDir)
+	if err != nil {
+		return CacheStats{}, err
+	}
+	entries, err := c.Entries(manifests, nil)
+	if err != nil {
+		return CacheStats{}, err
+	}
+	stats := CacheStats{
+		ByVoice:    make(map[string]int),
+		ByProvider: make(map[string]int),
+	}
+	for _, e := range entries {
+		stats.Entries++
+		stats.Size += e.Size
+		stats.ByVoice[e.Voice]++
+		stats.ByProvider[e.Provider]++
+	}
+	if len(manifests) > recentRuns {
+		manifests = manifests[len(manifests)-recentRuns:]
+	}
+	for _, m := range manifests {
+		stats.Runs++
+		for _, e := range m.Entries {
+			stats.Hits += e.Hits
+			stats.Misses += e.Misses
+		}
+	}
+	return stats, nil
+}
+
+type EvictionPolicy string
+
+const (
+	EvictLRU EvictionPolicy = "lru"
+	EvictAge EvictionPolicy = "age"
+)
+
+type GCOptions struct {
+	Policy  EvictionPolicy
+	MaxSize int64         // evict until the cache is smaller, 0 means no size cap
+	MaxAge  time.Duration // evict entries older than this, 0 means no age limit
+	Pinned  []string
+	DryRun  bool
+}
+
+// GC evicts cache entries until the cache satisfies the size cap and age limit. With the
+// lru policy, entries are ordered by last usage, with the age policy by modification time.
+// Pinned entries are never evicted.
+func (c *Cache) GC(opts GCOptions) ([]*CacheEntry, error) {
+	manifests, err := LoadManifests(c.AudioCacheDir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.Entries(manifests, opts.Pinned)
+	if err != nil {
+		return nil, err
+	}
+	age := func(e *CacheEntry) time.Time {
+		if opts.Policy == EvictAge {
+			return e.ModTime
+		}
+		return e.LastUsed
+	}
+	switch opts.Policy {
+	case EvictLRU, EvictAge:
+	default:
+		return nil, fmt.Errorf("unknown eviction policy: %s", opts.Policy)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return age(entries[i]).Before(age(entries[j]))
+	})
+
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	var evicted []*CacheEntry
+	for _, e := range entries {
+		if e.Pinned {
+			continue
+		}
+		tooOld := opts.MaxAge != 0 && time.Since(age(e)) > opts.MaxAge
+		tooBig := opts.MaxSize != 0 && size > opts.MaxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+		if err := c.remove(e, opts.DryRun); err != nil {
+			return evicted, err
+		}
+		size -= e.Size
+		evicted = append(evicted, e)
+	}
+	return evicted, nil
+}
+
+type PruneOptions struct {
+	Pinned []string
+	DryRun bool
+	// prune even if no manifest references any entry, which removes all unpinned entries
+	Force bool
+}
+
+// PruneOrphans deletes all unpinned entries that are not referenced by any manifest.
+// Without manifests referencing entries, every entry would be an orphan, e.g. in a cache
+// shared with machines that keep their manifests, so it refuses to prune unless forced.
+func (c *Cache) PruneOrphans(opts PruneOptions) ([]*CacheEntry, error) {
+	manifests, err := LoadManifests(c.AudioCacheDir)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, m := range manifests {
+		for _, e := range m.Entries {
+			referenced[e.Key] = true
+		}
+	}
+	entries, err := c.Entries(manifests, opts.Pinned)
+	if err != nil {
+		return nil, err
+	}
+	if len(referenced) == 0 && !opts.Force {
+		return nil, fmt.Errorf("no manifest in %s references a cache entry, all %d entries would be pruned, force to prune anyway",
+			filepath.Join(c.AudioCacheDir, manifestDir), len(entries))
+	}
+	var pruned []*CacheEntry
+	for _, e := range entries {
+		if e.Pinned || referenced[e.Key] {
+			continue
+		}
+		if err := c.remove(e, opts.DryRun); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, e)
+	}
+	return pruned, nil
+}
+
+func (c *Cache) remove(e *CacheEntry, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+	return os.Remove(filepath.Join(c.AudioCacheDir, e.Key))
+}
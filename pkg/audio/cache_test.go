@@ -0,0 +1,256 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
+)
+
+func TestCachePathKeyedByLexicon(t *testing.T) {
+	lexicon := textnorm.NewLexicon()
+	if err := lexicon.Add("银行", "yin2 hang2"); err != nil {
+		t.Fatal(err)
+	}
+	plain := &Cache{AudioCacheDir: "cache"}
+	cache := &Cache{AudioCacheDir: "cache", Lexicon: lexicon}
+
+	if got := cache.GetCachePath("你 好"); got != "cache/你好.mp3" {
+		t.Errorf("text without lexicon words keyed as %s", got)
+	}
+	keyed := cache.GetCachePath("去银行")
+	if keyed == plain.GetCachePath("去银行") || !strings.HasPrefix(filepath.Base(keyed), "去银行_") {
+		t.Errorf("text with lexicon words keyed as %s", keyed)
+	}
+	// a reading overridden for an item misses the clip of the lexicon reading
+	client := &AzureClient{Lexicon: lexicon}
+	override, err := client.WithOverride("银行", "yin2 xing2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cache.WithLexicon(override.Lexicon).GetCachePath("去银行"); got == keyed {
+		t.Errorf("overridden reading served from %s", got)
+	}
+	if client.Lexicon != lexicon || cache.Lexicon != lexicon {
+		t.Error("override changed the shared client or cache")
+	}
+	if p, _ := lexicon.Lookup("银行"); p != "yin2 hang2" {
+		t.Errorf("override changed the lexicon: %s", p)
+	}
+	long := strings.Repeat("银行", 40)
+	if got := filepath.Base(cache.GetCachePath(long)); !strings.Contains(got, "_") {
+		t.Errorf("key of a long text lost its lexicon hash: %s", got)
+	}
+}
+
+// newTestCache writes entries of 100 bytes modified the given time ago.
+func newTestCache(t *testing.T, now time.Time, entries map[string]time.Duration) *Cache {
+	t.Helper()
+	c := &Cache{AudioCacheDir: t.TempDir()}
+	for key, age := range entries {
+		file := filepath.Join(c.AudioCacheDir, key)
+		if err := os.WriteFile(file, make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// saveManifest records a run created the given time ago that used the entries.
+func saveManifest(t *testing.T, c *Cache, now time.Time, age time.Duration, mode string, keys ...string) *Manifest {
+	t.Helper()
+	m := NewManifest(mode)
+	m.Created = now.Add(-age)
+	for _, key := range keys {
+		m.AddLookup(key, true)
+	}
+	if _, err := m.Save(c.AudioCacheDir); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func keys(entries []*CacheEntry) []string {
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+func cacheFiles(t *testing.T, c *Cache) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(c.AudioCacheDir, "*.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	return names
+}
+
+func TestGC(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		name    string
+		opts    GCOptions
+		evicted []string
+	}{
+		{"no limits", GCOptions{Policy: EvictLRU}, nil},
+		// least recently used first, old.mp3 was used by the last run
+		{"lru size", GCOptions{Policy: EvictLRU, MaxSize: 250}, []string{"mid.mp3", "new.mp3"}},
+		{"age size", GCOptions{Policy: EvictAge, MaxSize: 250}, []string{"old.mp3", "mid.mp3"}},
+		{"lru max age", GCOptions{Policy: EvictLRU, MaxAge: 5 * day}, []string{"mid.mp3"}},
+		{"age max age", GCOptions{Policy: EvictAge, MaxAge: 5 * day}, []string{"old.mp3", "mid.mp3"}},
+		{"size fits", GCOptions{Policy: EvictLRU, MaxSize: 400}, nil},
+		{"dry run", GCOptions{Policy: EvictLRU, MaxSize: 250, DryRun: true}, []string{"mid.mp3", "new.mp3"}},
+		{"pins only", GCOptions{Policy: EvictLRU, MaxSize: 1, Pinned: []string{"pin", "mid", "new", "old"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			c := newTestCache(t, now, map[string]time.Duration{
+				"pin.mp3": 40 * day,
+				"old.mp3": 30 * day,
+				"mid.mp3": 10 * day,
+				"new.mp3": 1 * day,
+			})
+			saveManifest(t, c, now, time.Hour, "words", "old.mp3")
+			if tt.opts.Pinned == nil {
+				tt.opts.Pinned = []string{"pin"}
+			}
+			evicted, err := c.GC(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keys(evicted); !reflect.DeepEqual(got, tt.evicted) {
+				t.Errorf("evicted %v, want %v", got, tt.evicted)
+			}
+			left := cacheFiles(t, c)
+			if want := 4 - len(tt.evicted); tt.opts.DryRun {
+				if len(left) != 4 {
+					t.Errorf("dry run removed entries, left %v", left)
+				}
+			} else if len(left) != want {
+				t.Errorf("left %v, want %d entries", left, want)
+			}
+			for _, key := range left {
+				if key == "pin.mp3" {
+					return
+				}
+			}
+			t.Error("pinned entry evicted")
+		})
+	}
+	c := newTestCache(t, time.Now(), nil)
+	if _, err := c.GC(GCOptions{Policy: "fifo"}); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+func TestPruneOrphans(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests [][]string // keys used by each run
+		opts      PruneOptions
+		pruned    []string
+		refused   bool
+	}{
+		{"no manifests", nil, PruneOptions{}, nil, true},
+		{"manifests without entries", [][]string{{}}, PruneOptions{}, nil, true},
+		{"forced", nil, PruneOptions{Force: true}, []string{"a.mp3", "b.mp3"}, false},
+		{"referenced", [][]string{{"a.mp3"}, {"missing.mp3"}}, PruneOptions{}, []string{"b.mp3"}, false},
+		{"dry run", [][]string{{"a.mp3"}}, PruneOptions{DryRun: true}, []string{"b.mp3"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			c := newTestCache(t, now, map[string]time.Duration{"a.mp3": 0, "b.mp3": 0, "pin.mp3": 0})
+			for i, run := range tt.manifests {
+				saveManifest(t, c, now, time.Duration(i)*time.Hour, "words", run...)
+			}
+			tt.opts.Pinned = []string{"pin"}
+			pruned, err := c.PruneOrphans(tt.opts)
+			if tt.refused {
+				if err == nil {
+					t.Fatalf("pruned %v without manifests", keys(pruned))
+				}
+				if left := cacheFiles(t, c); len(left) != 3 {
+					t.Errorf("refused prune removed entries, left %v", left)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keys(pruned); !reflect.DeepEqual(got, tt.pruned) {
+				t.Errorf("pruned %v, want %v", got, tt.pruned)
+			}
+			want := 3 - len(tt.pruned)
+			if tt.opts.DryRun {
+				want = 3
+			}
+			if left := cacheFiles(t, c); len(left) != want {
+				t.Errorf("left %v, want %d entries", left, want)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	now := time.Now()
+	c := newTestCache(t, now, map[string]time.Duration{"a.mp3": time.Hour, "b.mp3": time.Hour, "c.mp3": time.Hour})
+	old := saveManifest(t, c, now, 2*time.Hour, "words")
+	old.AddLookup("a.mp3", false)
+	old.SetSource("a.mp3", "azure", "zh-CN-XiaoxiaoNeural")
+	if _, err := old.Save(c.AudioCacheDir); err != nil {
+		t.Fatal(err)
+	}
+	recent := saveManifest(t, c, now, time.Minute, "clozes", "a.mp3", "b.mp3")
+	recent.AddLookup("c.mp3", false)
+	recent.SetSource("c.mp3", "azure", "zh-CN-YunjianNeural")
+	if _, err := recent.Save(c.AudioCacheDir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		runs                int
+		hits, misses, count int
+	}{
+		{1, 2, 1, 1},
+		{2, 2, 2, 2},
+		{10, 2, 2, 2},
+	}
+	for _, tt := range tests {
+		stats, err := c.Stats(tt.runs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Entries != 3 || stats.Size != 300 {
+			t.Errorf("%d entries of %d bytes, want 3 of 300", stats.Entries, stats.Size)
+		}
+		if stats.Runs != tt.count || stats.Hits != tt.hits || stats.Misses != tt.misses {
+			t.Errorf("runs %d: %d runs, %d hits, %d misses, want %d, %d, %d",
+				tt.runs, stats.Runs, stats.Hits, stats.Misses, tt.count, tt.hits, tt.misses)
+		}
+		want := map[string]int{"zh-CN-XiaoxiaoNeural": 1, "zh-CN-YunjianNeural": 1, "unknown": 1}
+		if !reflect.DeepEqual(stats.ByVoice, want) {
+			t.Errorf("by voice %v, want %v", stats.ByVoice, want)
+		}
+		if want := map[string]int{"azure": 2, "unknown": 1}; !reflect.DeepEqual(stats.ByProvider, want) {
+			t.Errorf("by provider %v, want %v", stats.ByProvider, want)
+		}
+	}
+	if got := (CacheStats{Hits: 3, Misses: 1}).HitRate(); got != 0.75 {
+		t.Errorf("hit rate %v, want 0.75", got)
+	}
+}
@@ -0,0 +1,375 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// CacheServer exposes a cache store over HTTP:
+//
+//	GET    /v1/clips/{key}       download a clip, supports If-None-Match
+//	HEAD   /v1/clips/{key}       check for existence
+//	PUT    /v1/clips/{key}       upload a clip, If-None-Match: * prevents overwrites
+//	GET    /v1/clips?prefix=     list clips as json
+//	POST   /v1/synthesize        synthesize the ssml body with azure if its clip is missing
+//
+// Keys are file names, keys with path separators or a leading dot are rejected. Clips
+// synthesized by the server are keyed by the hash of their query, see SynthesisKey.
+type CacheServer struct {
+	Store  CacheStore
+	Tokens []string // accepted bearer tokens, no auth if empty, for local use only
+	// optional, used to synthesize missing clips
+	Azure *AzureClient
+
+	mu    sync.Mutex
+	etags map[string]etag
+}
+
+// limits of request bodies, ssml queries are a few kilobytes and clips a few megabytes
+const (
+	maxQuerySize = 1 << 20
+	maxClipSize  = 64 << 20
+)
+
+type etag struct {
+	size    int64
+	modTime time.Time
+	value   string
+}
+
+func (s *CacheServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/clips/{key}", s.get)
+	mux.HandleFunc("HEAD /v1/clips/{key}", s.get)
+	mux.HandleFunc("PUT /v1/clips/{key}", s.put)
+	mux.HandleFunc("GET /v1/clips", s.list)
+	mux.HandleFunc("POST /v1/synthesize", s.synthesize)
+	return s.auth(mux)
+}
+
+// validKey reports whether key is a plain file name, so that stores and the synthesizer
+// never write outside of their directory.
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, ".") && !strings.ContainsAny(key, `/\`)
+}
+
+// SynthesisKey returns the key of the clip synthesized by the server for an ssml query.
+// The query holds the voice, rate and pronunciations, a changed query is synthesized again.
+func SynthesisKey(query string) string {
+	return sha256Hex([]byte(query)) + ".mp3"
+}
+
+func (s *CacheServer) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.Tokens) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for _, t := range s.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// etag returns the content hash of an entry, memoized as long as the entry doesn't change.
+func (s *CacheServer) etag(ctx context.Context, e StoreEntry) (string, error) {
+	if e.ETag != "" {
+		return e.ETag, nil
+	}
+	s.mu.Lock()
+	cached, ok := s.etags[e.Key]
+	s.mu.Unlock()
+	if ok && cached.size == e.Size && cached.modTime.Equal(e.ModTime) {
+		return cached.value, nil
+	}
+	h := sha256.New()
+	if err := s.Store.Get(ctx, e.Key, h); err != nil {
+		return "", err
+	}
+	value := hex.EncodeToString(h.Sum(nil))
+	s.mu.Lock()
+	if s.etags == nil {
+		s.etags = make(map[string]etag)
+	}
+	s.etags[e.Key] = etag{size: e.Size, modTime: e.ModTime, value: value}
+	s.mu.Unlock()
+	return value, nil
+}
+
+func (s *CacheServer) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !validKey(key) {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	s.serve(w, r, key)
+}
+
+func (s *CacheServer) serve(w http.ResponseWriter, r *http.Request, key string) {
+	e, err := s.Store.Stat(r.Context(), key)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	tag, err := s.etag(r.Context(), e)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(tag))
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Content-Length", strconv.FormatInt(e.Size, 10))
+	w.Header().Set("Last-Modified", e.ModTime.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := s.Store.Get(r.Context(), key, w); err != nil {
+		slog.Error("serve clip", "key", key, "error", err)
+	}
+}
+
+func (s *CacheServer) put(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !validKey(key) {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" {
+		if _, err := s.Store.Stat(r.Context(), key); err == nil {
+			http.Error(w, "clip exists", http.StatusPreconditionFailed)
+			return
+		}
+	}
+	if r.ContentLength > maxClipSize {
+		http.Error(w, "clip too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := s.Store.Put(r.Context(), key, http.MaxBytesReader(w, r.Body, maxClipSize), r.ContentLength); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	slog.Info("clip uploaded", "key", key, "remote", r.RemoteAddr)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *CacheServer) list(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.Store.List(r.Context(), r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *CacheServer) synthesize(w http.ResponseWriter, r *http.Request) {
+	query, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQuerySize))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	key := SynthesisKey(string(query))
+	if _, err := s.Store.Stat(r.Context(), key); errors.Is(err, ErrNotFound) {
+		if s.Azure == nil {
+			http.Error(w, "synthesis not available", http.StatusNotImplemented)
+			return
+		}
+		path, err := s.Azure.Fetch(r.Context(), string(query), key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		err = s.Store.Put(r.Context(), key, f, -1)
+		f.Close()
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		slog.Info("clip synthesized", "key", key, "remote", r.RemoteAddr)
+	} else if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.serve(w, r, key)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func etagMatches(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || strings.Trim(t, `"`) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var errExists = errors.New("clip exists")
+
+// HTTPStore is the client of a CacheServer.
+type HTTPStore struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+func NewHTTPStore(baseURL, token string) *HTTPStore {
+	return &HTTPStore{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		Client:  &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		resp.Body.Close()
+		return nil, errExists
+	case resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotModified:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("cache server %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+func clipPath(key string) string {
+	return "/v1/clips/" + uriEncode(key, true)
+}
+
+func (s *HTTPStore) Get(ctx context.Context, key string, w io.Writer) error {
+	resp, err := s.do(ctx, http.MethodGet, clipPath(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// GetIfChanged downloads a clip only if its etag differs from the given one. The
+// returned bool is false if the clip is unchanged.
+func (s *HTTPStore) GetIfChanged(ctx context.Context, key, etag string, w io.Writer) (bool, error) {
+	header := http.Header{"If-None-Match": {strconv.Quote(etag)}}
+	resp, err := s.do(ctx, http.MethodGet, clipPath(key), nil, header)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	_, err = io.Copy(w, resp.Body)
+	return true, err
+}
+
+// Put never overwrites existing clips, the same key always holds the same text.
+func (s *HTTPStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	header := http.Header{"If-None-Match": {"*"}}
+	resp, err := s.do(ctx, http.MethodPut, clipPath(key), r, header)
+	if errors.Is(err, errExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *HTTPStore) Stat(ctx context.Context, key string) (StoreEntry, error) {
+	resp, err := s.do(ctx, http.MethodHead, clipPath(key), nil, nil)
+	if err != nil {
+		return StoreEntry{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return StoreEntry{
+		Key:     key,
+		Size:    resp.ContentLength,
+		ModTime: modTime,
+		ETag:    strings.Trim(resp.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+func (s *HTTPStore) List(ctx context.Context, prefix string) ([]StoreEntry, error) {
+	resp, err := s.do(ctx, http.MethodGet, "/v1/clips?prefix="+uriEncode(prefix, true), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var entries []StoreEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode clip listing: %w", err)
+	}
+	return entries, nil
+}
+
+// Synthesize asks the server to render the ssml query if it has no clip of it yet.
+func (s *HTTPStore) Synthesize(ctx context.Context, query string, w io.Writer) error {
+	resp, err := s.do(ctx, http.MethodPost, "/v1/synthesize", strings.NewReader(query), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
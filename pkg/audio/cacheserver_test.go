@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCacheServer(t *testing.T, tokens ...string) (*CacheServer, *httptest.Server) {
+	server := &CacheServer{Store: &FileStore{Dir: t.TempDir()}, Tokens: tokens}
+	srv := httptest.NewServer(server.Handler())
+	t.Cleanup(srv.Close)
+	return server, srv
+}
+
+func TestCacheServerRejectsInvalidKeys(t *testing.T) {
+	_, srv := newTestCacheServer(t)
+	outside := filepath.Join(t.TempDir(), "evil.mp3")
+	for _, key := range []string{
+		"..%2Fevil.mp3",
+		"%2E%2E",
+		".put-1",
+		"a%5Cb.mp3",
+		strings.ReplaceAll(outside, "/", "%2F"),
+	} {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/v1/clips/"+key, strings.NewReader("x"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			t.Errorf("put %s: %s", key, resp.Status)
+		}
+	}
+	if _, err := os.Stat(outside); err == nil {
+		t.Errorf("clip written outside of the store: %s", outside)
+	}
+}
+
+func TestCacheServerAuth(t *testing.T) {
+	_, srv := newTestCacheServer(t, "secret")
+	ctx := context.Background()
+	if err := NewHTTPStore(srv.URL, "wrong").Put(ctx, "x.mp3", strings.NewReader("x"), -1); err == nil {
+		t.Error("put with a wrong token succeeded")
+	}
+	store := NewHTTPStore(srv.URL, "secret")
+	if err := store.Put(ctx, "x.mp3", strings.NewReader("x"), -1); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := store.Get(ctx, "x.mp3", &buf); err != nil || buf.String() != "x" {
+		t.Errorf("get: %q, %v", buf.String(), err)
+	}
+	if _, err := store.Stat(ctx, "missing.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("stat of a missing key: %v", err)
+	}
+}
+
+func TestCacheServerSynthesizesByQuery(t *testing.T) {
+	var requests int
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.Copy(w, r.Body)
+	}))
+	defer azure.Close()
+	client, err := NewAzureClient("key", azure.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, srv := newTestCacheServer(t)
+	server.Azure = client
+	store := NewHTTPStore(srv.URL, "")
+	ctx := context.Background()
+
+	synthesize := func(query string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := store.Synthesize(ctx, query, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	xiaoxiao := `<voice name="zh-CN-XiaoxiaoNeural">行</voice>`
+	yunjian := `<voice name="zh-CN-YunjianNeural">行</voice>`
+	if got := synthesize(xiaoxiao); !strings.Contains(got, "Xiaoxiao") {
+		t.Errorf("synthesized %q", got)
+	}
+	// the same text with another voice is not served from the first clip
+	if got := synthesize(yunjian); !strings.Contains(got, "Yunjian") {
+		t.Errorf("synthesized %q", got)
+	}
+	synthesize(xiaoxiao)
+	if requests != 2 {
+		t.Errorf("azure was called %d times, want 2", requests)
+	}
+	if _, err := store.Stat(ctx, SynthesisKey(xiaoxiao)); err != nil {
+		t.Errorf("clip not stored under the key of its query: %v", err)
+	}
+}
+
+func TestCacheServerLimitsBodies(t *testing.T) {
+	var requests int
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer azure.Close()
+	client, err := NewAzureClient("key", azure.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, srv := newTestCacheServer(t)
+	server.Azure = client
+
+	tests := []struct {
+		method, path string
+		size         int
+	}{
+		{http.MethodPost, "/v1/synthesize", maxQuerySize + 1},
+		{http.MethodPut, "/v1/clips/x.mp3", maxClipSize + 1},
+	}
+	for _, tt := range tests {
+		// the body is streamed, the server does not know its size up front
+		body := io.MultiReader(strings.NewReader("<voice>"), io.LimitReader(zeros{}, int64(tt.size)))
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, body)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s %s: %s, want %d", tt.method, tt.path, resp.Status, http.StatusRequestEntityTooLarge)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("azure was called %d times for an oversized query", requests)
+	}
+	if _, err := server.Store.Stat(context.Background(), "x.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("oversized clip stored: %v", err)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestFetchRemoteLeavesNoPartialClip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+	client, err := NewAzureClient("key", srv.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Remote = NewHTTPStore(srv.URL, "")
+	if _, err := client.Fetch(context.Background(), `<voice name="zh-CN-XiaoxiaoNeural">你好</voice>`, "你好.mp3"); err == nil {
+		t.Fatal("fetch of a broken download succeeded")
+	}
+	entries, err := os.ReadDir(client.AudioDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("broken download left %s", e.Name())
+	}
+}
@@ -2,6 +2,7 @@ package audio
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -11,78 +12,318 @@ import (
 	"github.com/faiface/beep/wav"
 )
 
+// RenderOptions control how each file is processed before concatenation.
+type RenderOptions struct {
+	// optional, removes leading and trailing silence so pauses last as long as requested
+	Trim *TrimOptions
+	// optional, normalizes the loudness of each file
+	Profile *LoudnessProfile
+	// silence in ms appended to the end of each item, before the beep
+	Pad int
+	// optional, audio file or cue reference like cue:end played at the end of each item
+	Beep string
+	// play cues marking the start of an item, the switch to english and response gaps
+	Cues bool
+	// sample rate of the output, taken from the first file if not set
+	SampleRate beep.SampleRate
+	// write .lrc and .vtt subtitles next to the output
+	Subtitles bool
+	// optional, romanizes chinese segment texts without pinyin for the subtitles
+	Pinyin func(chinese string) string
+	// optional, tags the output with the transcript
+	Tags *TagOptions
+	// optional, records the output and its timeline
+	Manifest *Manifest
+}
+
 type Concatenator struct {
+	RenderOptions
 	Files  []string
 	Pauses []int
+	Texts  []SegmentText
+	// offsets of all files in the output of the last merge
+	Timeline []Segment
+}
+
+// SegmentText is the transcript of a file added to the concatenator.
+type SegmentText struct {
+	Chinese string `json:"chinese,omitempty"`
+	Pinyin  string `json:"pinyin,omitempty"`
+	English string `json:"english,omitempty"`
+}
+
+func (t SegmentText) IsEmpty() bool {
+	return t.Chinese == "" && t.Pinyin == "" && t.English == ""
+}
+
+type Segment struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"` // excluding the pause after the file
+	File  string        `json:"file"`
+	SegmentText
 }
 
 func NewConcatenator() *Concatenator {
 	return &Concatenator{
 		Files:  make([]string, 0),
 		Pauses: make([]int, 0),
+		Texts:  make([]SegmentText, 0),
 	}
 }
 
+func NewConcatenatorWithOptions(opts RenderOptions) *Concatenator {
+	c := NewConcatenator()
+	c.RenderOptions = opts
+	return c
+}
+
 func (c *Concatenator) AddWithPause(file string, pause int) {
+	c.AddWithText(file, pause, SegmentText{})
+}
+
+// AddWithText appends a file with its transcript, used for subtitles.
+func (c *Concatenator) AddWithText(file string, pause int, text SegmentText) {
 	c.Files = append(c.Files, file)
 	c.Pauses = append(c.Pauses, pause)
+	c.Texts = append(c.Texts, text)
+}
+
+// Reset removes all files so the concatenator can be reused for the next item.
+func (c *Concatenator) Reset() {
+	c.Files = c.Files[:0]
+	c.Pauses = c.Pauses[:0]
+	c.Texts = c.Texts[:0]
+}
+
+// AddCue appends a synthesized cue by name, if cues are enabled.
+func (c *Concatenator) AddCue(name string, pause int) {
+	if !c.Cues {
+		return
+	}
+	c.AddWithPause(CueRef(name), pause)
+}
+
+// AddSilence appends a pause without any audio before it.
+func (c *Concatenator) AddSilence(pause int) {
+	c.AddWithPause("", pause)
 }
 
+// Merge renders all files into outputFile. Its extension is replaced by the one of the
+// output format, see OutputPath.
 func (c *Concatenator) Merge(outputFile string) error {
+	outputFile = OutputPath(outputFile)
+	samples, format, err := c.Render()
+	if err != nil {
+		return err
+	}
+	if err := encode(outputFile, samples, format); err != nil {
+		return err
+	}
+
+	if c.Tags != nil {
+		if err := WriteTags(outputFile, c.Tags.FromTimeline(c.Timeline)); err != nil {
+			return err
+		}
+	}
+	c.Manifest.AddOutput(outputFile, c.Timeline)
+	if c.Subtitles {
+		return WriteSubtitles(outputFile, c.Timeline)
+	}
+	return nil
+}
+
+// Render processes and concatenates all files in memory and records the timeline.
+func (c *Concatenator) Render() ([][2]float64, beep.Format, error) {
 	if len(c.Files) == 0 {
-		return fmt.Errorf("no input files provided")
+		return nil, beep.Format{}, fmt.Errorf("no input files provided")
 	}
 
 	if len(c.Pauses) != len(c.Files) {
-		return fmt.Errorf("the number of pauses must match the number of files")
+		return nil, beep.Format{}, fmt.Errorf("the number of pauses must match the number of files")
+	}
+	// files added by appending to the exported fields have no transcript
+	for len(c.Texts) < len(c.Files) {
+		c.Texts = append(c.Texts, SegmentText{})
 	}
 
-	var streams []beep.Streamer
-	var format beep.Format
+	files, pauses := c.Files, c.Pauses
+	if c.Pad > 0 {
+		files = append(files[:len(files):len(files)], "")
+		pauses = append(pauses[:len(pauses):len(pauses)], c.Pad)
+	}
+	if c.Beep != "" {
+		files = append(files[:len(files):len(files)], c.Beep)
+		pauses = append(pauses[:len(pauses):len(pauses)], 0)
+	}
 
-	// Loop through each file and append to the streams slice
-	for i, file := range c.Files {
-		f, err := os.Open(file)
-		if err != nil {
-			return fmt.Errorf("failed to open file %s: %v", file, err)
+	// Decode all files first, the sample rate of the output is taken from the options or
+	// the first file. Empty files are pure silence, see AddSilence, cues are synthesized
+	// once the sample rate is known.
+	decoded := make([][][2]float64, len(files))
+	rates := make([]beep.SampleRate, len(files))
+	format := beep.Format{SampleRate: c.SampleRate, NumChannels: 2, Precision: 2}
+	for i, file := range files {
+		if file == "" || IsCue(file) {
+			continue
 		}
-		defer f.Close()
-
-		stream, fFormat, err := mp3.Decode(f)
+		samples, fFormat, err := decodeFile(file)
 		if err != nil {
-			return fmt.Errorf("failed to decode file %s: %v", file, err)
+			return nil, beep.Format{}, err
 		}
-
-		// Set format once from the first file
-		if i == 0 {
+		decoded[i], rates[i] = samples, fFormat.SampleRate
+		if format.SampleRate == 0 {
 			format = fFormat
 		}
+	}
+	if format.SampleRate == 0 {
+		format.SampleRate = DefaultSampleRate
+	}
 
-		streams = append(streams, stream)
+	clips := make([][][2]float64, len(files))
+	for i, file := range files {
+		var samples [][2]float64
+		switch {
+		case file == "":
+			continue
+		case IsCue(file):
+			cue, err := GenerateCue(file, format.SampleRate)
+			if err != nil {
+				return nil, beep.Format{}, err
+			}
+			samples = cue
+		default:
+			samples = decoded[i]
+			if rates[i] != format.SampleRate {
+				samples = resample(samples, rates[i], format.SampleRate)
+			}
+			// the beep keeps its silence, it is part of the cue
+			if c.Trim != nil && i < len(c.Files) {
+				samples = c.Trim.Trim(samples, format.SampleRate)
+			}
+		}
+		if c.Profile != nil {
+			samples = c.Profile.Normalize(samples, format.SampleRate)
+		}
+		clips[i] = samples
+	}
 
-		// Add pause after each file
-		if i < len(c.Pauses) {
-			pauseDuration := time.Duration(c.Pauses[i]) * time.Millisecond
-			silence := beep.Silence(format.SampleRate.N(pauseDuration))
-			streams = append(streams, silence)
+	// Add pause after each file and keep track of the offsets
+	var samples [][2]float64
+	c.Timeline = c.Timeline[:0]
+	for i, clip := range clips {
+		segment := Segment{
+			Start: format.SampleRate.D(len(samples)),
+			File:  files[i],
+		}
+		samples = append(samples, clip...)
+		segment.End = format.SampleRate.D(len(samples))
+		if i < len(c.Texts) {
+			segment.SegmentText = c.Texts[i]
+		}
+		if segment.Chinese != "" && segment.Pinyin == "" && c.Pinyin != nil {
+			segment.Pinyin = c.Pinyin(segment.Chinese)
 		}
+		c.Timeline = append(c.Timeline, segment)
+		pauseDuration := time.Duration(pauses[i]) * time.Millisecond
+		samples = append(samples, make([][2]float64, format.SampleRate.N(pauseDuration))...)
 	}
 
-	// Concatenate all streams
-	finalStream := beep.Seq(streams...)
+	return samples, format, nil
+}
 
-	// Create the output file
+// encodeWAV writes the samples as 16 bit wav.
+func encodeWAV(outputFile string, samples [][2]float64, format beep.Format) error {
 	out, err := os.Create(outputFile)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %v", err)
 	}
-	defer out.Close()
-
-	// Encode the final stream into WAV format
-	err = wav.Encode(out, finalStream, format)
+	err = wav.Encode(out, &sampleStreamer{samples: samples}, format)
+	out.Close()
 	if err != nil {
 		return fmt.Errorf("failed to encode output file: %v", err)
 	}
+	return nil
+}
+
+// decodeFile reads all samples of an mp3 or wav file.
+func decodeFile(file string) ([][2]float64, beep.Format, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to open file %s: %v", file, err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to read file %s: %v", file, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, beep.Format{}, err
+	}
+	var stream beep.StreamSeekCloser
+	var format beep.Format
+	if string(magic) == "RIFF" {
+		stream, format, err = wav.Decode(f)
+	} else {
+		stream, format, err = mp3.Decode(f)
+	}
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to decode file %s: %v", file, err)
+	}
+	defer stream.Close()
 
+	samples := make([][2]float64, 0, stream.Len())
+	buf := make([][2]float64, 512)
+	for {
+		n, ok := stream.Stream(buf)
+		samples = append(samples, buf[:n]...)
+		if !ok {
+			break
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to decode file %s: %v", file, err)
+	}
+	return samples, format, nil
+}
+
+func resample(samples [][2]float64, old, new beep.SampleRate) [][2]float64 {
+	r := beep.Resample(4, old, new, &sampleStreamer{samples: samples})
+	out := make([][2]float64, 0, int(float64(len(samples))*float64(new)/float64(old))+1)
+	buf := make([][2]float64, 512)
+	for {
+		n, ok := r.Stream(buf)
+		out = append(out, buf[:n]...)
+		if !ok {
+			return out
+		}
+	}
+}
+
+// sampleStreamer streams decoded samples held in memory.
+type sampleStreamer struct {
+	samples [][2]float64
+	pos     int
+}
+
+func (s *sampleStreamer) Stream(samples [][2]float64) (int, bool) {
+	if s.pos >= len(s.samples) {
+		return 0, false
+	}
+	n := copy(samples, s.samples[s.pos:])
+	s.pos += n
+	return n, true
+}
+
+func (s *sampleStreamer) Err() error {
 	return nil
 }
+
+// Duration returns the playback length of an audio file.
+func Duration(file string) (time.Duration, error) {
+	samples, format, err := decodeFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return format.SampleRate.D(len(samples)), nil
+}
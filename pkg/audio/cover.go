@@ -0,0 +1,187 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	coverSize = 600
+	// characters drawn on the cover, longer items are cut off
+	coverChars = 8
+)
+
+// CoverFont is a font with chinese glyphs the cover characters are drawn with.
+type CoverFont struct {
+	font *opentype.Font
+}
+
+// fonts tried if no cover font is configured
+var defaultCoverFonts = []string{
+	"/usr/share/fonts/opentype/noto/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/noto-cjk/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/truetype/wqy/wqy-microhei.ttc",
+	"/usr/share/fonts/wenquanyi/wqy-microhei/wqy-microhei.ttc",
+	"/System/Library/Fonts/PingFang.ttc",
+}
+
+// LoadCoverFont reads a ttf, otf or ttc font. From collections the simplified chinese
+// font is used if there is one. With an empty path the default locations are tried, no
+// font is found if none of them exists.
+func LoadCoverFont(path string) (*CoverFont, error) {
+	if path == "" {
+		for _, p := range defaultCoverFonts {
+			if _, err := os.Stat(p); err == nil {
+				return LoadCoverFont(p)
+			}
+		}
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font %s: %v", path, err)
+	}
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %v", path, err)
+	}
+	var f *sfnt.Font
+	for i := 0; i < collection.NumFonts(); i++ {
+		fi, err := collection.Font(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse font %s: %v", path, err)
+		}
+		if f == nil {
+			f = fi
+		}
+		name, err := fi.Name(nil, sfnt.NameIDFull)
+		if err == nil && strings.Contains(name, " SC") {
+			f = fi
+			break
+		}
+	}
+	return &CoverFont{font: f}, nil
+}
+
+// RenderCover draws the characters of an item on a background colored by the item, so
+// that items can be told apart at a glance. Without a font, each character is drawn as a
+// colored tile instead.
+func RenderCover(text string, f *CoverFont) ([]byte, error) {
+	var chars []rune
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			chars = append(chars, r)
+		}
+		if len(chars) == coverChars {
+			break
+		}
+	}
+	if len(chars) == 0 {
+		return nil, fmt.Errorf("no characters to draw in %s", text)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(string(chars)))
+	hue := float64(h.Sum32()%360) / 360
+	img := image.NewRGBA(image.Rect(0, 0, coverSize, coverSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(hsv(hue, 0.55, 0.45)), image.Point{}, draw.Src)
+
+	// up to 4 characters per line, at most 2 lines
+	lines := [][]rune{chars}
+	if len(chars) > 4 {
+		half := (len(chars) + 1) / 2
+		lines = [][]rune{chars[:half], chars[half:]}
+	}
+	perLine := len(lines[0])
+	cell := math.Min(coverSize*0.8/float64(perLine), coverSize*0.8/float64(len(lines)))
+
+	if f == nil {
+		drawTiles(img, lines, cell, hue)
+	} else if err := drawChars(img, f, lines, cell); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode cover: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func drawChars(img *image.RGBA, f *CoverFont, lines [][]rune, size float64) error {
+	face, err := opentype.NewFace(f.font, &opentype.FaceOptions{
+		Size:    size * 0.9,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create font face: %v", err)
+	}
+	defer face.Close()
+
+	d := font.Drawer{Dst: img, Src: image.White, Face: face}
+	metrics := face.Metrics()
+	lineHeight := metrics.Ascent + metrics.Descent
+	top := (fixed.I(coverSize) - lineHeight*fixed.Int26_6(len(lines))) / 2
+	for i, line := range lines {
+		width := d.MeasureString(string(line))
+		d.Dot = fixed.Point26_6{
+			X: (fixed.I(coverSize) - width) / 2,
+			Y: top + lineHeight*fixed.Int26_6(i) + metrics.Ascent,
+		}
+		d.DrawString(string(line))
+	}
+	return nil
+}
+
+// drawTiles draws a tile per character, shaded by the character.
+func drawTiles(img *image.RGBA, lines [][]rune, cell, hue float64) {
+	top := (coverSize - cell*float64(len(lines))) / 2
+	for i, line := range lines {
+		left := (coverSize - cell*float64(len(line))) / 2
+		for j, r := range line {
+			x, y := int(left+cell*float64(j)), int(top+cell*float64(i))
+			gap := int(cell * 0.08)
+			rect := image.Rect(x+gap, y+gap, x+int(cell)-gap, y+int(cell)-gap)
+			shade := 0.6 + 0.4*float64(r%7)/6
+			draw.Draw(img, rect, image.NewUniform(hsv(hue, 0.25, shade)), image.Point{}, draw.Src)
+		}
+	}
+}
+
+// hsv converts a color with hue, saturation and value in 0..1 to rgb.
+func hsv(h, s, v float64) color.RGBA {
+	i := math.Floor(h * 6)
+	f := h*6 - i
+	p, q, t := v*(1-s), v*(1-f*s), v*(1-(1-f)*s)
+	var r, g, b float64
+	switch int(i) % 6 {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+	return color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
+}
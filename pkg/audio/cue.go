@@ -0,0 +1,142 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// sample rate of outputs consisting of cues and silence only
+const DefaultSampleRate beep.SampleRate = 24000
+
+// cue names
+const (
+	CueStart   = "start"   // an item begins
+	CueEnglish = "english" // the english part follows
+	CueGap     = "gap"     // the learner is expected to speak
+	CueEnd     = "end"     // the item is over, replaces peep.mp3
+)
+
+// files of a concatenator referring to a cue instead of an audio file carry this prefix
+const cuePrefix = "cue:"
+
+type Waveform int
+
+const (
+	Sine  Waveform = iota // a plain tone
+	Chirp                 // a tone sweeping from Freq to FreqEnd
+	Chime                 // a bell-like tone with overtones and a long decay
+)
+
+// Cue describes a synthesized sound. Sequences of notes are played back to back.
+type Cue struct {
+	Waveform Waveform
+	Notes    []Note
+	Gain     float64 // peak amplitude, 0..1
+}
+
+type Note struct {
+	Freq     float64
+	FreqEnd  float64 // chirps only
+	Duration time.Duration
+}
+
+var Cues = map[string]Cue{
+	CueStart: {
+		Waveform: Chime,
+		Notes: []Note{
+			{Freq: 660, Duration: 180 * time.Millisecond},
+			{Freq: 880, Duration: 380 * time.Millisecond},
+		},
+		Gain: 0.5,
+	},
+	CueEnglish: {
+		Waveform: Sine,
+		Notes:    []Note{{Freq: 523.25, Duration: 120 * time.Millisecond}},
+		Gain:     0.4,
+	},
+	CueGap: {
+		Waveform: Chirp,
+		Notes:    []Note{{Freq: 440, FreqEnd: 880, Duration: 250 * time.Millisecond}},
+		Gain:     0.4,
+	},
+	CueEnd: {
+		Waveform: Chime,
+		Notes: []Note{
+			{Freq: 880, Duration: 180 * time.Millisecond},
+			{Freq: 660, Duration: 180 * time.Millisecond},
+			{Freq: 440, Duration: 500 * time.Millisecond},
+		},
+		Gain: 0.5,
+	},
+}
+
+// CueRef returns the reference to a cue to be used in place of a file.
+func CueRef(name string) string {
+	return cuePrefix + name
+}
+
+func IsCue(file string) bool {
+	return strings.HasPrefix(file, cuePrefix)
+}
+
+// GenerateCue synthesizes a cue referenced by CueRef at the given sample rate.
+func GenerateCue(ref string, sr beep.SampleRate) ([][2]float64, error) {
+	name := strings.TrimPrefix(ref, cuePrefix)
+	cue, ok := Cues[name]
+	if !ok {
+		names := make([]string, 0, len(Cues))
+		for n := range Cues {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown cue %s, use one of: %s", name, strings.Join(names, ", "))
+	}
+	return cue.Generate(sr), nil
+}
+
+// short fades avoid clicks at the start and end of each note
+const fade = 5 * time.Millisecond
+
+func (c Cue) Generate(sr beep.SampleRate) [][2]float64 {
+	var samples [][2]float64
+	for _, note := range c.Notes {
+		n := sr.N(note.Duration)
+		fadeN := sr.N(fade)
+		var phase float64
+		for i := 0; i < n; i++ {
+			t := float64(i) / float64(sr)
+			freq := note.Freq
+			if c.Waveform == Chirp {
+				freq += (note.FreqEnd - note.Freq) * float64(i) / float64(n)
+			}
+			phase += 2 * math.Pi * freq / float64(sr)
+
+			var v float64
+			switch c.Waveform {
+			case Chime:
+				// partials of a bell, higher ones decay faster
+				v = math.Sin(phase)*math.Exp(-3*t) +
+					0.5*math.Sin(2*phase)*math.Exp(-6*t) +
+					0.25*math.Sin(3*phase)*math.Exp(-9*t)
+				v /= 1.75
+			default:
+				v = math.Sin(phase)
+			}
+
+			env := 1.0
+			if i < fadeN {
+				env = float64(i) / float64(fadeN)
+			} else if i > n-fadeN {
+				env = float64(n-i) / float64(fadeN)
+			}
+			v *= env * c.Gain
+			samples = append(samples, [2]float64{v, v})
+		}
+	}
+	return samples
+}
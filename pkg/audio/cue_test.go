@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+func TestGenerateCue(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Duration
+	}{
+		{CueStart, 560 * time.Millisecond},
+		{CueEnglish, 120 * time.Millisecond},
+		{CueGap, 250 * time.Millisecond},
+		{CueEnd, 860 * time.Millisecond},
+	}
+	if len(tests) != len(Cues) {
+		t.Errorf("%d cues, %d tested", len(Cues), len(tests))
+	}
+	for _, tt := range tests {
+		samples, err := GenerateCue(CueRef(tt.name), DefaultSampleRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := DefaultSampleRate.D(len(samples)); got != tt.want {
+			t.Errorf("%s lasts %v, want %v", tt.name, got, tt.want)
+		}
+		var peak float64
+		for _, s := range samples {
+			peak = math.Max(peak, math.Abs(s[0]))
+		}
+		if gain := Cues[tt.name].Gain; peak < gain/4 || peak > gain {
+			t.Errorf("%s peaks at %.2f, want up to its gain %.2f", tt.name, peak, gain)
+		}
+		// the notes fade in and out without clicks
+		if first, last := samples[0][0], samples[len(samples)-1][0]; math.Abs(first) > 0.01 || math.Abs(last) > 0.01 {
+			t.Errorf("%s starts at %.3f and ends at %.3f, want silence", tt.name, first, last)
+		}
+	}
+	if _, err := GenerateCue(CueRef("peep"), DefaultSampleRate); err == nil {
+		t.Error("generated an unknown cue")
+	}
+}
+
+func TestCueRef(t *testing.T) {
+	ref := CueRef(CueGap)
+	if ref != "cue:gap" || !IsCue(ref) {
+		t.Errorf("CueRef(%q) = %q", CueGap, ref)
+	}
+	if IsCue("gap.mp3") || IsCue("") {
+		t.Error("a file is taken for a cue")
+	}
+	// cues are synthesized at the rate of the output
+	for _, sr := range []beep.SampleRate{16000, 24000, 48000} {
+		samples, err := GenerateCue(ref, sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int(sr) / 4; len(samples) != want {
+			t.Errorf("gap at %dHz has %d samples, want %d", sr, len(samples), want)
+		}
+	}
+	// references like the interstitial cue:start are resolved when rendering
+	c := NewConcatenator()
+	c.AddWithPause("cue:peep", 0)
+	if _, _, err := c.Render(); err == nil {
+		t.Error("rendered an unknown cue")
+	}
+}
+
+func TestAddCue(t *testing.T) {
+	c := NewConcatenator()
+	c.AddCue(CueStart, 100)
+	if len(c.Files) != 0 || len(c.Pauses) != 0 {
+		t.Errorf("cue added with cues disabled: %v", c.Files)
+	}
+
+	c = NewConcatenatorWithOptions(RenderOptions{Cues: true})
+	c.AddCue(CueStart, 100)
+	c.AddCue(CueEnd, 0)
+	if len(c.Files) != 2 || c.Files[0] != CueRef(CueStart) || c.Pauses[0] != 100 {
+		t.Fatalf("files %v, pauses %v", c.Files, c.Pauses)
+	}
+	samples, format, err := c.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != DefaultSampleRate {
+		t.Errorf("sample rate %d, want %d", format.SampleRate, DefaultSampleRate)
+	}
+	if got, want := format.SampleRate.D(len(samples)), 1520*time.Millisecond; got != want {
+		t.Errorf("rendered %v, want %v", got, want)
+	}
+	if end := c.Timeline[1]; end.Start != 660*time.Millisecond || end.End != 1520*time.Millisecond {
+		t.Errorf("end cue at %v-%v", end.Start, end.End)
+	}
+}
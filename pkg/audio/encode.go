@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/braheezy/shine-mp3/pkg/mp3"
+	"github.com/faiface/beep"
+)
+
+// OutputPath returns file with the extension of the format rendered audio is written in.
+func OutputPath(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".mp3"
+}
+
+// AudioFiles returns the mp3 and wav files of dir in name order.
+func AudioFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.mp3", "*.wav"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isAudioFile reports whether a file is an mp3 or wav file by its name.
+func isAudioFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".mp3" || ext == ".wav"
+}
+
+// encode writes the samples in the format given by the extension of outputFile.
+func encode(outputFile string, samples [][2]float64, format beep.Format) error {
+	if filepath.Ext(outputFile) != ".mp3" {
+		return encodeWAV(outputFile, samples, format)
+	}
+	return encodeMP3(outputFile, samples, format)
+}
+
+// sample rates the mp3 encoder supports, others are resampled to 44.1kHz
+var mp3SampleRates = map[beep.SampleRate]bool{
+	16000: true, 22050: true, 24000: true, 32000: true, 44100: true, 48000: true,
+}
+
+// bitrate the encoder writes, it is not configurable
+const mp3Bitrate = 128000
+
+// encodeMP3 encodes the samples as stereo mp3 at a constant bitrate of 128kbps, without a
+// xing header or tags, so that the frames of several files form a single stream.
+func encodeMP3(outputFile string, samples [][2]float64, format beep.Format) error {
+	rate := format.SampleRate
+	if !mp3SampleRates[rate] {
+		samples = resample(samples, rate, 44100)
+		rate = 44100
+	}
+	// mpeg 1 frames hold 1152 samples, mpeg 2 frames at lower rates 576
+	frame := 2 * 1152
+	if rate < 32000 {
+		frame = 2 * 576
+	}
+	// the encoder only takes whole frames of interleaved samples, the last frame is padded
+	// with silence. It keeps the end of a frame until the next one is encoded, a frame of
+	// silence pushes out the last one and is cut off below. The encoder leaves its sample
+	// pointers behind the last frame, the spare capacity keeps them inside the buffer.
+	frames := max((2*len(samples)+frame-1)/frame, 1)
+	n := (frames + 1) * frame
+	data := make([]int16, n, n+frame)
+	for i, s := range samples {
+		data[2*i], data[2*i+1] = toInt16(s[0]), toInt16(s[1])
+	}
+	var buf bytes.Buffer
+	if err := mp3.NewEncoder(int(rate), 2).Write(&buf, data); err != nil {
+		return fmt.Errorf("failed to encode %s: %v", outputFile, err)
+	}
+	if err := os.WriteFile(outputFile, wholeFrames(buf.Bytes(), rate, frames), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	return nil
+}
+
+// wholeFrames returns the first n encoded frames, or as many as are complete.
+func wholeFrames(data []byte, rate beep.SampleRate, n int) []byte {
+	size := 144 * mp3Bitrate / int(rate)
+	if rate < 32000 {
+		size /= 2
+	}
+	end := 0
+	for i := 0; i < n && end+4 <= len(data) && data[end] == 0xff; i++ {
+		// the padding bit adds a byte to the frame
+		next := end + size + int(data[end+2]>>1&1)
+		if next > len(data) {
+			break
+		}
+		end = next
+	}
+	return data[:end]
+}
+
+func toInt16(v float64) int16 {
+	v = math.Max(-1, math.Min(1, v))
+	return int16(math.Round(v * math.MaxInt16))
+}
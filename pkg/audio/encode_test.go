@@ -0,0 +1,119 @@
+package audio
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+func TestOutputPath(t *testing.T) {
+	for _, file := range []string{"out/你好.mp3", "out/你好.wav", "out/你好"} {
+		if got, want := OutputPath(file), "out/你好.mp3"; got != want {
+			t.Errorf("OutputPath(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestAudioFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.wav", "a.mp3", "c.mp3", "a.lrc", "b.vtt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := AudioFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.mp3"), filepath.Join(dir, "b.wav"), filepath.Join(dir, "c.mp3")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("AudioFiles = %v, want %v", files, want)
+	}
+}
+
+func TestEncodeDecodes(t *testing.T) {
+	format := beep.Format{SampleRate: 16000, NumChannels: 2, Precision: 2}
+	samples := make([][2]float64, 1600)
+	for i := range samples {
+		v := 0.5 * math.Sin(float64(i)/10)
+		samples[i] = [2]float64{v, v}
+	}
+	file := OutputPath(filepath.Join(t.TempDir(), "tone.mp3"))
+	if err := encode(file, samples, format); err != nil {
+		t.Fatal(err)
+	}
+	decoded, got, err := decodeFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SampleRate != format.SampleRate {
+		t.Errorf("sample rate %d, want %d", got.SampleRate, format.SampleRate)
+	}
+	// mp3 adds encoder delay and padding
+	if n := len(decoded); n < len(samples) || n > len(samples)+2*1152+1152 {
+		t.Errorf("decoded %d samples, want about %d", n, len(samples))
+	}
+}
+
+func TestEncodeMP3(t *testing.T) {
+	tests := []struct {
+		rate, want beep.SampleRate
+	}{
+		{16000, 16000},
+		{24000, 24000},
+		{44100, 44100},
+		{48000, 48000},
+		// rates the encoder does not support are resampled
+		{8000, 44100},
+		{11025, 44100},
+	}
+	for _, tt := range tests {
+		format := beep.Format{SampleRate: tt.rate, NumChannels: 2, Precision: 2}
+		samples := make([][2]float64, tt.rate.N(time.Second))
+		for i := range samples {
+			v := 0.5 * math.Sin(2*math.Pi*440*float64(i)/float64(tt.rate))
+			samples[i] = [2]float64{v, v}
+		}
+		file := filepath.Join(t.TempDir(), "tone.mp3")
+		if err := encodeMP3(file, samples, format); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a plain stream of frames that can be joined with others
+		if !bytes.HasPrefix(data, []byte{0xff}) || bytes.Contains(data, []byte("Xing")) || bytes.Contains(data, []byte("Info")) {
+			t.Errorf("%d: not a plain mp3 stream", tt.rate)
+		}
+		decoded, got, err := decodeFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SampleRate != tt.want {
+			t.Errorf("%d: sample rate %d, want %d", tt.rate, got.SampleRate, tt.want)
+		}
+		if d := got.SampleRate.D(len(decoded)); d < time.Second || d > time.Second+100*time.Millisecond {
+			t.Errorf("%d: decoded %v, want about 1s", tt.rate, d)
+		}
+		// the tone survives the encoding at about the same loudness
+		want := IntegratedLoudness(samples, tt.rate)
+		if l := IntegratedLoudness(decoded, got.SampleRate); math.Abs(l-want) > 1 {
+			t.Errorf("%d: decoded at %.1f LUFS, want %.1f", tt.rate, l, want)
+		}
+	}
+	// an empty clip is a frame of silence
+	file := filepath.Join(t.TempDir(), "empty.mp3")
+	if err := encodeMP3(file, nil, beep.Format{SampleRate: 16000, NumChannels: 2, Precision: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeFile(file); err != nil {
+		t.Errorf("empty clip: %v", err)
+	}
+}
@@ -0,0 +1,548 @@
+package audio
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Export is the set of loops of a run delivered to the sinks. Sinks keep the exports
+// of a day in a directory named after the date.
+type Export struct {
+	ID    string // unique per export, names the staging area
+	Date  time.Time
+	Label string // e.g. the mode, names zip bundles
+	Files []ExportFile
+}
+
+type ExportFile struct {
+	Name string // path in the export
+	Path string // local file
+}
+
+func (e Export) Day() string {
+	return e.Date.Format("2006-01-02")
+}
+
+// NewExport collects the files of dir.
+func NewExport(dir, label string) (Export, error) {
+	now := time.Now()
+	e := Export{
+		ID:    fmt.Sprintf("%d", now.UnixNano()),
+		Date:  now,
+		Label: label,
+	}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		e.Files = append(e.Files, ExportFile{Name: filepath.ToSlash(rel), Path: p})
+		return nil
+	})
+	if err != nil {
+		return e, err
+	}
+	if len(e.Files) == 0 {
+		return e, fmt.Errorf("no files to export in %s", dir)
+	}
+	return e, nil
+}
+
+// Sink is a destination of exports. Files are staged first and made visible by the
+// commit, so that an export either reaches all sinks or none. The commit backs up the
+// files it replaces until the export is cleaned up.
+type Sink interface {
+	Stage(ctx context.Context, e Export) error
+	Commit(ctx context.Context, e Export) error
+	// Abort removes the staged files of the export. If the commit was started, the files
+	// it moved into place are reverted: replaced files are restored from their backup,
+	// files the export created are removed and files it did not reach are left alone.
+	Abort(ctx context.Context, e Export, committed bool) error
+	// Cleanup removes the backups of a committed export.
+	Cleanup(ctx context.Context, e Export) error
+	// Exports lists the names of the stored exports, each starting with its date.
+	Exports(ctx context.Context) ([]string, error)
+	Remove(ctx context.Context, name string) error
+	String() string
+}
+
+// Retention limits the exports kept by a sink. Zero values keep everything.
+type Retention struct {
+	KeepDays int // remove exports older than this many days
+	KeepLast int // keep only this many exports, the newest ones
+}
+
+type SinkConfig struct {
+	Sink      Sink
+	Retention Retention
+}
+
+// Exporter delivers exports to all sinks atomically: the files are staged on every
+// sink first and only committed once all stagings succeeded. A failing commit reverts
+// the sinks committed before and the part of the failed sink committed already.
+type Exporter struct {
+	Sinks []SinkConfig
+}
+
+func (x *Exporter) Export(ctx context.Context, e Export) error {
+	// the sinks whose commit was started are reverted, the others only lose their
+	// staged files
+	abort := func(sinks []SinkConfig, committed int) {
+		for i, s := range sinks {
+			if err := s.Sink.Abort(ctx, e, i < committed); err != nil {
+				slog.Error("failed to abort export", "sink", s.Sink, "err", err)
+			}
+		}
+	}
+	for i, s := range x.Sinks {
+		if err := s.Sink.Stage(ctx, e); err != nil {
+			abort(x.Sinks[:i+1], 0)
+			return fmt.Errorf("failed to stage export on %s: %w", s.Sink, err)
+		}
+	}
+	for i, s := range x.Sinks {
+		if err := s.Sink.Commit(ctx, e); err != nil {
+			// the failed commit may have moved part of the files already
+			abort(x.Sinks, i+1)
+			return fmt.Errorf("failed to commit export on %s: %w", s.Sink, err)
+		}
+		slog.Info("exported", "sink", s.Sink, "files", len(e.Files))
+	}
+	for _, s := range x.Sinks {
+		// the export is complete, leftover backups only take space
+		if err := s.Sink.Cleanup(ctx, e); err != nil {
+			slog.Error("failed to remove backups of export", "sink", s.Sink, "err", err)
+		}
+		removed, err := Prune(ctx, s.Sink, s.Retention, e.Date)
+		if err != nil {
+			return fmt.Errorf("failed to apply retention on %s: %w", s.Sink, err)
+		}
+		for _, name := range removed {
+			slog.Info("removed export", "sink", s.Sink, "name", name)
+		}
+	}
+	return nil
+}
+
+// Prune removes the exports of a sink the retention does not keep.
+func Prune(ctx context.Context, sink Sink, r Retention, now time.Time) ([]string, error) {
+	if r.KeepDays == 0 && r.KeepLast == 0 {
+		return nil, nil
+	}
+	names, err := sink.Exports(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	cutoff := now.AddDate(0, 0, -r.KeepDays).Format("2006-01-02")
+	var removed []string
+	for i, name := range names {
+		expired := r.KeepDays > 0 && name[:10] < cutoff
+		if !expired && (r.KeepLast == 0 || i < r.KeepLast) {
+			continue
+		}
+		if err := sink.Remove(ctx, name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// isExportName reports whether a name starts with a date, other entries of a sink are
+// not touched by the retention.
+func isExportName(name string) bool {
+	if len(name) < 10 {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", name[:10])
+	return err == nil
+}
+
+// DirSink copies exports into a local directory, e.g. a synced Dropbox folder. Dated
+// sinks keep the exports of a day in a directory named after the date, others put all
+// files into the directory itself.
+type DirSink struct {
+	Dir   string
+	Dated bool
+}
+
+func (s *DirSink) String() string { return "dir:" + s.Dir }
+
+func (s *DirSink) staging(e Export) string {
+	return filepath.Join(s.Dir, ".staging-"+e.ID)
+}
+
+func (s *DirSink) backup(e Export) string {
+	return filepath.Join(s.Dir, ".backup-"+e.ID)
+}
+
+func (s *DirSink) target(e Export, name string) string {
+	if s.Dated {
+		return filepath.Join(s.Dir, e.Day(), filepath.FromSlash(name))
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(name))
+}
+
+// Stage copies the files into a staging dir next to the target, so that the commit
+// renames within the same file system.
+func (s *DirSink) Stage(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		staged := filepath.Join(s.staging(e), filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(staged), os.ModePerm); err != nil {
+			return err
+		}
+		if err := copyFileContents(f.Path, staged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DirSink) Commit(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		target := s.target(e, f.Name)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if err := backupFile(target, filepath.Join(s.backup(e), filepath.FromSlash(f.Name))); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(s.staging(e), filepath.FromSlash(f.Name)), target); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(s.staging(e))
+}
+
+func (s *DirSink) Abort(ctx context.Context, e Export, committed bool) error {
+	if committed {
+		for _, f := range e.Files {
+			name := filepath.FromSlash(f.Name)
+			err := revertFile(s.target(e, f.Name), filepath.Join(s.staging(e), name), filepath.Join(s.backup(e), name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.RemoveAll(s.staging(e)); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.backup(e))
+}
+
+func (s *DirSink) Cleanup(ctx context.Context, e Export) error {
+	return os.RemoveAll(s.backup(e))
+}
+
+// backupFile moves an existing target to its backup before the commit replaces it.
+func backupFile(target, backup string) error {
+	if _, err := os.Stat(target); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(target, backup)
+}
+
+// revertFile undoes the commit of a file: a backup is restored, a target without backup
+// was created by the commit if its staged file is gone.
+func revertFile(target, staged, backup string) error {
+	if _, err := os.Stat(backup); err == nil {
+		return os.Rename(backup, target)
+	}
+	if _, err := os.Stat(staged); err == nil {
+		// not committed
+		return nil
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *DirSink) Exports(ctx context.Context) ([]string, error) {
+	if !s.Dated {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && isExportName(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *DirSink) Remove(ctx context.Context, name string) error {
+	return os.RemoveAll(filepath.Join(s.Dir, name))
+}
+
+// ZipSink bundles each export into a zip file named after the date and label.
+type ZipSink struct {
+	Dir string
+}
+
+func (s *ZipSink) String() string { return "zip:" + s.Dir }
+
+func (s *ZipSink) target(e Export) string {
+	name := e.Day()
+	if e.Label != "" {
+		name += "_" + e.Label
+	}
+	return filepath.Join(s.Dir, name+".zip")
+}
+
+func (s *ZipSink) staging(e Export) string {
+	return filepath.Join(s.Dir, ".staging-"+e.ID+".zip")
+}
+
+func (s *ZipSink) backup(e Export) string {
+	return filepath.Join(s.Dir, ".backup-"+e.ID+".zip")
+}
+
+func (s *ZipSink) Stage(ctx context.Context, e Export) error {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(s.staging(e))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := zip.NewWriter(out)
+	for _, f := range e.Files {
+		if err := addToZip(w, f); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addToZip(w *zip.Writer, f ExportFile) error {
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = f.Name
+	// audio hardly compresses
+	header.Method = zip.Store
+	zw, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zw, in)
+	return err
+}
+
+func (s *ZipSink) Commit(ctx context.Context, e Export) error {
+	if err := backupFile(s.target(e), s.backup(e)); err != nil {
+		return err
+	}
+	return os.Rename(s.staging(e), s.target(e))
+}
+
+func (s *ZipSink) Abort(ctx context.Context, e Export, committed bool) error {
+	if committed {
+		if err := revertFile(s.target(e), s.staging(e), s.backup(e)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.staging(e)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *ZipSink) Cleanup(ctx context.Context, e Export) error {
+	if err := os.Remove(s.backup(e)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *ZipSink) Exports(ctx context.Context) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if name := filepath.Base(f); isExportName(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *ZipSink) Remove(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.Dir, name))
+}
+
+// S3Sink uploads exports into a bucket. Object stores have no rename, files are staged
+// under a staging prefix and copied on the server side by the commit.
+type S3Sink struct {
+	Store *S3Store
+}
+
+func (s *S3Sink) String() string { return "s3:" + s.Store.Bucket + "/" + s.Store.Prefix }
+
+func (s *S3Sink) staging(e Export, name string) string {
+	return path.Join(".staging", e.ID, name)
+}
+
+func (s *S3Sink) target(e Export, name string) string {
+	return path.Join(e.Day(), name)
+}
+
+func (s *S3Sink) backup(e Export, name string) string {
+	return path.Join(".backup", e.ID, name)
+}
+
+// exists reports whether an object exists.
+func (s *S3Sink) exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Store.Stat(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *S3Sink) Stage(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		in, err := os.Open(f.Path)
+		if err != nil {
+			return err
+		}
+		err = s.Store.Put(ctx, s.staging(e, f.Name), in, -1)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit copies each staged file into place and deletes it right away, a missing staged
+// file marks the file as committed for Abort.
+func (s *S3Sink) Commit(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		target := s.target(e, f.Name)
+		exists, err := s.exists(ctx, target)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := s.Store.Copy(ctx, target, s.backup(e, f.Name)); err != nil {
+				return err
+			}
+		}
+		if err := s.Store.Copy(ctx, s.staging(e, f.Name), target); err != nil {
+			return err
+		}
+		if err := s.Store.Delete(ctx, s.staging(e, f.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Sink) Abort(ctx context.Context, e Export, committed bool) error {
+	for _, f := range e.Files {
+		if committed {
+			if err := s.revert(ctx, e, f.Name); err != nil {
+				return err
+			}
+		}
+		if err := s.Store.Delete(ctx, s.staging(e, f.Name)); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return s.Cleanup(ctx, e)
+}
+
+func (s *S3Sink) revert(ctx context.Context, e Export, name string) error {
+	target, staged, backup := s.target(e, name), s.staging(e, name), s.backup(e, name)
+	if ok, err := s.exists(ctx, backup); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		return s.Store.Copy(ctx, backup, target)
+	}
+	if ok, err := s.exists(ctx, staged); err != nil || ok {
+		// not committed
+		return err
+	}
+	if err := s.Store.Delete(ctx, target); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *S3Sink) Cleanup(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		if err := s.Store.Delete(ctx, s.backup(e, f.Name)); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Sink) Exports(ctx context.Context) ([]string, error) {
+	entries, err := s.Store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		day, _, _ := strings.Cut(entry.Key, "/")
+		if isExportName(day) && !contains(names, day) {
+			names = append(names, day)
+		}
+	}
+	return names, nil
+}
+
+func (s *S3Sink) Remove(ctx context.Context, name string) error {
+	entries, err := s.Store.List(ctx, name+"/")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.Store.Delete(ctx, entry.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
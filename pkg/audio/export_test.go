@@ -0,0 +1,267 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// newTestExport writes the files of an export with their names as content.
+func newTestExport(t *testing.T, date time.Time, names ...string) Export {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("new "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e, err := NewExport(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Date = date
+	return e
+}
+
+func readFile(t *testing.T, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func TestDirSinkAbortRestoresTargets(t *testing.T) {
+	ctx := context.Background()
+	sink := &DirSink{Dir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(sink.Dir, "a.mp3"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := newTestExport(t, time.Now(), "a.mp3", "b.mp3")
+	if err := sink.Stage(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Commit(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(sink.Dir, "a.mp3")); got != "new a.mp3" {
+		t.Errorf("committed a.mp3 = %q", got)
+	}
+	if err := sink.Abort(ctx, e, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(sink.Dir, "a.mp3")); got != "old" {
+		t.Errorf("restored a.mp3 = %q, want old", got)
+	}
+	if _, err := os.Stat(filepath.Join(sink.Dir, "b.mp3")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("b.mp3 created by the export was not removed: %v", err)
+	}
+	entries, _ := os.ReadDir(sink.Dir)
+	if len(entries) != 1 {
+		t.Errorf("staging or backup left behind: %v", entries)
+	}
+}
+
+func TestZipSinkAbortRestoresTarget(t *testing.T) {
+	ctx := context.Background()
+	sink := &ZipSink{Dir: t.TempDir()}
+	e := newTestExport(t, time.Now(), "a.mp3")
+	if err := os.WriteFile(sink.target(e), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Stage(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Commit(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Abort(ctx, e, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, sink.target(e)); got != "old" {
+		t.Errorf("restored zip = %q, want old", got)
+	}
+}
+
+// breakingSink loses the staged file of the last export file, so that the commit fails
+// after moving the others.
+type breakingSink struct {
+	*DirSink
+}
+
+func (s breakingSink) Stage(ctx context.Context, e Export) error {
+	if err := s.DirSink.Stage(ctx, e); err != nil {
+		return err
+	}
+	last := e.Files[len(e.Files)-1].Name
+	return os.Remove(filepath.Join(s.staging(e), filepath.FromSlash(last)))
+}
+
+func TestExporterRevertsFailedCommit(t *testing.T) {
+	first := &DirSink{Dir: t.TempDir()}
+	second := breakingSink{&DirSink{Dir: t.TempDir()}}
+	for _, dir := range []string{first.Dir, second.Dir} {
+		if err := os.WriteFile(filepath.Join(dir, "a.mp3"), []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	x := &Exporter{Sinks: []SinkConfig{{Sink: first}, {Sink: second}}}
+	e := newTestExport(t, time.Now(), "a.mp3", "b.mp3")
+	if err := x.Export(context.Background(), e); err == nil {
+		t.Fatal("export with a failing commit succeeded")
+	}
+	for _, dir := range []string{first.Dir, second.Dir} {
+		if got := readFile(t, filepath.Join(dir, "a.mp3")); got != "old" {
+			t.Errorf("%s: a.mp3 = %q, want old", dir, got)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "b.mp3")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: b.mp3 was not removed: %v", dir, err)
+		}
+	}
+}
+
+func newTestWebDAVSink(t *testing.T) (*WebDAVSink, webdav.FileSystem) {
+	fs := webdav.NewMemFS()
+	srv := httptest.NewServer(&webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()})
+	t.Cleanup(srv.Close)
+	return NewWebDAVSink(srv.URL+"/", "", ""), fs
+}
+
+func readWebDAV(t *testing.T, fs webdav.FileSystem, name string) string {
+	t.Helper()
+	f, err := fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWebDAVSink(t *testing.T) {
+	ctx := context.Background()
+	sink, fs := newTestWebDAVSink(t)
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	e := newTestExport(t, day, "a.mp3", "b.mp3")
+	x := &Exporter{Sinks: []SinkConfig{{Sink: sink}}}
+	if err := x.Export(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if got := readWebDAV(t, fs, "/2024-03-01/b.mp3"); got != "new b.mp3" {
+		t.Errorf("exported b.mp3 = %q", got)
+	}
+	names, err := sink.Exports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"2024-03-01"}) {
+		t.Errorf("exports = %v", names)
+	}
+
+	// a second export of the day replaces a.mp3, its abort restores it
+	e2 := newTestExport(t, day, "a.mp3", "c.mp3")
+	e2.ID += "-2"
+	if err := sink.Stage(ctx, e2); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Commit(ctx, e2); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Abort(ctx, e2, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readWebDAV(t, fs, "/2024-03-01/a.mp3"); got != "new a.mp3" {
+		t.Errorf("restored a.mp3 = %q", got)
+	}
+	if got := readWebDAV(t, fs, "/2024-03-01/c.mp3"); got != "" {
+		t.Errorf("c.mp3 created by the aborted export was not removed")
+	}
+	root, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	infos, err := root.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("staging or backup left behind: %d entries", len(infos))
+	}
+}
+
+func TestWebDAVSinkRequiresAuth(t *testing.T) {
+	h := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	e := newTestExport(t, time.Now(), "a.mp3")
+	if err := NewWebDAVSink(srv.URL, "user", "wrong").Stage(ctx, e); err == nil {
+		t.Error("stage with a wrong password succeeded")
+	}
+	if err := NewWebDAVSink(srv.URL, "user", "secret").Stage(ctx, e); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	exports := []string{"2024-03-01", "2024-03-05", "2024-03-08", "2024-03-09_review", "2024-03-10"}
+	tests := []struct {
+		name      string
+		retention Retention
+		removed   []string
+	}{
+		{"none", Retention{}, nil},
+		{"days", Retention{KeepDays: 3}, []string{"2024-03-05", "2024-03-01"}},
+		{"last", Retention{KeepLast: 2}, []string{"2024-03-08", "2024-03-05", "2024-03-01"}},
+		{"both", Retention{KeepDays: 7, KeepLast: 4}, []string{"2024-03-01"}},
+		{"days bound last", Retention{KeepDays: 1, KeepLast: 4}, []string{"2024-03-08", "2024-03-05", "2024-03-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &DirSink{Dir: t.TempDir(), Dated: true}
+			for _, name := range append(exports, ".staging-1", "notes") {
+				if err := os.Mkdir(filepath.Join(sink.Dir, name), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+			}
+			removed, err := Prune(context.Background(), sink, tt.retention, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed %v, want %v", removed, tt.removed)
+			}
+			entries, _ := os.ReadDir(sink.Dir)
+			var left []string
+			for _, entry := range entries {
+				left = append(left, entry.Name())
+			}
+			sort.Strings(left)
+			if len(left) != len(exports)+2-len(tt.removed) {
+				t.Errorf("left %v", left)
+			}
+		})
+	}
+}
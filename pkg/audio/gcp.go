@@ -5,18 +5,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	texttospeech "cloud.google.com/go/texttospeech/apiv1"
 	"cloud.google.com/go/texttospeech/apiv1/texttospeechpb"
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
 )
 
 type GCPDownloader struct {
-	dirEN   string
-	dirZH   string
-	dirSlow string
+	dirEN    string
+	dirZH    string
+	dirSlow  string
+	Manifest *Manifest
 }
 
 func NewGCPClient(dir string) (*GCPDownloader, error) {
@@ -73,7 +74,8 @@ func (p *GCPDownloader) FetchZH(ctx context.Context, query string) error {
 }
 
 func (p *GCPDownloader) Fetch(ctx context.Context, query string) (string, error) {
-	resp, err := fetch(ctx, query, GetRandomVoiceEN())
+	voice := GetRandomVoiceEN()
+	resp, err := fetch(ctx, query, voice)
 	if err != nil {
 		return "", err
 	}
@@ -83,11 +85,13 @@ func (p *GCPDownloader) Fetch(ctx context.Context, query string) (string, error)
 	if err != nil {
 		return "", err
 	}
+	p.Manifest.SetSource(path, "gcp", voice.Name)
 	return path, nil
 }
 
 func (p *GCPDownloader) FetchEN(ctx context.Context, queryZH, query string) error {
-	resp, err := fetch(ctx, query, GetRandomVoiceEN())
+	voice := GetRandomVoiceEN()
+	resp, err := fetch(ctx, query, voice)
 	if err != nil {
 		return err
 	}
@@ -96,6 +100,7 @@ func (p *GCPDownloader) FetchEN(ctx context.Context, queryZH, query string) erro
 	if err != nil {
 		return err
 	}
+	p.Manifest.SetSource(p.GetOutpathEN(queryZH), "gcp", voice.Name)
 	return nil
 }
 
@@ -109,6 +114,7 @@ func (p *GCPDownloader) FetchWithVoice(ctx context.Context, query string, voice
 	if err != nil {
 		return err
 	}
+	p.Manifest.SetSource(p.GetOutpathZH(query), "gcp", voice.Name)
 	return nil
 }
 
@@ -132,14 +138,7 @@ func (p *GCPDownloader) FetchTmp(ctx context.Context, query string, voice *textt
 func (p *GCPDownloader) JoinAndSaveSlowAudio(query string, inputPaths []string) (string, error) {
 	outpath := p.getOutpathSlow(query)
 
-	// ffmpeg command to join the MP3 files
-	ffmpegArgs := []string{"-i", "concat:" + strings.Join(inputPaths, "|"), "-c", "copy", "-y", outpath}
-
-	cmd := exec.Command("ffmpeg", ffmpegArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := JoinMP3(outpath, inputPaths); err != nil {
 		return "", fmt.Errorf("failed to join MP3 files: %v", err)
 	}
 
@@ -150,14 +149,7 @@ func (p *GCPDownloader) JoinAndSaveSlowAudio(query string, inputPaths []string)
 func (p *GCPDownloader) JoinAndSaveDialogAudio(query string, inputPaths []string) error {
 	outpath := p.GetOutpathZH(query)
 
-	// ffmpeg command to join the MP3 files
-	ffmpegArgs := []string{"-i", "concat:" + strings.Join(inputPaths, "|"), "-c", "copy", "-y", outpath}
-
-	cmd := exec.Command("ffmpeg", ffmpegArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := JoinMP3(outpath, inputPaths); err != nil {
 		return fmt.Errorf("failed to join MP3 files: %v", err)
 	}
 
@@ -172,6 +164,11 @@ func fetch(ctx context.Context, query string, voice *texttospeechpb.VoiceSelecti
 	}
 	defer client.Close()
 
+	// chinese voices read the numbers of the text by their chinese reading
+	if strings.HasPrefix(voice.LanguageCode, "cmn") {
+		query = textnorm.Text(query)
+	}
+
 	// perform the text-to-speech request on the text input with the selected
 	// voice parameters and audio file type
 	req := texttospeechpb.SynthesizeSpeechRequest{
@@ -0,0 +1,411 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Tags is the metadata written to the outputs as an ID3v2.4 tag.
+type Tags struct {
+	Title   string // the chinese item
+	Album   string // the lesson or date
+	Genre   string // the mode
+	Artist  string
+	Lyrics  string // full transcript
+	English string
+	Pinyin  string
+	Cover   []byte // png
+	// optional, written as CHAP frames with a CTOC table of contents
+	Chapters []Chapter
+}
+
+// Chapter of an audiobook, the title is the item and the text its chinese transcript.
+type Chapter struct {
+	Title string
+	Text  string
+	Start time.Duration
+	End   time.Duration
+}
+
+// TagOptions enable tagging of the outputs. The per item tags are derived from the
+// transcript of each output.
+type TagOptions struct {
+	Album  string
+	Genre  string
+	Artist string
+	// optional, font the characters on the cover are drawn with
+	Font *CoverFont
+	// optional, romanizes the chinese transcript for the pinyin comment
+	Pinyin func(chinese string) string
+}
+
+// FromTimeline returns the tags of an output merged from the timeline. The first chinese
+// segment is taken as the item.
+func (o *TagOptions) FromTimeline(timeline []Segment) Tags {
+	var lyrics, english, pinyin []string
+	var title string
+	for _, s := range timeline {
+		if lines := s.lines(); len(lines) > 0 {
+			lyrics = append(lyrics, strings.Join(lines, "\n"))
+		}
+		if s.Chinese != "" && title == "" {
+			title = s.Chinese
+		}
+		english = appendDistinct(english, s.English)
+		p := s.Pinyin
+		if p == "" && s.Chinese != "" && o.Pinyin != nil {
+			p = o.Pinyin(s.Chinese)
+		}
+		pinyin = appendDistinct(pinyin, p)
+	}
+	return o.tags(title, strings.Join(lyrics, "\n\n"), english, pinyin)
+}
+
+var prosodyRe = regexp.MustCompile(`(?s)<prosody[^>]*>(.*?)</prosody>`)
+
+// FromQuery returns the tags of a clip synthesized from an ssml query, the first chinese
+// text is taken as the item.
+func (o *TagOptions) FromQuery(query string) Tags {
+	var lyrics, english, pinyin []string
+	var title string
+	for _, m := range prosodyRe.FindAllStringSubmatch(query, -1) {
+		text := strings.Join(strings.Fields(queryText(m[1])), " ")
+		if text == "" || (len(lyrics) > 0 && lyrics[len(lyrics)-1] == text) {
+			continue
+		}
+		lyrics = append(lyrics, text)
+		if !hasHan(text) {
+			english = appendDistinct(english, text)
+			continue
+		}
+		if title == "" {
+			title = strings.ReplaceAll(text, " ", "")
+		}
+		if o.Pinyin != nil {
+			pinyin = appendDistinct(pinyin, o.Pinyin(text))
+		}
+	}
+	return o.tags(title, strings.Join(lyrics, "\n"), english, pinyin)
+}
+
+func (o *TagOptions) tags(title, lyrics string, english, pinyin []string) Tags {
+	t := Tags{
+		Title:   title,
+		Album:   o.Album,
+		Genre:   o.Genre,
+		Artist:  o.Artist,
+		Lyrics:  lyrics,
+		English: strings.Join(english, "; "),
+		Pinyin:  strings.Join(pinyin, "; "),
+	}
+	if title != "" {
+		cover, err := RenderCover(title, o.Font)
+		if err == nil {
+			t.Cover = cover
+		}
+	}
+	return t
+}
+
+func appendDistinct(s []string, v string) []string {
+	if v == "" || contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
+
+func hasHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ID3 encodes the tags as an ID3v2.4 tag with utf-8 text.
+func (t Tags) ID3() []byte {
+	var frames bytes.Buffer
+	text := func(id, value string) {
+		if value != "" {
+			writeFrame(&frames, id, append([]byte{3}, value...))
+		}
+	}
+	// lyrics and comments carry a language and a description
+	described := func(id, lang, desc, value string) {
+		if value == "" {
+			return
+		}
+		data := append([]byte{3}, lang...)
+		data = append(data, desc...)
+		data = append(data, 0)
+		writeFrame(&frames, id, append(data, value...))
+	}
+	text("TIT2", t.Title)
+	text("TALB", t.Album)
+	text("TCON", t.Genre)
+	text("TPE1", t.Artist)
+	described("USLT", "zho", "", t.Lyrics)
+	described("COMM", "eng", "English", t.English)
+	described("COMM", "zho", "Pinyin", t.Pinyin)
+	if len(t.Cover) > 0 {
+		// mime type, front cover, empty description
+		data := append([]byte{3}, "image/png"...)
+		data = append(data, 0, 3, 0)
+		writeFrame(&frames, "APIC", append(data, t.Cover...))
+	}
+	if len(t.Chapters) > 0 {
+		writeChapters(&frames, t.Title, t.Chapters)
+	}
+
+	var tag bytes.Buffer
+	tag.WriteString("ID3")
+	tag.Write([]byte{4, 0, 0})
+	tag.Write(syncsafe(frames.Len()))
+	tag.Write(frames.Bytes())
+	return tag.Bytes()
+}
+
+// writeChapters writes a CHAP frame per chapter and a top-level table of contents
+// listing them in order.
+func writeChapters(w *bytes.Buffer, title string, chapters []Chapter) {
+	toc := []byte("toc\x00")
+	toc = append(toc, 0x03, byte(len(chapters))) // top-level and ordered
+	for i, ch := range chapters {
+		id := fmt.Sprintf("chp%d", i)
+		toc = append(append(toc, id...), 0)
+
+		data := append([]byte(id), 0)
+		data = binary.BigEndian.AppendUint32(data, uint32(ch.Start.Milliseconds()))
+		data = binary.BigEndian.AppendUint32(data, uint32(ch.End.Milliseconds()))
+		// no byte offsets, the times are used
+		data = append(data, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		var sub bytes.Buffer
+		writeFrame(&sub, "TIT2", append([]byte{3}, ch.Title...))
+		if ch.Text != "" && ch.Text != ch.Title {
+			writeFrame(&sub, "TIT3", append([]byte{3}, ch.Text...))
+		}
+		writeFrame(w, "CHAP", append(data, sub.Bytes()...))
+	}
+	if title != "" {
+		var sub bytes.Buffer
+		writeFrame(&sub, "TIT2", append([]byte{3}, title...))
+		toc = append(toc, sub.Bytes()...)
+	}
+	writeFrame(w, "CTOC", toc)
+}
+
+func writeFrame(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	w.Write(syncsafe(len(data)))
+	w.Write([]byte{0, 0})
+	w.Write(data)
+}
+
+// syncsafe encodes a size with 7 bits per byte, as required by ID3v2.4.
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// WriteTags tags an audio file, replacing an existing tag.
+func WriteTags(file string, t Tags) error {
+	return writeTag(file, t.ID3())
+}
+
+// CopyTags copies the ID3 tag of an mp3 file to another audio file.
+func CopyTags(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", src, err)
+	}
+	tag := data[:len(data)-len(stripLeadingID3(data))]
+	if len(tag) == 0 {
+		return nil
+	}
+	return writeTag(dst, tag)
+}
+
+// writeTag prepends the tag to mp3 files, wav files written by Merge get it as an id3
+// chunk.
+func writeTag(file string, tag []byte) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", file, err)
+	}
+	if len(data) >= 12 && string(data[:4]) == "RIFF" {
+		data, err = withID3Chunk(data, tag)
+		if err != nil {
+			return fmt.Errorf("failed to tag file %s: %v", file, err)
+		}
+	} else {
+		data = append(tag[:len(tag):len(tag)], stripLeadingID3(data)...)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", file, err)
+	}
+	return nil
+}
+
+// ReadTags reads the text frames and the cover of the ID3v2 tag of an mp3 file or the id3
+// chunk of a wav file written by Merge. Files without a tag have empty tags.
+func ReadTags(file string) (Tags, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Tags{}, fmt.Errorf("failed to read file %s: %v", file, err)
+	}
+	tag := data[:len(data)-len(stripLeadingID3(data))]
+	if len(data) >= 12 && string(data[:4]) == "RIFF" {
+		tag = id3Chunk(data)
+	}
+	var t Tags
+	if len(tag) < 10 {
+		return t, nil
+	}
+	version := tag[3]
+	size := func(b []byte) int {
+		if version >= 4 {
+			return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+		}
+		return int(binary.BigEndian.Uint32(b))
+	}
+	for pos := 10; pos+10 <= len(tag); {
+		id := string(tag[pos : pos+4])
+		end := pos + 10 + size(tag[pos+4:pos+8])
+		if id == "\x00\x00\x00\x00" || end > len(tag) {
+			break
+		}
+		frame := tag[pos+10 : end]
+		pos = end
+		if len(frame) == 0 {
+			continue
+		}
+		switch id {
+		case "TIT2":
+			t.Title = decodeText(frame[0], frame[1:])
+		case "TALB":
+			t.Album = decodeText(frame[0], frame[1:])
+		case "TCON":
+			t.Genre = decodeText(frame[0], frame[1:])
+		case "TPE1":
+			t.Artist = decodeText(frame[0], frame[1:])
+		case "APIC":
+			t.Cover = pictureData(frame)
+		case "USLT", "COMM":
+			if len(frame) < 4 {
+				continue
+			}
+			desc, value := splitDescription(frame[0], frame[4:])
+			switch {
+			case id == "USLT":
+				t.Lyrics = value
+			case desc == "English":
+				t.English = value
+			case desc == "Pinyin":
+				t.Pinyin = value
+			}
+		}
+	}
+	return t, nil
+}
+
+// decodeText decodes latin-1, utf-16 and utf-8 text, the encodings of ID3v2.
+func decodeText(encoding byte, b []byte) string {
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			order, b = binary.LittleEndian, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			b = b[2:]
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			units = append(units, order.Uint16(b[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	case 3:
+		return strings.TrimRight(string(b), "\x00")
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimRight(string(runes), "\x00")
+}
+
+// splitDescription splits the terminated description from the value of lyrics and
+// comment frames.
+func splitDescription(encoding byte, b []byte) (string, string) {
+	terminator := []byte{0}
+	if encoding == 1 || encoding == 2 {
+		terminator = []byte{0, 0}
+	}
+	for i := 0; i+len(terminator) <= len(b); i += len(terminator) {
+		if bytes.Equal(b[i:i+len(terminator)], terminator) {
+			return decodeText(encoding, b[:i]), decodeText(encoding, b[i+len(terminator):])
+		}
+	}
+	return "", decodeText(encoding, b)
+}
+
+// pictureData returns the image of an APIC frame, after its mime type, picture type and
+// description.
+func pictureData(frame []byte) []byte {
+	mime := bytes.IndexByte(frame[1:], 0)
+	if mime == -1 || 1+mime+2 > len(frame) {
+		return nil
+	}
+	_, data := splitDescription(frame[0], frame[1+mime+2:])
+	// the image is binary, only its description is text
+	return frame[len(frame)-len(data):]
+}
+
+// id3Chunk returns the tag of the id3 chunk of a wav file.
+func id3Chunk(data []byte) []byte {
+	for pos := 12; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size
+		if end > len(data) {
+			return nil
+		}
+		if id := string(data[pos : pos+4]); id == "id3 " || id == "ID3 " {
+			return data[pos+8 : end]
+		}
+		pos = end + size%2
+	}
+	return nil
+}
+
+// withID3Chunk replaces the id3 chunk of a wav file and updates the riff size.
+func withID3Chunk(data, tag []byte) ([]byte, error) {
+	out := append([]byte{}, data[:12]...)
+	for pos := 12; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if end > len(data) {
+			end = len(data)
+		}
+		if id := string(data[pos : pos+4]); id != "id3 " && id != "ID3 " {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	if len(out) == 12 {
+		return nil, fmt.Errorf("no chunks found")
+	}
+	out = append(out, "id3 "...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(tag)))
+	out = append(out, tag...)
+	if len(tag)%2 == 1 {
+		out = append(out, 0)
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
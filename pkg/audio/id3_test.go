@@ -0,0 +1,153 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/faiface/beep"
+)
+
+func TestTagsRoundTrip(t *testing.T) {
+	// a cover larger than 2^14 bytes needs all bytes of its syncsafe frame size
+	cover := make([]byte, 200000)
+	for i := range cover {
+		cover[i] = byte(i)
+	}
+	tags := Tags{
+		Title:   "你好",
+		Album:   "第一课",
+		Genre:   "words",
+		Artist:  "zh-audio",
+		Lyrics:  "你好\nnǐ hǎo\nhello",
+		English: "hello; hi",
+		Pinyin:  "nǐ hǎo",
+		Cover:   cover,
+	}
+	format := beep.Format{SampleRate: 16000, NumChannels: 2, Precision: 2}
+	samples := make([][2]float64, 1600)
+	for _, name := range []string{"clip.mp3", "clip.wav"} {
+		file := filepath.Join(t.TempDir(), name)
+		if err := encode(file, samples, format); err != nil {
+			t.Fatal(err)
+		}
+		// tagging again replaces the tag
+		if err := WriteTags(file, Tags{Title: "旧"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteTags(file, tags); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadTags(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tags) {
+			t.Errorf("%s: read %+v, want %+v", name, got.withoutCover(), tags.withoutCover())
+		}
+		if !bytes.Equal(got.Cover, cover) {
+			t.Errorf("%s: cover of %d bytes, want %d", name, len(got.Cover), len(cover))
+		}
+		// the tagged file still decodes to the same samples
+		decoded, _, err := decodeFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) < len(samples) {
+			t.Errorf("%s: decoded %d samples, want %d", name, len(decoded), len(samples))
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := bytes.Count(data, []byte("TIT2")); c != 1 {
+			t.Errorf("%s: %d titles", name, c)
+		}
+	}
+}
+
+func (t Tags) withoutCover() Tags {
+	t.Cover = nil
+	return t
+}
+
+func TestWAVID3Chunk(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "clip.wav")
+	format := beep.Format{SampleRate: 16000, NumChannels: 2, Precision: 2}
+	if err := encodeWAV(file, make([][2]float64, 100), format); err != nil {
+		t.Fatal(err)
+	}
+	// a tag of odd length is padded to keep the chunks aligned
+	tags := Tags{Title: "好"}
+	if len(tags.ID3())%2 == 0 {
+		tags.Title = "好的"
+	}
+	if err := WriteTags(file, tags); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Errorf("riff size %d, want %d", size, len(data)-8)
+	}
+	if len(data)%2 != 0 {
+		t.Errorf("chunk not padded, file of %d bytes", len(data))
+	}
+	if chunk := id3Chunk(data); !bytes.Equal(chunk, tags.ID3()) {
+		t.Errorf("id3 chunk %q, want %q", chunk, tags.ID3())
+	}
+}
+
+func TestSyncsafe(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0, 0, 0, 0}},
+		{127, []byte{0, 0, 0, 0x7f}},
+		{128, []byte{0, 0, 1, 0}},
+		{200000, []byte{0, 0x0c, 0x1a, 0x40}},
+		{1<<28 - 1, []byte{0x7f, 0x7f, 0x7f, 0x7f}},
+	}
+	for _, tt := range tests {
+		if got := syncsafe(tt.n); !bytes.Equal(got, tt.want) {
+			t.Errorf("syncsafe(%d) = %x, want %x", tt.n, got, tt.want)
+		}
+	}
+	// the sizes of the tag and its frames exclude their headers
+	tag := Tags{Title: "你好"}.ID3()
+	if got := int(tag[9]); got != len(tag)-10 {
+		t.Errorf("tag size %d, want %d", got, len(tag)-10)
+	}
+	if got, want := int(tag[17]), len("你好")+1; string(tag[10:14]) != "TIT2" || got != want {
+		t.Errorf("frame %s of size %d, want TIT2 of %d", tag[10:14], got, want)
+	}
+}
+
+func TestReadTagsV23(t *testing.T) {
+	// ID3v2.3 with plain sizes and utf-16 text, as written by other taggers
+	title := []byte{1, 0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune("你好")) {
+		title = binary.LittleEndian.AppendUint16(title, u)
+	}
+	frame := append([]byte("TIT2"), binary.BigEndian.AppendUint32(nil, uint32(len(title)))...)
+	frame = append(append(frame, 0, 0), title...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0}, syncsafe(len(frame))...)
+	file := filepath.Join(t.TempDir(), "clip.mp3")
+	if err := os.WriteFile(file, append(tag, frame...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTags(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "你好" {
+		t.Errorf("title %q, want 你好", got.Title)
+	}
+}
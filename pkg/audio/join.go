@@ -0,0 +1,121 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/exp/slog"
+)
+
+// JoinMP3 concatenates mp3 files frame by frame without re-encoding. ID3 tags of the
+// inputs are dropped, so the frames of all files form a single stream.
+func JoinMP3(outputFile string, inputFiles []string) error {
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", outputFile, err)
+	}
+	defer out.Close()
+	if err := joinMP3(out, inputFiles); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", outputFile, err)
+	}
+	return nil
+}
+
+// joinMP3 writes the frames of the mp3 files to w, one file at a time.
+func joinMP3(w io.Writer, inputFiles []string) error {
+	for _, file := range inputFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %v", file, err)
+		}
+		if _, err := w.Write(stripID3(data)); err != nil {
+			return fmt.Errorf("failed to write frames of %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// stripID3 removes a leading ID3v2 and a trailing ID3v1 tag.
+func stripID3(data []byte) []byte {
+	data = stripLeadingID3(data)
+	if len(data) >= 128 && string(data[len(data)-128:len(data)-125]) == "TAG" {
+		data = data[:len(data)-128]
+	}
+	return data
+}
+
+func stripLeadingID3(data []byte) []byte {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return data
+	}
+	// the size is a syncsafe integer, 7 bits per byte
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	end := 10 + size
+	if data[5]&0x10 != 0 { // footer present
+		end += 10
+	}
+	if end > len(data) {
+		return data
+	}
+	return data[end:]
+}
+
+// Finish renders every audio file of dir into outDir, applying the render options. This
+// adds the trailing pad and end-of-item beep to files synthesized in one piece. There are
+// no segments to write subtitles for in such files, tags are copied from the input.
+func Finish(dir, outDir string, opts RenderOptions) ([]string, error) {
+	opts.Subtitles = false
+	tags := opts.Tags
+	opts.Tags = nil
+	files, err := AudioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	var finished []string
+	for _, file := range files {
+		c := NewConcatenatorWithOptions(opts)
+		c.AddWithPause(file, 0)
+		outPath := OutputPath(filepath.Join(outDir, filepath.Base(file)))
+		if err := c.Merge(outPath); err != nil {
+			return finished, err
+		}
+		if tags != nil {
+			if err := CopyTags(file, outPath); err != nil {
+				return finished, err
+			}
+		}
+		finished = append(finished, outPath)
+	}
+	slog.Info("finished audio", "dir", outDir, "files", len(finished))
+	return finished, nil
+}
+
+// Join concatenates all audio files of dir in name order into a single loop. The loop
+// gets the extension of the output format, see OutputPath.
+func Join(outputFile, dir string, pause int) error {
+	files, err := AudioFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no audio files to join in %s", dir)
+	}
+	outputFile = OutputPath(outputFile)
+	c := NewConcatenator()
+	for _, file := range files {
+		c.AddWithPause(file, pause)
+	}
+	if err := c.Merge(outputFile); err != nil {
+		return err
+	}
+	slog.Info("joined audio", "path", outputFile, "files", len(files))
+	return nil
+}
@@ -0,0 +1,284 @@
+package audio
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sahilm/fuzzy"
+	"golang.org/x/exp/slog"
+)
+
+//go:embed library.html
+var libraryFS embed.FS
+
+var libraryTemplate = template.Must(template.New("library.html").Funcs(template.FuncMap{
+	"seconds": func(d time.Duration) string { return fmt.Sprintf("%.3f", d.Seconds()) },
+	"clock":   func(d time.Duration) string { return lrcTime(d) },
+}).ParseFS(libraryFS, "library.html"))
+
+// Loop is an audio file found in the library dirs.
+type Loop struct {
+	ID    string
+	Path  string
+	Name  string
+	Title string
+	Mode  string
+	Date  time.Time
+	Size  int64
+	// from the manifest of the run that wrote the loop, falls back to the id3 lyrics
+	Segments   []Segment
+	Transcript string
+}
+
+// Library indexes the loops of the output and loop cache dirs. Mode, date and the
+// transcripts of the segments are taken from the run manifests of the cache.
+type Library struct {
+	Dirs     []string
+	CacheDir string
+
+	mu    sync.Mutex
+	loops []*Loop
+	byID  map[string]*Loop
+	// tags of the scanned files by path, reread when a file changes
+	tags map[string]scannedTags
+}
+
+type scannedTags struct {
+	modTime time.Time
+	size    int64
+	tags    Tags
+}
+
+// clipDirs are the dirs the synthesizers write the clips of a run to, they hold the
+// parts of the loops rather than loops.
+var clipDirs = map[string]bool{"zh": true, "en": true}
+
+// Scan indexes all loops, the newest first. The clip dirs of runs are skipped.
+func (l *Library) Scan() error {
+	outputs := make(map[string]*ManifestOutput)
+	runs := make(map[string]*Manifest)
+	if l.CacheDir != "" {
+		manifests, err := LoadManifests(l.CacheDir)
+		if err != nil {
+			return err
+		}
+		// oldest first, later runs overwrite earlier ones
+		for _, m := range manifests {
+			for _, o := range m.Outputs {
+				outputs[o.File] = o
+				runs[o.File] = m
+			}
+		}
+	}
+
+	var loops []*Loop
+	for _, dir := range l.Dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != dir && clipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isAudioFile(path) && filepath.Ext(path) != ".m4b" {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256([]byte(path))
+			name := filepath.Base(path)
+			loop := &Loop{
+				ID:   hex.EncodeToString(sum[:8]),
+				Path: path,
+				Name: strings.TrimSuffix(name, filepath.Ext(name)),
+				Mode: filepath.Base(filepath.Dir(path)),
+				Date: info.ModTime(),
+				Size: info.Size(),
+			}
+			if m, ok := runs[name]; ok {
+				loop.Mode = m.Mode
+				loop.Date = m.Created
+				loop.Segments = outputs[name].Segments
+			}
+			tags := l.readTags(path, info)
+			loop.Title = tags.Title
+			loop.Transcript = tags.Lyrics
+			if loop.Title == "" {
+				loop.Title = loop.Name
+			}
+			loops = append(loops, loop)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to scan %s: %v", dir, err)
+		}
+	}
+	sort.SliceStable(loops, func(i, j int) bool {
+		if !loops[i].Date.Equal(loops[j].Date) {
+			return loops[i].Date.After(loops[j].Date)
+		}
+		return loops[i].Name < loops[j].Name
+	})
+
+	byID := make(map[string]*Loop, len(loops))
+	for _, loop := range loops {
+		byID[loop.ID] = loop
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loops, l.byID = loops, byID
+	return nil
+}
+
+func (l *Library) readTags(path string, info fs.FileInfo) Tags {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tags == nil {
+		l.tags = make(map[string]scannedTags)
+	}
+	if t, ok := l.tags[path]; ok && t.modTime.Equal(info.ModTime()) && t.size == info.Size() {
+		return t.tags
+	}
+	tags, err := ReadTags(path)
+	if err != nil {
+		slog.Warn("failed to read tags", "path", path, "err", err)
+	}
+	l.tags[path] = scannedTags{modTime: info.ModTime(), size: info.Size(), tags: tags}
+	return tags
+}
+
+// searchable matches queries against title, name and transcript of the loops.
+type searchable []*Loop
+
+func (s searchable) String(i int) string {
+	return s[i].Title + " " + s[i].Name + " " + s[i].Transcript
+}
+
+func (s searchable) Len() int { return len(s) }
+
+// Search returns the loops matching the query fuzzily, the best matches first.
+func (l *Library) Search(query string) []*Loop {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if query == "" {
+		return l.loops
+	}
+	var found []*Loop
+	for _, m := range fuzzy.FindFrom(query, searchable(l.loops)) {
+		found = append(found, l.loops[m.Index])
+	}
+	return found
+}
+
+// LibraryGroup lists the loops of a day and mode.
+type LibraryGroup struct {
+	Date  string
+	Mode  string
+	Loops []*Loop
+}
+
+func groupLoops(loops []*Loop) []*LibraryGroup {
+	var groups []*LibraryGroup
+	index := make(map[string]*LibraryGroup)
+	for _, loop := range loops {
+		date := loop.Date.Format("2006-01-02")
+		g, ok := index[date+"/"+loop.Mode]
+		if !ok {
+			g = &LibraryGroup{Date: date, Mode: loop.Mode}
+			index[date+"/"+loop.Mode] = g
+			groups = append(groups, g)
+		}
+		g.Loops = append(g.Loops, loop)
+	}
+	return groups
+}
+
+// Handler serves the web ui:
+//
+//	GET /                 lessons by date and mode, ?q= searches
+//	GET /loops/{id}       player with the transcript and an A-B loop per segment
+//	GET /audio/{id}       the audio file, supports range requests
+func (l *Library) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", l.index)
+	mux.HandleFunc("GET /loops/{id}", l.player)
+	mux.HandleFunc("GET /audio/{id}", l.audio)
+	return mux
+}
+
+func (l *Library) index(w http.ResponseWriter, r *http.Request) {
+	// rescan so that loops of new runs show up without a restart
+	if err := l.Scan(); err != nil {
+		slog.Error("failed to scan library", "err", err)
+	}
+	query := r.URL.Query().Get("q")
+	l.render(w, map[string]any{
+		"Query":  query,
+		"Groups": groupLoops(l.Search(query)),
+	})
+}
+
+func (l *Library) player(w http.ResponseWriter, r *http.Request) {
+	loop, ok := l.loop(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	l.render(w, map[string]any{"Loop": loop})
+}
+
+func (l *Library) audio(w http.ResponseWriter, r *http.Request) {
+	loop, ok := l.loop(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(loop.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	typ := "audio/mp4"
+	if isAudioFile(loop.Path) {
+		typ, _, _ = audioType(loop.Path)
+	}
+	w.Header().Set("Content-Type", typ)
+	// ServeContent answers range requests
+	http.ServeContent(w, r, filepath.Base(loop.Path), info.ModTime(), f)
+}
+
+func (l *Library) loop(id string) (*Loop, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loop, ok := l.byID[id]
+	return loop, ok
+}
+
+func (l *Library) render(w http.ResponseWriter, data map[string]any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := libraryTemplate.Execute(w, data); err != nil {
+		slog.Error("failed to render library", "err", err)
+	}
+}
@@ -0,0 +1,174 @@
+package audio
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLibrary writes the loops of a run to an output dir, the raw clips of the run
+// to its clip dir and the manifest of the run to a cache dir.
+func newTestLibrary(t *testing.T) *Library {
+	t.Helper()
+	out, cacheDir := t.TempDir(), t.TempDir()
+	peep, err := os.ReadFile("../../peep.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"zh/好.mp3", "en/good.mp3", "concat/你好.mp3", "words.mp3", "words_audiobook.m4b", "words.srt"} {
+		path := filepath.Join(out, file)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, peep, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteTags(filepath.Join(out, "concat/你好.mp3"), Tags{Title: "你好", Lyrics: "你好\nnǐ hǎo\nhello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the later run overwrites the output of the earlier one
+	for i, mode := range []string{"cloze", "words"} {
+		m := NewManifest(mode)
+		m.Created = time.Date(2024, 5, 1+i, 12, 0, 0, 0, time.UTC)
+		m.AddOutput("你好.mp3", []Segment{
+			{Start: 0, End: time.Second, SegmentText: SegmentText{Chinese: "你好", Pinyin: "nǐ hǎo", English: "hello"}},
+			{Start: time.Second, End: 1500 * time.Millisecond},
+			{Start: 1500 * time.Millisecond, End: 2 * time.Second, SegmentText: SegmentText{Chinese: "好"}},
+		})
+		if _, err := m.Save(cacheDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := &Library{Dirs: []string{out, filepath.Join(out, "missing")}, CacheDir: cacheDir}
+	if err := l.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLibraryScan(t *testing.T) {
+	l := newTestLibrary(t)
+	var names []string
+	for _, loop := range l.Search("") {
+		names = append(names, loop.Name)
+	}
+	// the loops without a manifest are newer than the run of the manifest
+	sort.Strings(names[:2])
+	if want := []string{"words", "words_audiobook", "你好"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("loops %q, want %q", names, want)
+	}
+
+	loop := l.Search("")[2]
+	if loop.Title != "你好" || loop.Mode != "words" || !loop.Date.Equal(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("loop %+v", loop)
+	}
+	if loop.Transcript != "你好\nnǐ hǎo\nhello" {
+		t.Errorf("transcript %q", loop.Transcript)
+	}
+	// segments without a transcript are dropped by the manifest
+	want := []Segment{
+		{Start: 0, End: time.Second, SegmentText: SegmentText{Chinese: "你好", Pinyin: "nǐ hǎo", English: "hello"}},
+		{Start: 1500 * time.Millisecond, End: 2 * time.Second, SegmentText: SegmentText{Chinese: "好"}},
+	}
+	if !reflect.DeepEqual(loop.Segments, want) {
+		t.Errorf("segments %+v, want %+v", loop.Segments, want)
+	}
+	if found, ok := l.loop(loop.ID); !ok || found != loop {
+		t.Errorf("loop %s not found by id", loop.ID)
+	}
+
+	// untagged loops are named after their file and grouped by their dir
+	for _, loop := range l.Search("")[:2] {
+		if loop.Title != loop.Name || loop.Mode != filepath.Base(filepath.Dir(loop.Path)) || loop.Segments != nil {
+			t.Errorf("untagged loop %+v", loop)
+		}
+	}
+}
+
+func TestLibrarySearch(t *testing.T) {
+	l := newTestLibrary(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "hello", want: []string{"你好"}},
+		{query: "nǐ", want: []string{"你好"}},
+		{query: "你", want: []string{"你好"}},
+		{query: "wrds", want: []string{"words", "words_audiobook"}},
+		{query: "audiobook", want: []string{"words_audiobook"}},
+		{query: "goodbye"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var names []string
+			for _, loop := range l.Search(tt.query) {
+				names = append(names, loop.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("found %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestLibraryHandler(t *testing.T) {
+	l := newTestLibrary(t)
+	ids := make(map[string]string)
+	for _, loop := range l.Search("") {
+		ids[loop.Name] = loop.ID
+	}
+	srv := httptest.NewServer(l.Handler())
+	defer srv.Close()
+
+	get := func(path string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("/?q=hello", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "/loops/"+ids["你好"]) || strings.Contains(body, ids["words"]) {
+		t.Errorf("search %d:\n%s", resp.StatusCode, body)
+	}
+	resp, body = get("/loops/"+ids["你好"], nil)
+	for _, s := range []string{`data-start="0.000" data-end="1.000"`, `data-start="1.500" data-end="2.000"`, "nǐ hǎo", "/audio/" + ids["你好"]} {
+		if !strings.Contains(body, s) {
+			t.Errorf("player without %s:\n%s", s, body)
+		}
+	}
+	if resp, _ = get("/loops/unknown", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown loop %d", resp.StatusCode)
+	}
+
+	for name, typ := range map[string]string{"你好": "audio/mpeg", "words_audiobook": "audio/mp4"} {
+		resp, body = get("/audio/"+ids[name], http.Header{"Range": {"bytes=0-9"}})
+		if resp.StatusCode != http.StatusPartialContent || len(body) != 10 || resp.Header.Get("Content-Type") != typ {
+			t.Errorf("audio of %s: %d, %d bytes of %s", name, resp.StatusCode, len(body), resp.Header.Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/faiface/beep"
+)
+
+// LoudnessProfile describes the target level of an export. Azure, GCP and the cue sounds
+// come at different levels, every clip is brought to the same integrated loudness.
+type LoudnessProfile struct {
+	Name string
+	// integrated loudness in LUFS each clip is normalized to
+	Target float64
+	// sample peak ceiling in dBFS the limiter keeps the normalized clip below
+	Ceiling float64
+}
+
+// Profiles are the predefined export profiles. Earbuds get more headroom, in the car
+// the drills need to compete with road noise.
+var Profiles = map[string]*LoudnessProfile{
+	"default": {Name: "default", Target: -16, Ceiling: -1.5},
+	"earbuds": {Name: "earbuds", Target: -18, Ceiling: -1},
+	"car":     {Name: "car", Target: -13, Ceiling: -1},
+}
+
+// LookupProfile returns the predefined profile by name, an empty name means no normalization.
+func LookupProfile(name string) (*LoudnessProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(Profiles))
+		for n := range Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown loudness profile %s, use one of: %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// limiter release time
+const releaseSeconds = 0.05
+
+// Normalize applies the gain that brings samples to the target loudness and limits peaks
+// above the ceiling. Silent clips are returned unchanged.
+func (p *LoudnessProfile) Normalize(samples [][2]float64, sr beep.SampleRate) [][2]float64 {
+	loudness := IntegratedLoudness(samples, sr)
+	if math.IsInf(loudness, -1) {
+		return samples
+	}
+	gain := math.Pow(10, (p.Target-loudness)/20)
+	ceiling := math.Pow(10, p.Ceiling/20)
+	release := 1 - math.Exp(-1/(releaseSeconds*float64(sr)))
+
+	out := make([][2]float64, len(samples))
+	reduction := 1.0
+	for i, s := range samples {
+		peak := math.Max(math.Abs(s[0]), math.Abs(s[1])) * gain
+		if peak*reduction > ceiling {
+			// instant attack, the limiter never lets a sample pass above the ceiling
+			reduction = ceiling / peak
+		} else {
+			reduction += (1 - reduction) * release
+			if peak*reduction > ceiling {
+				reduction = ceiling / peak
+			}
+		}
+		out[i] = [2]float64{s[0] * gain * reduction, s[1] * gain * reduction}
+	}
+	return out
+}
+
+// gating as defined by ITU-R BS.1770 / EBU R128
+const (
+	blockSeconds  = 0.4
+	blockOverlap  = 0.75
+	absoluteGate  = -70.0
+	relativeGate  = -10.0
+	loudnessShift = -0.691
+)
+
+// IntegratedLoudness measures the gated loudness of samples in LUFS. It returns -Inf for
+// silence. Clips shorter than one gating block are measured as a single block.
+func IntegratedLoudness(samples [][2]float64, sr beep.SampleRate) float64 {
+	if len(samples) == 0 {
+		return math.Inf(-1)
+	}
+	// mono clips are decoded to two identical channels but must be measured once
+	channels := 1
+	for _, s := range samples {
+		if s[0] != s[1] {
+			channels = 2
+			break
+		}
+	}
+
+	weighted := kWeight(samples, float64(sr))
+	blockLen := int(blockSeconds * float64(sr))
+	step := int(float64(blockLen) * (1 - blockOverlap))
+	if blockLen > len(weighted) {
+		blockLen = len(weighted)
+		step = blockLen
+	}
+
+	var powers []float64
+	for start := 0; start+blockLen <= len(weighted); start += step {
+		var sum float64
+		for _, s := range weighted[start : start+blockLen] {
+			sum += s[0] * s[0]
+			if channels == 2 {
+				sum += s[1] * s[1]
+			}
+		}
+		powers = append(powers, sum/float64(blockLen))
+	}
+
+	gated := gate(powers, absoluteGate)
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+	gated = gate(gated, loudnessOf(mean(gated))+relativeGate)
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+	return loudnessOf(mean(gated))
+}
+
+func loudnessOf(power float64) float64 {
+	return loudnessShift + 10*math.Log10(power)
+}
+
+func gate(powers []float64, threshold float64) []float64 {
+	var out []float64
+	for _, p := range powers {
+		if p > 0 && loudnessOf(p) > threshold {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func mean(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// kWeight applies the two stage k-weighting filter, a high shelf modelling the head
+// followed by a high pass. Coefficients are derived for the given sample rate.
+func kWeight(samples [][2]float64, fs float64) [][2]float64 {
+	// stage 1, high shelf
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// stage 2, high pass
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return highPass.apply(shelf.apply(samples))
+}
+
+func (f biquad) apply(samples [][2]float64) [][2]float64 {
+	out := make([][2]float64, len(samples))
+	for ch := 0; ch < 2; ch++ {
+		var x1, x2, y1, y2 float64
+		for i, s := range samples {
+			x := s[ch]
+			y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+			x2, x1 = x1, x
+			y2, y1 = y1, y
+			out[i][ch] = y
+		}
+	}
+	return out
+}
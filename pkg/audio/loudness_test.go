@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/beep"
+)
+
+const testRate = beep.SampleRate(48000)
+
+// sine returns a 1kHz sine with a peak of dbfs, the right channel is phase shifted for
+// stereo and equals the left one for mono.
+func sine(dbfs float64, seconds float64, stereo bool) [][2]float64 {
+	amp := math.Pow(10, dbfs/20)
+	shift := 0.0
+	if stereo {
+		shift = math.Pi / 2
+	}
+	out := make([][2]float64, int(seconds*float64(testRate)))
+	for i := range out {
+		x := 2 * math.Pi * 1000 * float64(i) / float64(testRate)
+		out[i] = [2]float64{amp * math.Sin(x), amp * math.Sin(x+shift)}
+	}
+	return out
+}
+
+func peakOf(samples [][2]float64) float64 {
+	var peak float64
+	for _, s := range samples {
+		peak = math.Max(peak, math.Max(math.Abs(s[0]), math.Abs(s[1])))
+	}
+	return 20 * math.Log10(peak)
+}
+
+func TestIntegratedLoudness(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples [][2]float64
+		want    float64
+	}{
+		// EBU Tech 3341 case 1, a stereo sine at -23dBFS measures -23 LUFS
+		{"stereo", sine(-23, 10, true), -23},
+		{"stereo loud", sine(-3, 10, true), -3},
+		// mono clips are measured once, a channel less than stereo
+		{"mono", sine(-23, 10, false), -26},
+		{"short", sine(-20, 0.2, true), -20},
+		// silence and sound below the absolute gate do not count
+		{"silence after", append(sine(-23, 20, true), make([][2]float64, 5*testRate)...), -23},
+		{"below absolute gate", append(sine(-23, 20, true), sine(-75, 5, true)...), -23},
+		// quiet parts more than 10 LU below the loudness are gated relatively
+		{"below relative gate", append(sine(-23, 20, true), sine(-40, 5, true)...), -23},
+	}
+	for _, tt := range tests {
+		if got := IntegratedLoudness(tt.samples, testRate); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("%s: %.2f LUFS, want %.2f", tt.name, got, tt.want)
+		}
+	}
+	if got := IntegratedLoudness(make([][2]float64, testRate), testRate); !math.IsInf(got, -1) {
+		t.Errorf("silence: %.2f LUFS, want -Inf", got)
+	}
+	if got := IntegratedLoudness(nil, testRate); !math.IsInf(got, -1) {
+		t.Errorf("empty: %.2f LUFS, want -Inf", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// a quiet sine with a click every 500ms, the gain lifts the clicks above every ceiling
+	clicks := sine(-30, 5, true)
+	for i := 0; i < len(clicks); i += int(testRate) / 2 {
+		clicks[i] = [2]float64{0.25, -0.25}
+	}
+	tests := []struct {
+		name    string
+		samples [][2]float64
+		// the limiter takes some loudness off the clicks
+		tolerance float64
+	}{
+		{"quiet", sine(-40, 5, true), 0.1},
+		{"loud", sine(-6, 5, true), 0.1},
+		{"mono", sine(-30, 5, false), 0.1},
+		{"clicks", clicks, 0.5},
+	}
+	for _, name := range []string{"default", "earbuds", "car"} {
+		p := Profiles[name]
+		for _, tt := range tests {
+			out := p.Normalize(tt.samples, testRate)
+			if got := IntegratedLoudness(out, testRate); math.Abs(got-p.Target) > tt.tolerance {
+				t.Errorf("%s %s: %.2f LUFS, want %.2f", name, tt.name, got, p.Target)
+			}
+			if peak := peakOf(out); peak > p.Ceiling+1e-9 {
+				t.Errorf("%s %s: peak %.2f dBFS above the ceiling %.2f", name, tt.name, peak, p.Ceiling)
+			}
+		}
+	}
+	silence := make([][2]float64, testRate)
+	if out := Profiles["default"].Normalize(silence, testRate); peakOf(out) != math.Inf(-1) {
+		t.Error("silence was amplified")
+	}
+}
+
+func TestLookupProfile(t *testing.T) {
+	if p, err := LookupProfile(""); p != nil || err != nil {
+		t.Errorf("empty name: %v, %v", p, err)
+	}
+	if p, err := LookupProfile("car"); err != nil || p.Target != -13 {
+		t.Errorf("car: %v, %v", p, err)
+	}
+	if _, err := LookupProfile("loud"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
@@ -0,0 +1,183 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const manifestDir = ".manifests"
+
+type ManifestEntry struct {
+	Key      string `json:"key"` // filename in the cache dir
+	Provider string `json:"provider,omitempty"`
+	Voice    string `json:"voice,omitempty"`
+	Hits     int    `json:"hits"`
+	Misses   int    `json:"misses"`
+}
+
+// ManifestOutput is a loop written by a run with the transcript of its segments.
+type ManifestOutput struct {
+	File     string    `json:"file"` // file name of the loop
+	Segments []Segment `json:"segments"`
+}
+
+// Manifest records which cache entries a run used, whether they were found in the cache
+// and which provider and voice synthesized the missing ones. It also lists the loops the
+// run wrote.
+type Manifest struct {
+	Mode    string            `json:"mode"`
+	Created time.Time         `json:"created"`
+	Entries []*ManifestEntry  `json:"entries"`
+	Outputs []*ManifestOutput `json:"outputs,omitempty"`
+
+	mu    sync.Mutex
+	index map[string]*ManifestEntry
+}
+
+func NewManifest(mode string) *Manifest {
+	return &Manifest{
+		Mode:    mode,
+		Created: time.Now(),
+		index:   make(map[string]*ManifestEntry),
+	}
+}
+
+func (m *Manifest) entry(path string) *ManifestEntry {
+	key := filepath.Base(path)
+	e, ok := m.index[key]
+	if !ok {
+		e = &ManifestEntry{Key: key}
+		m.index[key] = e
+		m.Entries = append(m.Entries, e)
+	}
+	return e
+}
+
+// AddLookup records a cache lookup. Methods on a nil manifest are no-ops so that
+// components can record unconditionally.
+func (m *Manifest) AddLookup(path string, hit bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(path)
+	if hit {
+		e.Hits++
+	} else {
+		e.Misses++
+	}
+}
+
+// SetSource records the provider and voice an entry was synthesized with.
+func (m *Manifest) SetSource(path, provider, voice string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(path)
+	e.Provider = provider
+	e.Voice = voice
+}
+
+// Missed returns the keys of the entries that were not found in the cache.
+func (m *Manifest) Missed() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for _, e := range m.Entries {
+		if e.Misses > 0 {
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+// AddOutput records a loop and the segments of its timeline that have a transcript.
+func (m *Manifest) AddOutput(path string, timeline []Segment) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &ManifestOutput{File: filepath.Base(path)}
+	for _, s := range timeline {
+		if !s.IsEmpty() {
+			out.Segments = append(out.Segments, s)
+		}
+	}
+	for i, o := range m.Outputs {
+		if o.File == out.File {
+			m.Outputs[i] = out
+			return
+		}
+	}
+	m.Outputs = append(m.Outputs, out)
+}
+
+// Save writes the manifest to the manifest dir of the cache.
+func (m *Manifest) Save(cacheDir string) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	dir := filepath.Join(cacheDir, manifestDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.json", m.Created.Format("2006-01-02T15-04-05"), m.Mode))
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// LoadManifests returns all manifests of the cache dir, oldest first.
+func LoadManifests(cacheDir string) ([]*Manifest, error) {
+	files, err := filepath.Glob(filepath.Join(cacheDir, manifestDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifests []*Manifest
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", file, err)
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal manifest %s: %w", file, err)
+		}
+		manifests = append(manifests, &m)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].Created.Before(manifests[j].Created)
+	})
+	return manifests, nil
+}
+
+var voiceRe = regexp.MustCompile(`<voice name="([^"]+)"`)
+
+// voicesOf returns the distinct voices used in an ssml query.
+func voicesOf(query string) string {
+	var voices []string
+	for _, m := range voiceRe.FindAllStringSubmatch(query, -1) {
+		if !contains(voices, m[1]) {
+			voices = append(voices, m[1])
+		}
+	}
+	return strings.Join(voices, ",")
+}
@@ -0,0 +1,183 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/faiface/beep"
+)
+
+// the audio of m4b files is stored in chunks of one second
+const m4bChunk = 1
+
+// writeM4B writes 16 bit little endian stereo pcm read from the file pcm into an mp4
+// container with the chapters as a nero chapter atom, which audiobook players read. There
+// is no aac encoder at hand, pcm keeps the files large but lossless.
+func writeM4B(outputFile, pcm string, sr beep.SampleRate, title string, chapters []Chapter) error {
+	if len(chapters) > 255 {
+		return fmt.Errorf("too many chapters: %d, at most 255 are supported", len(chapters))
+	}
+	in, err := os.Open(pcm)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size()+8 > math.MaxUint32 {
+		return fmt.Errorf("audio too long for an m4b file")
+	}
+	n := int(info.Size() / 4)
+
+	ftyp := box("ftyp", []byte("M4B \x00\x00\x02\x00M4B M4A mp42isom"))
+	// the sample table holds absolute offsets into the file, its size does not depend on
+	// them so the movie box is built twice
+	moov := m4bMovie(n, int(sr), 0, title, chapters)
+	offset := len(ftyp) + len(moov) + 8
+	moov = m4bMovie(n, int(sr), offset, title, chapters)
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer out.Close()
+	mdat := binary.BigEndian.AppendUint32(nil, uint32(8+n*4))
+	mdat = append(mdat, "mdat"...)
+	for _, b := range [][]byte{ftyp, moov, mdat} {
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+	}
+	if _, err := io.CopyN(out, in, int64(n*4)); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	return out.Close()
+}
+
+// appendPCM appends the samples as 16 bit little endian stereo pcm, as stored in m4b files.
+func appendPCM(w io.Writer, samples [][2]float64) error {
+	b := make([]byte, 0, len(samples)*4)
+	for _, s := range samples {
+		b = binary.LittleEndian.AppendUint16(b, uint16(toInt16(s[0])))
+		b = binary.LittleEndian.AppendUint16(b, uint16(toInt16(s[1])))
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func m4bMovie(n, sr, offset int, title string, chapters []Chapter) []byte {
+	durationMs := uint32(int64(n) * 1000 / int64(sr))
+
+	mvhd := fullBox("mvhd", 0, 0,
+		u32(0), u32(0), u32(1000), u32(durationMs),
+		u32(0x00010000), u16(0x0100), make([]byte, 10),
+		matrix(), make([]byte, 24), u32(2))
+	tkhd := fullBox("tkhd", 0, 3,
+		u32(0), u32(0), u32(1), u32(0), u32(durationMs), make([]byte, 8),
+		u16(0), u16(0), u16(0x0100), u16(0), matrix(), u32(0), u32(0))
+	mdhd := fullBox("mdhd", 0, 0,
+		u32(0), u32(0), u32(uint32(sr)), u32(uint32(n)), u16(0x55c4), u16(0)) // und
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte("soun"), make([]byte, 12), []byte("SoundHandler\x00"))
+
+	// little endian 16 bit stereo pcm
+	sowt := box("sowt",
+		make([]byte, 6), u16(1),
+		u16(0), u16(0), u32(0),
+		u16(2), u16(16), u16(0), u16(0), u32(uint32(sr)<<16))
+	stsd := fullBox("stsd", 0, 0, u32(1), sowt)
+	stts := fullBox("stts", 0, 0, u32(1), u32(uint32(n)), u32(1))
+	stsz := fullBox("stsz", 0, 0, u32(4), u32(uint32(n)))
+
+	perChunk := sr * m4bChunk
+	chunks := (n + perChunk - 1) / perChunk
+	stscEntries := [][]byte{u32(1), u32(uint32(perChunk)), u32(1)}
+	count := 1
+	if last := n - (chunks-1)*perChunk; chunks > 1 && last != perChunk {
+		stscEntries = append(stscEntries, u32(uint32(chunks)), u32(uint32(last)), u32(1))
+		count++
+	}
+	stsc := fullBox("stsc", 0, 0, append([][]byte{u32(uint32(count))}, stscEntries...)...)
+	offsets := [][]byte{u32(uint32(chunks))}
+	for i := 0; i < chunks; i++ {
+		offsets = append(offsets, u32(uint32(offset+i*perChunk*4)))
+	}
+	stco := fullBox("stco", 0, 0, offsets...)
+
+	stbl := box("stbl", stsd, stts, stsc, stsz, stco)
+	dinf := box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+	minf := box("minf", fullBox("smhd", 0, 0, u16(0), u16(0)), dinf, stbl)
+	trak := box("trak", tkhd, box("mdia", mdhd, hdlr, minf))
+
+	// nero chapters, start times in units of 100ns
+	chpl := [][]byte{u32(0), {byte(len(chapters))}}
+	for _, ch := range chapters {
+		name := ch.Title
+		if ch.Text != "" && ch.Text != ch.Title {
+			name += " - " + ch.Text
+		}
+		name = truncateUTF8(name, 255)
+		chpl = append(chpl, u64(uint64(ch.Start/100)), []byte{byte(len(name))}, []byte(name))
+	}
+	udta := [][]byte{fullBox("chpl", 1, 0, chpl...)}
+	if title != "" {
+		// itunes metadata with the title of the book
+		data := fullBox("data", 0, 1, u32(0), []byte(title))
+		meta := fullBox("meta", 0, 0,
+			fullBox("hdlr", 0, 0, u32(0), []byte("mdir"), []byte("appl"), make([]byte, 9)),
+			box("ilst", box("\xa9nam", data), box("\xa9alb", data)))
+		udta = append(udta, meta)
+	}
+	return box("moov", mvhd, trak, box("udta", udta...))
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := u32(uint32(version)<<24 | flags)
+	return box(typ, append([][]byte{header}, payload...)...)
+}
+
+// matrix is the identity transformation of movie and track headers.
+func matrix() []byte {
+	var b []byte
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b = append(b, u32(v)...)
+	}
+	return b
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	var cut int
+	for i := range s {
+		if i > n {
+			break
+		}
+		cut = i
+	}
+	return s[:cut]
+}
@@ -0,0 +1,405 @@
+package audio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	podcastIndex = "podcast.json"
+	podcastFeed  = "feed.xml"
+	episodeDir   = "episodes"
+)
+
+// Podcast is a feed of published runs kept in a directory. The episodes are recorded in
+// podcast.json, feed.xml is generated from it on every save so that the directory can
+// be uploaded to any static host.
+type Podcast struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Author      string `json:"author"`
+	Language    string `json:"language"`
+	// url the directory is served at, enclosure urls are relative to it
+	BaseURL string `json:"base_url"`
+	// optional, url of the cover image of the feed
+	Image    string     `json:"image,omitempty"`
+	Episodes []*Episode `json:"episodes"`
+}
+
+type Episode struct {
+	GUID      string        `json:"guid"`
+	Title     string        `json:"title"`
+	File      string        `json:"file"` // relative to the podcast dir
+	Type      string        `json:"type"`
+	Size      int64         `json:"size"`
+	Duration  time.Duration `json:"duration"`
+	Published time.Time     `json:"published"`
+	Notes     string        `json:"notes"` // the transcript
+}
+
+// LoadPodcast reads the podcast of dir, a new podcast is returned if there is none yet.
+func LoadPodcast(dir string) (*Podcast, error) {
+	data, err := os.ReadFile(filepath.Join(dir, podcastIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Podcast{
+			Title:       "zh-audio loops",
+			Description: "Daily chinese audio loops",
+			Author:      "zh-audio",
+			Language:    "zh-cn",
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read podcast: %v", err)
+	}
+	var p Podcast
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal podcast: %v", err)
+	}
+	return &p, nil
+}
+
+// Save writes podcast.json and feed.xml.
+func (p *Podcast) Save(dir string) error {
+	if p.BaseURL == "" {
+		return fmt.Errorf("the podcast needs a base url for the enclosures")
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, podcastIndex), data); err != nil {
+		return err
+	}
+	feed, err := p.RSS()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, podcastFeed), feed)
+}
+
+// PublishRun adds the loops of a run dir as a single episode with a chapter per loop, or
+// as an episode per loop. GUIDs are derived from the run and loop names, publishing a
+// run again replaces its episodes. Episodes are mp3, podcast clients reject wav, so wav
+// loops and single episodes of a run are encoded as mp3.
+func (p *Podcast) PublishRun(dir, runDir, run string, perLoop bool) ([]*Episode, error) {
+	files, err := AudioFiles(runDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audio files to publish in %s", runDir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, episodeDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	var published []*Episode
+	if perLoop {
+		for _, file := range files {
+			tags, err := ReadTags(file)
+			if err != nil {
+				return published, err
+			}
+			name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			title := tags.Title
+			if title == "" {
+				title = name
+			}
+			episode, err := asMP3(file, tags)
+			if err != nil {
+				return published, err
+			}
+			e, err := p.publish(dir, episode, episodeGUID(run, name), run+": "+title, showNotes(tags, name))
+			if episode != file {
+				os.Remove(episode)
+			}
+			if err != nil {
+				return published, err
+			}
+			published = append(published, e)
+		}
+		return published, nil
+	}
+
+	tmp, err := os.CreateTemp("", "zh-audio-episode-*.mp3")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := ExportAudiobook(tmp.Name(), runDir, AudiobookOptions{Format: AudiobookMP3, Title: run, Pause: 1000}); err != nil {
+		return nil, err
+	}
+	var notes []string
+	for _, file := range files {
+		tags, err := ReadTags(file)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, showNotes(tags, strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))))
+	}
+	e, err := p.publish(dir, tmp.Name(), episodeGUID(run, ""), run, strings.Join(notes, "\n\n"))
+	if err != nil {
+		return nil, err
+	}
+	return []*Episode{e}, nil
+}
+
+// publish copies an audio file into the episode dir and records it, replacing the
+// episode with the same guid but keeping its publication date.
+func (p *Podcast) publish(dir, file, guid, title, notes string) (*Episode, error) {
+	typ, ext, err := audioType(file)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "audio/mpeg" {
+		return nil, fmt.Errorf("episode %s is not mp3, podcast clients only play mp3 enclosures", file)
+	}
+	rel := filepath.Join(episodeDir, guid+ext)
+	if err := copyFileContents(file, filepath.Join(dir, rel)); err != nil {
+		return nil, fmt.Errorf("failed to copy %s: %v", file, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, rel))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := Duration(file)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Episode{
+		GUID:      guid,
+		Title:     title,
+		File:      filepath.ToSlash(rel),
+		Type:      typ,
+		Size:      info.Size(),
+		Duration:  duration,
+		Published: time.Now(),
+		Notes:     notes,
+	}
+	for i, old := range p.Episodes {
+		if old.GUID != guid {
+			continue
+		}
+		e.Published = old.Published
+		if old.File != e.File {
+			os.Remove(filepath.Join(dir, old.File))
+		}
+		p.Episodes[i] = e
+		slog.Info("updated episode", "title", title, "guid", guid)
+		return e, nil
+	}
+	p.Episodes = append(p.Episodes, e)
+	slog.Info("published episode", "title", title, "guid", guid)
+	return e, nil
+}
+
+func episodeGUID(run, loop string) string {
+	sum := sha256.Sum256([]byte(run + "/" + loop))
+	return hex.EncodeToString(sum[:8])
+}
+
+// showNotes returns the transcript of a loop, the transcript of untagged loops is their
+// name.
+func showNotes(tags Tags, name string) string {
+	if tags.Lyrics != "" {
+		return tags.Lyrics
+	}
+	if tags.Title != "" {
+		return tags.Title
+	}
+	return name
+}
+
+// asMP3 returns the loop itself if it is mp3, or a temporary copy encoded as mp3 with the
+// tags of the loop.
+func asMP3(file string, tags Tags) (string, error) {
+	if typ, _, err := audioType(file); err != nil || typ == "audio/mpeg" {
+		return file, err
+	}
+	samples, format, err := decodeFile(file)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "zh-audio-episode-*.mp3")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	if err := encodeMP3(tmp.Name(), samples, format); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := WriteTags(tmp.Name(), tags); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// audioType returns the mime type and file extension of an audio file by its content.
+func audioType(file string) (string, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := f.Read(magic); err != nil {
+		return "", "", fmt.Errorf("failed to read file %s: %v", file, err)
+	}
+	if string(magic) == "RIFF" {
+		return "audio/wav", ".wav", nil
+	}
+	return "audio/mpeg", ".mp3", nil
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string      `xml:"title"`
+	Link        string      `xml:"link"`
+	Description string      `xml:"description"`
+	Language    string      `xml:"language"`
+	Author      string      `xml:"itunes:author"`
+	Summary     string      `xml:"itunes:summary"`
+	Explicit    string      `xml:"itunes:explicit"`
+	Category    rssCategory `xml:"itunes:category"`
+	Image       *rssImage   `xml:"itunes:image,omitempty"`
+	LastBuild   string      `xml:"lastBuildDate,omitempty"`
+	Items       []rssItem   `xml:"item"`
+}
+
+type rssCategory struct {
+	Text string `xml:"text,attr"`
+}
+
+type rssImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Duration    string       `xml:"itunes:duration"`
+	Summary     string       `xml:"itunes:summary"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders the feed as RSS 2.0 with itunes tags, newest episodes first.
+func (p *Podcast) RSS() ([]byte, error) {
+	base, err := url.Parse(strings.TrimSuffix(p.BaseURL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url %s: %v", p.BaseURL, err)
+	}
+	feed := rss{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: rssChannel{
+			Title:       p.Title,
+			Link:        base.String(),
+			Description: p.Description,
+			Language:    p.Language,
+			Author:      p.Author,
+			Summary:     p.Description,
+			Explicit:    "false",
+			Category:    rssCategory{Text: "Education"},
+		},
+	}
+	if p.Image != "" {
+		feed.Channel.Image = &rssImage{Href: p.Image}
+	}
+
+	episodes := append([]*Episode{}, p.Episodes...)
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].Published.After(episodes[j].Published)
+	})
+	if len(episodes) > 0 {
+		feed.Channel.LastBuild = episodes[0].Published.Format(time.RFC1123Z)
+	}
+	for _, e := range episodes {
+		enclosure, err := base.Parse(e.File)
+		if err != nil {
+			return nil, err
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       e.Title,
+			Description: e.Notes,
+			Enclosure:   rssEnclosure{URL: enclosure.String(), Length: e.Size, Type: e.Type},
+			GUID:        rssGUID{Value: e.GUID},
+			PubDate:     e.Published.Format(time.RFC1123Z),
+			Duration:    itunesDuration(e.Duration),
+			Summary:     e.Notes,
+		})
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal feed: %v", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func itunesDuration(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// PodcastHandler serves the feed and episodes of a podcast dir. Range requests are
+// supported, players seek in episodes with them.
+func PodcastHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" || r.URL.Path == "/"+podcastFeed {
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			http.ServeFile(w, r, filepath.Join(dir, podcastFeed))
+			return
+		}
+		if r.URL.Path == "/"+podcastIndex {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// writeFileAtomic replaces a file, so that a concurrently served file is never partial.
+func writeFileAtomic(path string, data []byte) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
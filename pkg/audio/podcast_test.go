@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+func TestPublishRunPerLoop(t *testing.T) {
+	runDir, dir := t.TempDir(), t.TempDir()
+	data, err := os.ReadFile("../../peep.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "你好.mp3"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Podcast{Title: "loops", BaseURL: "https://example.com/podcast"}
+	episodes, err := p.PublishRun(dir, runDir, "run", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(episodes) != 1 || episodes[0].Type != "audio/mpeg" || !strings.HasSuffix(episodes[0].File, ".mp3") {
+		t.Fatalf("episodes %+v", episodes)
+	}
+	feed, err := p.RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(feed), `type="audio/mpeg"`) || !strings.Contains(string(feed), "https://example.com/podcast/episodes/") {
+		t.Errorf("feed without mp3 enclosure:\n%s", feed)
+	}
+}
+
+func TestPublishRunEncodesWAV(t *testing.T) {
+	runDir := t.TempDir()
+	cue, err := GenerateCue(CueRef(CueEnd), DefaultSampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := beep.Format{SampleRate: DefaultSampleRate, NumChannels: 2, Precision: 2}
+	for _, name := range []string{"01.wav", "02.wav"} {
+		file := filepath.Join(runDir, name)
+		if err := encodeWAV(file, cue, format); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteTags(file, Tags{Title: "你好", Lyrics: "你好\nnǐ hǎo"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loop := DefaultSampleRate.D(len(cue))
+
+	tests := []struct {
+		name     string
+		perLoop  bool
+		episodes int
+		min      time.Duration
+	}{
+		{name: "per loop", perLoop: true, episodes: 2, min: loop},
+		{name: "single episode", episodes: 1, min: 2*loop + time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := &Podcast{Title: "loops", BaseURL: "https://example.com/"}
+			episodes, err := p.PublishRun(dir, runDir, "run", tt.perLoop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(episodes) != tt.episodes {
+				t.Fatalf("%d episodes, want %d", len(episodes), tt.episodes)
+			}
+			for _, e := range episodes {
+				file := filepath.Join(dir, e.File)
+				if e.Type != "audio/mpeg" || filepath.Ext(file) != ".mp3" {
+					t.Errorf("episode %s of type %s", e.File, e.Type)
+				}
+				if typ, _, err := audioType(file); err != nil || typ != "audio/mpeg" {
+					t.Errorf("episode %s is %s: %v", e.File, typ, err)
+				}
+				info, err := os.Stat(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e.Size != info.Size() {
+					t.Errorf("episode size %d, file has %d bytes", e.Size, info.Size())
+				}
+				// the encoder pads the last frame
+				d, err := Duration(file)
+				if err != nil {
+					t.Fatalf("episode does not decode: %v", err)
+				}
+				if d != e.Duration || d < tt.min || d > tt.min+100*time.Millisecond {
+					t.Errorf("episode of %v, recorded %v, want %v", d, e.Duration, tt.min)
+				}
+			}
+			if tt.perLoop {
+				tags, err := ReadTags(filepath.Join(dir, episodes[0].File))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tags.Title != "你好" || episodes[0].Notes != "你好\nnǐ hǎo" {
+					t.Errorf("episode tags %+v, notes %q", tags, episodes[0].Notes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Store keeps entries in a bucket of an S3-compatible object store. Requests use
+// path-style addressing and are signed with AWS signature version 4, so any local
+// stand-in like MinIO can be used as endpoint.
+type S3Store struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Bucket    string
+	Region    string
+	Prefix    string // prepended to all keys
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func NewS3Store(endpoint, bucket, region, prefix, accessKey, secretKey string) *S3Store {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Store{
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Bucket:    bucket,
+		Region:    region,
+		Prefix:    prefix,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (s *S3Store) Get(ctx context.Context, key string, w io.Writer) error {
+	resp, err := s.do(ctx, http.MethodGet, s.Prefix+key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	// the payload is hashed for signing, clips are small enough to be buffered
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.Prefix+key, nil, body, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (StoreEntry, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.Prefix+key, nil, nil, nil)
+	if err != nil {
+		return StoreEntry{}, err
+	}
+	resp.Body.Close()
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return StoreEntry{
+		Key:     key,
+		Size:    size,
+		ModTime: modTime,
+		ETag:    strings.Trim(resp.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]StoreEntry, error) {
+	var entries []StoreEntry
+	var token string
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.Prefix+prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode bucket listing: %w", err)
+		}
+		for _, c := range result.Contents {
+			entries = append(entries, StoreEntry{
+				Key:     strings.TrimPrefix(c.Key, s.Prefix),
+				Size:    c.Size,
+				ModTime: c.LastModified,
+				ETag:    strings.Trim(c.ETag, `"`),
+			})
+		}
+		if !result.IsTruncated {
+			return entries, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Copy copies an object within the bucket on the server side.
+func (s *S3Store) Copy(ctx context.Context, src, dst string) error {
+	header := http.Header{}
+	header.Set("x-amz-copy-source", uriEncode("/"+s.Bucket+"/"+s.Prefix+src, false))
+	resp, err := s.do(ctx, http.MethodPut, s.Prefix+dst, nil, nil, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.Prefix+key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a signed request for an object key, or for the bucket if key is empty. Status codes
+// other than 2xx are returned as error, 404 as ErrNotFound.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	path := "/" + s.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	canonicalURI := u.Path + uriEncode(path, false)
+	canonicalQuery := canonicalQueryString(query)
+	rawURL := s.Endpoint + uriEncode(path, false)
+	if canonicalQuery != "" {
+		rawURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, canonicalURI, canonicalQuery, body, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+func (s *S3Store) sign(req *http.Request, canonicalURI, canonicalQuery string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	// the host and all x-amz headers are signed
+	names := []string{"host"}
+	for k := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, name := range names {
+		value := req.URL.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		canonicalHeaders += name + ":" + value + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything except unreserved characters as required by
+// signature version 4. Slashes are kept in paths.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
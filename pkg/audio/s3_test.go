@@ -0,0 +1,311 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "minio"
+	testSecretKey = "minio-secret"
+	testRegion    = "eu-central-1"
+)
+
+// fakeS3 is a stand-in for an S3-compatible store like MinIO. It checks the signature of
+// every request, counting the rejected ones, and pages listings by pageSize keys.
+type fakeS3 struct {
+	bucket   string
+	pageSize int
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	lists    int
+	rejected int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{bucket: "clips", pageSize: 2, objects: make(map[string][]byte)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := f.verify(r, body); err != nil {
+		f.mu.Lock()
+		f.rejected++
+		f.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	path, _ := url.PathUnescape(strings.SplitN(r.RequestURI, "?", 2)[0])
+	key := strings.TrimPrefix(strings.TrimPrefix(path, "/"+f.bucket), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", strconv.Quote(sha256Hex(data)))
+		w.Write(data)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	f.lists++
+	query := r.URL.Query()
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, query.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := min(start+f.pageSize, len(keys))
+	var result listBucketResult
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+			ETag         string    `xml:"ETag"`
+		}{Key: k, Size: int64(len(f.objects[k])), LastModified: time.Now().UTC()})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+// verify recomputes the signature version 4 of a request from what the server received.
+func (f *fakeS3) verify(r *http.Request, body []byte) error {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	fields := make(map[string]string)
+	for _, part := range strings.Split(auth, ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		fields[k] = v
+	}
+	scope := strings.SplitN(fields["Credential"], "/", 2)
+	if len(scope) != 2 || scope[0] != testAccessKey {
+		return fmt.Errorf("credential %q", fields["Credential"])
+	}
+	payloadHash := sha256.Sum256(body)
+	if got := r.Header.Get("x-amz-content-sha256"); got != hex.EncodeToString(payloadHash[:]) {
+		return fmt.Errorf("payload hash %s", got)
+	}
+
+	var headers string
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers += name + ":" + value + "\n"
+	}
+	query := r.URL.Query()
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, escape(k)+"="+escape(v))
+		}
+	}
+	sort.Strings(params)
+	canonical := strings.Join([]string{
+		r.Method,
+		strings.SplitN(r.RequestURI, "?", 2)[0],
+		strings.Join(params, "&"),
+		headers,
+		fields["SignedHeaders"],
+		r.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+	amzDate := r.Header.Get("x-amz-date")
+	date := amzDate[:8]
+	if want := date + "/" + testRegion + "/s3/aws4_request"; scope[1] != want {
+		return fmt.Errorf("scope %s, want %s", scope[1], want)
+	}
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope[1] + "\n" + hex.EncodeToString(hash[:])
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), date)
+	key = hmacSHA256(key, testRegion)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); fields["Signature"] != want {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func newTestS3Store(srv *httptest.Server, prefix string) *S3Store {
+	return NewS3Store(srv.URL, "clips", testRegion, prefix, testAccessKey, testSecretKey)
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t)
+	store := newTestS3Store(srv, "zh/")
+
+	keys := []string{"你好.mp3", "再见.mp3", "a b.mp3", "谢谢.mp3", "x.mp3"}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("audio of "+key), -1); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	if _, ok := fake.objects["zh/你好.mp3"]; !ok {
+		t.Fatalf("objects are not stored under the prefix: %v", fake.objects)
+	}
+
+	var buf bytes.Buffer
+	if err := store.Get(ctx, "你好.mp3", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "audio of 你好.mp3" {
+		t.Errorf("get: %q", buf.String())
+	}
+	e, err := store.Stat(ctx, "a b.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Size != int64(len("audio of a b.mp3")) || e.ETag == "" {
+		t.Errorf("stat: %+v", e)
+	}
+	if _, err := store.Stat(ctx, "missing.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("stat of a missing key: %v", err)
+	}
+
+	entries, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(keys) {
+		t.Errorf("listed %d entries, want %d", len(entries), len(keys))
+	}
+	if fake.lists != 3 {
+		t.Errorf("listed %d pages, want 3", fake.lists)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, "zh/") {
+			t.Errorf("listed key %s with the prefix", e.Key)
+		}
+	}
+	if fake.rejected != 0 {
+		t.Errorf("rejected %d signed requests", fake.rejected)
+	}
+}
+
+func TestS3StoreRejectsWrongSecret(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	store := newTestS3Store(srv, "")
+	store.SecretKey = "wrong"
+	if err := store.Put(context.Background(), "x.mp3", strings.NewReader("x"), -1); err == nil {
+		t.Error("put with a wrong secret succeeded")
+	}
+	if fake.rejected != 1 {
+		t.Errorf("rejected %d requests, want 1", fake.rejected)
+	}
+}
+
+func TestReadThroughStore(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t)
+	local := &FileStore{Dir: t.TempDir()}
+	store := &ReadThroughStore{Local: local, Remote: newTestS3Store(srv, "")}
+
+	if err := store.Put(ctx, "你好.mp3", strings.NewReader("ni hao"), -1); err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.objects["你好.mp3"]) != "ni hao" {
+		t.Errorf("put did not reach the remote: %q", fake.objects["你好.mp3"])
+	}
+	if _, err := local.Stat(ctx, "你好.mp3"); err != nil {
+		t.Errorf("put did not reach the local store: %v", err)
+	}
+
+	// an entry only the remote has is fetched and kept locally
+	fake.objects["再见.mp3"] = []byte("zai jian")
+	var buf bytes.Buffer
+	if err := store.Get(ctx, "再见.mp3", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "zai jian" {
+		t.Errorf("get: %q", buf.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(local.Dir, "再见.mp3")); err != nil || string(data) != "zai jian" {
+		t.Errorf("remote entry not kept locally: %q, %v", data, err)
+	}
+
+	if err := store.Get(ctx, "missing.mp3", io.Discard); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get of a missing key: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(local.Dir, ".put-*")); len(files) > 0 {
+		t.Errorf("failed fill left temporary files: %v", files)
+	}
+	if fake.rejected != 0 {
+		t.Errorf("rejected %d signed requests", fake.rejected)
+	}
+}
+
+func TestCacheUploadsMissedEntries(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	dir := t.TempDir()
+	manifest := NewManifest("words")
+	cache := &Cache{AudioCacheDir: t.TempDir(), Manifest: manifest, Remote: newTestS3Store(srv, "")}
+
+	for _, name := range []string{"你好.mp3", "再见.mp3", "lesson.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest.AddLookup(cache.GetCachePath("你好"), false)
+	manifest.AddLookup(cache.GetCachePath("再见"), true)
+	// missed but never synthesized
+	manifest.AddLookup(cache.GetCachePath("。"), false)
+
+	if err := cache.Upload(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	var uploaded []string
+	for k := range fake.objects {
+		uploaded = append(uploaded, k)
+	}
+	if len(uploaded) != 1 || uploaded[0] != "你好.mp3" {
+		t.Errorf("uploaded %v, want only the missed entry 你好.mp3", uploaded)
+	}
+}
@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+var ErrNotFound = errors.New("not found in cache store")
+
+type StoreEntry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+// CacheStore is a backend holding synthesized clips by their cache key, which is the
+// filename returned by GetCachePath.
+type CacheStore interface {
+	Get(ctx context.Context, key string, w io.Writer) error
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Stat(ctx context.Context, key string) (StoreEntry, error)
+	List(ctx context.Context, prefix string) ([]StoreEntry, error)
+}
+
+// FileStore keeps entries as files in a local directory.
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.Base(key))
+}
+
+func (s *FileStore) Get(ctx context.Context, key string, w io.Writer) error {
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Put writes to a temporary file first so that readers never see partial entries.
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *FileStore) Stat(ctx context.Context, key string) (StoreEntry, error) {
+	info, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return StoreEntry{}, ErrNotFound
+	}
+	if err != nil {
+		return StoreEntry{}, err
+	}
+	return StoreEntry{Key: info.Name(), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *FileStore) List(ctx context.Context, prefix string) ([]StoreEntry, error) {
+	files, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []StoreEntry
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasPrefix(file.Name(), prefix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, StoreEntry{Key: file.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return entries, nil
+}
+
+// ReadThroughStore serves entries from a local store and falls back to a remote store,
+// keeping a local copy of everything it fetched. Writes go to both stores.
+type ReadThroughStore struct {
+	Local  *FileStore
+	Remote CacheStore
+}
+
+func (s *ReadThroughStore) Get(ctx context.Context, key string, w io.Writer) error {
+	err := s.Local.Get(ctx, key, w)
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := s.fill(ctx, key); err != nil {
+		return err
+	}
+	return s.Local.Get(ctx, key, w)
+}
+
+// fill downloads an entry from the remote into the local store.
+func (s *ReadThroughStore) fill(ctx context.Context, key string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.Remote.Get(ctx, key, pw))
+	}()
+	err := s.Local.Put(ctx, key, pr, -1)
+	pr.CloseWithError(err)
+	if err == nil {
+		slog.Debug("fetched from remote cache", "key", key)
+	}
+	return err
+}
+
+func (s *ReadThroughStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := s.Local.Put(ctx, key, r, size); err != nil {
+		return err
+	}
+	f, err := os.Open(s.Local.path(key))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Remote.Put(ctx, key, f, size)
+}
+
+func (s *ReadThroughStore) Stat(ctx context.Context, key string) (StoreEntry, error) {
+	e, err := s.Local.Stat(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return s.Remote.Stat(ctx, key)
+	}
+	return e, err
+}
+
+// List returns the entries of the remote, it holds everything the local store has fetched.
+func (s *ReadThroughStore) List(ctx context.Context, prefix string) ([]StoreEntry, error) {
+	return s.Remote.List(ctx, prefix)
+}
+
+// writeAtomic writes a file through a temporary file that is renamed to path once write
+// succeeds, so that a failed write leaves no partial file behind.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,75 @@
+package audio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteSubtitles writes an .lrc and a .vtt file next to the audio file, with one cue per
+// segment that has a transcript.
+func WriteSubtitles(audioFile string, timeline []Segment) error {
+	base := strings.TrimSuffix(audioFile, filepath.Ext(audioFile))
+	if err := os.WriteFile(base+".lrc", []byte(LRC(timeline)), 0644); err != nil {
+		return fmt.Errorf("failed to write lrc: %v", err)
+	}
+	if err := os.WriteFile(base+".vtt", []byte(WebVTT(timeline)), 0644); err != nil {
+		return fmt.Errorf("failed to write vtt: %v", err)
+	}
+	return nil
+}
+
+// lines returns the non-empty parts of the transcript, chinese first.
+func (t SegmentText) lines() []string {
+	var lines []string
+	for _, l := range []string{t.Chinese, t.Pinyin, t.English} {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// LRC renders the timeline as lyrics. LRC has no end times, an empty line clears the text
+// during the pauses between segments.
+func LRC(timeline []Segment) string {
+	var b strings.Builder
+	for i, s := range timeline {
+		lines := s.lines()
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "[%s]%s\n", lrcTime(s.Start), strings.Join(lines, " | "))
+		if i == len(timeline)-1 || timeline[i+1].Start > s.End {
+			fmt.Fprintf(&b, "[%s]\n", lrcTime(s.End))
+		}
+	}
+	return b.String()
+}
+
+func lrcTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%02d:%02d.%02d", cs/6000, cs/100%60, cs%100)
+}
+
+func WebVTT(timeline []Segment) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	var n int
+	for _, s := range timeline {
+		lines := s.lines()
+		if len(lines) == 0 {
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", n, vttTime(s.Start), vttTime(s.End), strings.Join(lines, "\n"))
+	}
+	return b.String()
+}
+
+func vttTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
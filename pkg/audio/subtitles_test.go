@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testTimeline = []Segment{
+	{Start: 0, End: 1200 * time.Millisecond, SegmentText: SegmentText{Chinese: "你好", Pinyin: "nǐ hǎo", English: "hello"}},
+	// a cue without transcript
+	{Start: 2200 * time.Millisecond, End: 2500 * time.Millisecond},
+	{Start: 2500 * time.Millisecond, End: 4 * time.Second, SegmentText: SegmentText{Chinese: "再见  ", English: "good\nbye"}},
+	{Start: 4 * time.Second, End: 61*time.Minute + 5*time.Second + 30*time.Millisecond, SegmentText: SegmentText{English: "see you"}},
+}
+
+func TestLRC(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeline []Segment
+		want     string
+	}{
+		{"empty", nil, ""},
+		{"no transcript", testTimeline[1:2], ""},
+		{
+			"timeline",
+			testTimeline,
+			"[00:00.00]你好 | nǐ hǎo | hello\n" +
+				"[00:01.20]\n" +
+				"[00:02.50]再见 | good bye\n" +
+				"[00:04.00]see you\n" +
+				"[61:05.03]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LRC(tt.timeline); got != tt.want {
+				t.Errorf("LRC =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebVTT(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeline []Segment
+		want     string
+	}{
+		{"empty", nil, "WEBVTT\n"},
+		{"no transcript", testTimeline[1:2], "WEBVTT\n"},
+		{
+			"timeline",
+			testTimeline,
+			"WEBVTT\n" +
+				"\n1\n00:00:00.000 --> 00:00:01.200\n你好\nnǐ hǎo\nhello\n" +
+				"\n2\n00:00:02.500 --> 00:00:04.000\n再见\ngood bye\n" +
+				"\n3\n00:00:04.000 --> 01:01:05.030\nsee you\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WebVTT(tt.timeline); got != tt.want {
+				t.Errorf("WebVTT =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteSubtitles(filepath.Join(dir, "你好.wav"), testTimeline[:1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"你好.lrc", "你好.vtt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"math"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// TrimOptions configure the removal of leading and trailing silence from clips. TTS
+// responses carry silence of varying length, without trimming a pause added by the
+// concatenator would never last as long as requested.
+type TrimOptions struct {
+	// level in dBFS below which audio counts as silence
+	Threshold float64
+	// silence in ms kept before the first and after the last sound, so that consonants
+	// fading in or out are not cut off
+	Padding int
+}
+
+var DefaultTrim = TrimOptions{
+	Threshold: -50,
+	Padding:   30,
+}
+
+// window the signal level is measured in
+const trimWindow = 10 * time.Millisecond
+
+// Trim removes leading and trailing silence. Clips without any sound above the
+// threshold are trimmed to nothing.
+func (o TrimOptions) Trim(samples [][2]float64, sr beep.SampleRate) [][2]float64 {
+	window := sr.N(trimWindow)
+	if window == 0 || len(samples) == 0 {
+		return samples
+	}
+	threshold := math.Pow(10, o.Threshold/20)
+	loud := func(start int) bool {
+		end := start + window
+		if end > len(samples) {
+			end = len(samples)
+		}
+		var sum float64
+		for _, s := range samples[start:end] {
+			sum += (s[0]*s[0] + s[1]*s[1]) / 2
+		}
+		return math.Sqrt(sum/float64(end-start)) > threshold
+	}
+
+	first := -1
+	for start := 0; start < len(samples); start += window {
+		if loud(start) {
+			first = start
+			break
+		}
+	}
+	if first == -1 {
+		return nil
+	}
+	last := first
+	for start := (len(samples) - 1) / window * window; start > first; start -= window {
+		if loud(start) {
+			last = start
+			break
+		}
+	}
+
+	padding := sr.N(time.Duration(o.Padding) * time.Millisecond)
+	from := first - padding
+	if from < 0 {
+		from = 0
+	}
+	to := last + window + padding
+	if to > len(samples) {
+		to = len(samples)
+	}
+	return samples[from:to]
+}
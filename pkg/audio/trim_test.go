@@ -0,0 +1,58 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+// clip returns silence, a sine of dbfs and silence again, of the given lengths in ms.
+func clip(lead int, dbfs float64, tone, trail int) [][2]float64 {
+	silence := func(ms int) [][2]float64 {
+		return make([][2]float64, testRate.N(time.Duration(ms)*time.Millisecond))
+	}
+	out := append(silence(lead), sine(dbfs, float64(tone)/1000, true)...)
+	return append(out, silence(trail)...)
+}
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    TrimOptions
+		samples [][2]float64
+		// length in ms of the trimmed clip and where the tone starts in it
+		want, start int
+	}{
+		{"padding kept", DefaultTrim, clip(200, -6, 300, 400), 360, 30},
+		{"no padding", TrimOptions{Threshold: -50}, clip(200, -6, 300, 400), 300, 0},
+		{"long padding", TrimOptions{Threshold: -50, Padding: 100}, clip(200, -6, 300, 400), 500, 100},
+		// padding is clipped at the ends of the clip
+		{"no leading silence", DefaultTrim, clip(0, -6, 300, 400), 330, 0},
+		{"no trailing silence", DefaultTrim, clip(200, -6, 300, 0), 330, 30},
+		{"short silence", DefaultTrim, clip(10, -6, 300, 10), 320, 10},
+		// sound below the threshold counts as silence
+		{"quiet tone", DefaultTrim, clip(200, -60, 300, 400), 0, 0},
+		{"lower threshold", TrimOptions{Threshold: -70, Padding: 30}, clip(200, -60, 300, 400), 360, 30},
+		{"all silent", DefaultTrim, clip(500, -6, 0, 0), 0, 0},
+	}
+	for _, tt := range tests {
+		out := tt.opts.Trim(tt.samples, testRate)
+		if got := testRate.D(len(out)); got != time.Duration(tt.want)*time.Millisecond {
+			t.Errorf("%s: trimmed to %v, want %dms", tt.name, got, tt.want)
+			continue
+		}
+		if tt.want == 0 {
+			continue
+		}
+		// the tone itself is never cut, its first sample is silent left and at the peak right
+		start := testRate.N(time.Duration(tt.start) * time.Millisecond)
+		if out[start][0] != 0 || out[start][1] == 0 {
+			t.Errorf("%s: tone does not start at %dms", tt.name, tt.start)
+		}
+		if start > 0 && out[start-1] != [2]float64{} {
+			t.Errorf("%s: sound before %dms", tt.name, tt.start)
+		}
+	}
+	if out := DefaultTrim.Trim(nil, testRate); out != nil {
+		t.Errorf("empty clip trimmed to %d samples", len(out))
+	}
+}
@@ -0,0 +1,252 @@
+package audio
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAVSink uploads exports to a WebDAV server, e.g. Nextcloud. Files are staged in a
+// hidden collection and moved into place by the commit, which the server does atomically
+// per file. Replaced files are moved to a hidden backup collection first.
+type WebDAVSink struct {
+	URL      string // collection the exports are kept in
+	User     string
+	Password string
+	Client   *http.Client
+}
+
+func NewWebDAVSink(rawURL, user, password string) *WebDAVSink {
+	return &WebDAVSink{
+		URL:      strings.TrimSuffix(rawURL, "/"),
+		User:     user,
+		Password: password,
+		Client:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (s *WebDAVSink) String() string { return "webdav:" + s.URL }
+
+func (s *WebDAVSink) staging(e Export) string {
+	return ".staging-" + e.ID
+}
+
+func (s *WebDAVSink) target(e Export, name string) string {
+	return path.Join(e.Day(), name)
+}
+
+func (s *WebDAVSink) backup(e Export) string {
+	return ".backup-" + e.ID
+}
+
+func (s *WebDAVSink) Stage(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		staged := path.Join(s.staging(e), f.Name)
+		if err := s.mkcol(ctx, path.Dir(staged)); err != nil {
+			return err
+		}
+		in, err := os.Open(f.Path)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(ctx, http.MethodPut, staged, in, nil)
+		in.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *WebDAVSink) Commit(ctx context.Context, e Export) error {
+	for _, f := range e.Files {
+		target := s.target(e, f.Name)
+		if err := s.mkcol(ctx, path.Dir(target)); err != nil {
+			return err
+		}
+		exists, err := s.exists(ctx, target)
+		if err != nil {
+			return err
+		}
+		if exists {
+			backup := path.Join(s.backup(e), f.Name)
+			if err := s.mkcol(ctx, path.Dir(backup)); err != nil {
+				return err
+			}
+			if err := s.move(ctx, target, backup); err != nil {
+				return err
+			}
+		}
+		if err := s.move(ctx, path.Join(s.staging(e), f.Name), target); err != nil {
+			return err
+		}
+	}
+	return s.Remove(ctx, s.staging(e))
+}
+
+func (s *WebDAVSink) Abort(ctx context.Context, e Export, committed bool) error {
+	if committed {
+		for _, f := range e.Files {
+			if err := s.revert(ctx, e, f.Name); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.Remove(ctx, s.staging(e)); err != nil {
+		return err
+	}
+	return s.Remove(ctx, s.backup(e))
+}
+
+// revert restores the backup of a file, or removes it if the commit created it.
+func (s *WebDAVSink) revert(ctx context.Context, e Export, name string) error {
+	target, staged, backup := s.target(e, name), path.Join(s.staging(e), name), path.Join(s.backup(e), name)
+	if ok, err := s.exists(ctx, backup); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		return s.move(ctx, backup, target)
+	}
+	if ok, err := s.exists(ctx, staged); err != nil || ok {
+		// not committed
+		return err
+	}
+	return s.Remove(ctx, target)
+}
+
+func (s *WebDAVSink) Cleanup(ctx context.Context, e Export) error {
+	return s.Remove(ctx, s.backup(e))
+}
+
+// move moves a file, replacing the destination.
+func (s *WebDAVSink) move(ctx context.Context, src, dst string) error {
+	header := http.Header{}
+	header.Set("Destination", s.url(dst))
+	header.Set("Overwrite", "T")
+	resp, err := s.do(ctx, "MOVE", src, nil, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// exists reports whether a file exists.
+func (s *WebDAVSink) exists(ctx context.Context, name string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, name, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, resp.Body.Close()
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+	} `xml:"response"`
+}
+
+func (s *WebDAVSink) Exports(ctx context.Context) ([]string, error) {
+	header := http.Header{}
+	header.Set("Depth", "1")
+	header.Set("Content-Type", "application/xml")
+	body := strings.NewReader(`<?xml version="1.0"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`)
+	resp, err := s.do(ctx, "PROPFIND", "", body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode webdav listing: %w", err)
+	}
+	var names []string
+	for _, r := range result.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			continue
+		}
+		if name := path.Base(strings.TrimSuffix(href, "/")); isExportName(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Remove deletes a file or collection, missing ones are ignored.
+func (s *WebDAVSink) Remove(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// mkcol creates a collection and its parents, existing ones are skipped.
+func (s *WebDAVSink) mkcol(ctx context.Context, dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+	if err := s.mkcol(ctx, path.Dir(dir)); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, "MKCOL", dir+"/", nil, nil)
+	if err != nil {
+		// 405 means the collection exists
+		if strings.Contains(err.Error(), "405") {
+			return nil
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *WebDAVSink) url(name string) string {
+	if name == "" {
+		return s.URL + "/"
+	}
+	return s.URL + "/" + uriEncode(name, false)
+}
+
+// do sends a request for a path relative to the collection. Status codes other than 2xx
+// are returned as error, 404 as ErrNotFound.
+func (s *WebDAVSink) do(ctx context.Context, method, name string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.User != "" {
+		req.SetBasicAuth(s.User, s.Password)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("webdav %s %s: %s: %s", method, name, resp.Status, msg)
+	}
+	return resp, nil
+}
@@ -0,0 +1,312 @@
+// Package dict reads the CC-CEDICT chinese-english dictionary.
+package dict
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/exp/slog"
+)
+
+// Entry is a line of the dictionary, e.g.
+// 傳統 传统 [chuan2 tong3] /tradition/traditional/
+type Entry struct {
+	Traditional string
+	Simplified  string
+	Pinyin      string // numbered, syllables separated by spaces
+	Glosses     []string
+}
+
+// Definitions returns the cleaned glosses, without classifiers and variant pinyin.
+func (e Entry) Definitions() []string {
+	var defs []string
+	for _, g := range e.Glosses {
+		if g = CleanGloss(g); g != "" {
+			defs = append(defs, g)
+		}
+	}
+	return defs
+}
+
+// Dict indexes the entries by simplified and traditional headword and by pinyin.
+type Dict struct {
+	Entries []Entry
+
+	headwords map[string][]int
+	pinyin    map[string][]int
+	maxLen    int // longest headword in runes
+}
+
+var lineRe = regexp.MustCompile(`^(\S+) (\S+) \[([^\]]*)\] /(.*)/\s*$`)
+
+// Parse reads a CC-CEDICT file.
+func Parse(path string) (*Dict, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cedict %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Read parses a CC-CEDICT dictionary, lines that are no entries are skipped.
+func Read(r io.Reader) (*Dict, error) {
+	d := &Dict{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		d.Entries = append(d.Entries, Entry{
+			Traditional: m[1],
+			Simplified:  m[2],
+			Pinyin:      m[3],
+			Glosses:     strings.Split(m[4], "/"),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	d.index()
+	return d, nil
+}
+
+// Load reads a CC-CEDICT file through an index next to it, which is rebuilt if the
+// dictionary changed. Decoding the index is a lot faster than parsing the dictionary.
+func Load(path string) (*Dict, error) {
+	indexPath := path + ".gob"
+	src, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if idx, err := os.Stat(indexPath); err == nil && idx.ModTime().After(src.ModTime()) {
+		d, err := readIndex(indexPath)
+		if err == nil {
+			return d, nil
+		}
+		slog.Warn("failed to read dictionary index, parsing the dictionary", "path", indexPath, "err", err)
+	}
+	d, err := Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.writeIndex(indexPath); err != nil {
+		slog.Warn("failed to write dictionary index", "path", indexPath, "err", err)
+	}
+	return d, nil
+}
+
+func readIndex(path string) (*Dict, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := &Dict{}
+	if err := gob.NewDecoder(f).Decode(&d.Entries); err != nil {
+		return nil, err
+	}
+	d.index()
+	return d, nil
+}
+
+func (d *Dict) writeIndex(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(d.Entries); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *Dict) index() {
+	d.headwords = make(map[string][]int)
+	d.pinyin = make(map[string][]int)
+	for i, e := range d.Entries {
+		d.headwords[e.Simplified] = append(d.headwords[e.Simplified], i)
+		if e.Traditional != e.Simplified {
+			d.headwords[e.Traditional] = append(d.headwords[e.Traditional], i)
+		}
+		if n := len([]rune(e.Simplified)); n > d.maxLen {
+			d.maxLen = n
+		}
+		// numbered, marked and toneless pinyin find the entry
+		keys := []string{numberedKey(e.Pinyin), markedKey(e.Pinyin), tonelessKey(e.Pinyin)}
+		for j, key := range keys {
+			if key == "" || contains(keys[:j], key) {
+				continue
+			}
+			d.pinyin[key] = append(d.pinyin[key], i)
+		}
+	}
+}
+
+func (d *Dict) entries(indices []int) []Entry {
+	entries := make([]Entry, len(indices))
+	for i, j := range indices {
+		entries[i] = d.Entries[j]
+	}
+	return entries
+}
+
+// Lookup returns the entries of a simplified or traditional headword.
+func (d *Dict) Lookup(word string) []Entry {
+	return d.entries(d.headwords[word])
+}
+
+// LookupPinyin returns the entries of a pinyin, numbered like "ni3 hao3", marked like
+// "nǐhǎo" or without tones like "ni hao", which matches all tones.
+func (d *Dict) LookupPinyin(pinyin string) []Entry {
+	var key string
+	switch {
+	case strings.IndexFunc(pinyin, unicode.IsDigit) >= 0:
+		key = numberedKey(pinyin)
+	case hasToneMarks(pinyin):
+		key = markedKey(pinyin)
+	default:
+		key = tonelessKey(pinyin)
+	}
+	return d.entries(d.pinyin[key])
+}
+
+// Definitions returns the cleaned definitions of all entries of a word, nil if the word
+// is not in the dictionary.
+func (d *Dict) Definitions(word string) [][]string {
+	var defs [][]string
+	for _, e := range d.Lookup(word) {
+		if def := e.Definitions(); len(def) > 0 {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// Common returns the entry of the common reading of a word. Cedict lists the readings of
+// surnames and names, which have capitalized pinyin, first for many characters, e.g.
+// 曾 [Zeng1] before [ceng2]. The first entry with lower-case pinyin is preferred.
+func Common(entries []Entry) Entry {
+	for _, e := range entries {
+		if e.Pinyin == strings.ToLower(e.Pinyin) {
+			return e
+		}
+	}
+	return entries[0]
+}
+
+// Segment splits a text into words by the longest match in the dictionary, runs of text
+// that is not in the dictionary are kept together.
+func (d *Dict) Segment(text string) []string {
+	runes := []rune(text)
+	var words []string
+	var other []rune
+	flush := func() {
+		if len(other) > 0 {
+			words = append(words, string(other))
+		}
+		other = other[:0]
+	}
+	for i := 0; i < len(runes); {
+		matched := false
+		for n := min(d.maxLen, len(runes)-i); n > 0; n-- {
+			if _, ok := d.headwords[string(runes[i:i+n])]; ok {
+				flush()
+				words = append(words, string(runes[i:i+n]))
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			other = append(other, runes[i])
+			i++
+		}
+	}
+	flush()
+	return words
+}
+
+// Pinyin romanizes a text with tone marks. Words are segmented by the longest match in
+// the dictionary, text that is not in the dictionary is kept.
+func (d *Dict) Pinyin(text string) string {
+	var parts []string
+	for _, w := range d.Segment(text) {
+		if entries := d.Lookup(w); len(entries) > 0 {
+			parts = append(parts, Word(Common(entries).Pinyin))
+			continue
+		}
+		if w = strings.TrimSpace(w); w != "" {
+			parts = append(parts, w)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// WordTones returns the tones of a word. They are taken from the given pinyin, from the
+// common dictionary entry if it is empty or has not a syllable per character, e.g. marked
+// pinyin without spaces. A nil dictionary only reads the pinyin.
+func (d *Dict) WordTones(word, pinyin string) []int {
+	tones := Tones(pinyin)
+	if len(tones) == HanCount(word) || d == nil {
+		return tones
+	}
+	if entries := d.Lookup(word); len(entries) > 0 {
+		return Tones(Common(entries).Pinyin)
+	}
+	return tones
+}
+
+// HanCount returns the number of chinese characters of a text.
+func HanCount(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			n++
+		}
+	}
+	return n
+}
+
+// Readings returns the distinct numbered pinyin of a word, in lower case.
+func (d *Dict) Readings(word string) []string {
+	var readings []string
+	for _, e := range d.Lookup(word) {
+		if p := Numbered(e.Pinyin); !contains(readings, p) {
+			readings = append(readings, p)
+		}
+	}
+	return readings
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
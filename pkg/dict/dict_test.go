@@ -0,0 +1,137 @@
+package dict
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCedict = `# CC-CEDICT
+# a comment line
+傳統 传统 [chuan2 tong3] /tradition/traditional/
+好 好 [hao3] /good/well/
+好 好 [hao4] /to be fond of/
+你好 你好 [ni3 hao3] /hello/
+not an entry
+`
+
+func readTestDict(t *testing.T, cedict string) *Dict {
+	t.Helper()
+	d, err := Read(strings.NewReader(cedict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRead(t *testing.T) {
+	d := readTestDict(t, testCedict)
+	if len(d.Entries) != 4 {
+		t.Fatalf("read %d entries, want 4", len(d.Entries))
+	}
+	tests := []struct {
+		lookup string
+		want   []string // pinyin of the entries found
+	}{
+		{"传统", []string{"chuan2 tong3"}},
+		{"傳統", []string{"chuan2 tong3"}},
+		{"好", []string{"hao3", "hao4"}},
+		{"坏", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range d.Lookup(tt.lookup) {
+			got = append(got, e.Pinyin)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%s) = %v, want %v", tt.lookup, got, tt.want)
+		}
+	}
+	if got := d.Lookup("传统")[0].Glosses; !reflect.DeepEqual(got, []string{"tradition", "traditional"}) {
+		t.Errorf("glosses = %q", got)
+	}
+}
+
+func TestWordTones(t *testing.T) {
+	d := readTestDict(t, testCedict)
+	tests := []struct {
+		name   string
+		dict   *Dict
+		word   string
+		pinyin string
+		want   []int
+	}{
+		{"numbered", d, "你好", "ni3 hao3", []int{3, 3}},
+		{"marked", d, "你好", "nǐ hǎo", []int{3, 3}},
+		{"marked without spaces", d, "你好", "nǐhǎo", []int{3, 3}},
+		{"empty", d, "传统", "", []int{2, 3}},
+		{"not in the dictionary", d, "坏", "", nil},
+		{"no dictionary", nil, "你好", "nǐhǎo", []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dict.WordTones(tt.word, tt.pinyin); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WordTones(%s, %q) = %v, want %v", tt.word, tt.pinyin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHanCount(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"hello", 0},
+		{"你好", 2},
+		{"你好, world!", 2},
+		{"傳統", 2},
+	}
+	for _, tt := range tests {
+		if got := HanCount(tt.s); got != tt.want {
+			t.Errorf("HanCount(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPinyin(t *testing.T) {
+	d := readTestDict(t, testCedict+`曾 曾 [Zeng1] /surname Zeng/
+曾 曾 [ceng2] /once/already/
+曾經 曾经 [ceng2 jing1] /once/already/
+单 单 [Shan4] /surname Shan/
+單 单 [dan1] /bill/list/form/single/
+`)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"你好", "nǐhǎo"},
+		{"曾", "céng"},
+		{"曾经", "céngjīng"},
+		{"单", "dān"},
+		{"你好, 曾", "nǐhǎo , céng"},
+	}
+	for _, tt := range tests {
+		if got := d.Pinyin(tt.text); got != tt.want {
+			t.Errorf("Pinyin(%s) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCommon(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    string
+	}{
+		{"first", []Entry{{Pinyin: "hao3"}, {Pinyin: "hao4"}}, "hao3"},
+		{"surname first", []Entry{{Pinyin: "Zeng1"}, {Pinyin: "ceng2"}}, "ceng2"},
+		{"names only", []Entry{{Pinyin: "Bei3 jing1"}}, "Bei3 jing1"},
+	}
+	for _, tt := range tests {
+		if got := Common(tt.entries).Pinyin; got != tt.want {
+			t.Errorf("%s: Common = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
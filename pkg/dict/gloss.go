@@ -0,0 +1,46 @@
+package dict
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// pinyin of referenced words, e.g. variant of 個|个[ge4]
+	glossPinyinRe = regexp.MustCompile(`\[[^\]]*\]`)
+	// traditional and simplified form of referenced words, the simplified one is kept
+	glossVariantRe = regexp.MustCompile(`\p{Han}+\|(\p{Han}+)`)
+	// classifiers within a gloss, e.g. apple, CL:個|个[ge4]
+	glossClassifierRe = regexp.MustCompile(`(^|[,;]\s*)CL:\S*`)
+)
+
+// CleanGloss removes the classifier notes and the pinyin of referenced words of a gloss.
+// A gloss that lists classifiers only is removed entirely.
+func CleanGloss(gloss string) string {
+	gloss = glossClassifierRe.ReplaceAllString(gloss, "")
+	gloss = glossPinyinRe.ReplaceAllString(gloss, "")
+	gloss = glossVariantRe.ReplaceAllString(gloss, "$1")
+	return strings.Trim(strings.Join(strings.Fields(gloss), " "), " ,;")
+}
+
+var classifierRe = regexp.MustCompile(`CL:(\S+)`)
+
+// Classifiers returns the simplified measure words of an entry, e.g. 个 of
+// CL:個|个[ge4].
+func (e Entry) Classifiers() []string {
+	var classifiers []string
+	for _, g := range e.Glosses {
+		for _, m := range classifierRe.FindAllStringSubmatch(g, -1) {
+			for _, cl := range strings.Split(m[1], ",") {
+				cl = glossPinyinRe.ReplaceAllString(cl, "")
+				if _, simplified, ok := strings.Cut(cl, "|"); ok {
+					cl = simplified
+				}
+				if cl != "" && !contains(classifiers, cl) {
+					classifiers = append(classifiers, cl)
+				}
+			}
+		}
+	}
+	return classifiers
+}
@@ -0,0 +1,371 @@
+package dict
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// marked vowels by tone, the index is the tone
+var markedVowels = map[rune][]rune{
+	'a': []rune("aāáǎà"),
+	'e': []rune("eēéěè"),
+	'i': []rune("iīíǐì"),
+	'o': []rune("oōóǒò"),
+	'u': []rune("uūúǔù"),
+	'ü': []rune("üǖǘǚǜ"),
+}
+
+type toneMark struct {
+	vowel rune
+	tone  int
+}
+
+// tone and base vowel of the marked vowels
+var toneMarks = make(map[rune]toneMark)
+
+func init() {
+	for vowel, marked := range markedVowels {
+		for tone, r := range marked[1:] {
+			toneMarks[r] = toneMark{vowel, tone + 1}
+			toneMarks[unicode.ToUpper(r)] = toneMark{unicode.ToUpper(vowel), tone + 1}
+		}
+	}
+}
+
+var syllableRe = regexp.MustCompile(`(?i)[a-zü:]+[1-5]?|[^\sa-zü:0-9]+`)
+
+// syllables splits numbered pinyin into syllables and their tones, 0 if a syllable has
+// no tone number. u: and v are written as ü.
+func syllables(pinyin string) ([]string, []int) {
+	var out []string
+	var tones []int
+	for _, s := range syllableRe.FindAllString(pinyin, -1) {
+		tone := 0
+		if last := s[len(s)-1]; last >= '1' && last <= '5' {
+			tone = int(last-'0') % 5
+			s = s[:len(s)-1]
+		}
+		s = strings.NewReplacer("u:", "ü", "U:", "Ü", "v", "ü", "V", "Ü").Replace(s)
+		out = append(out, s)
+		tones = append(tones, tone)
+	}
+	return out, tones
+}
+
+// markSyllable puts the tone mark on the vowel pinyin orthography asks for: a and e
+// always carry it, o in ou, otherwise the last vowel.
+func markSyllable(s string, tone int) string {
+	if tone < 1 || tone > 4 {
+		return s
+	}
+	runes := []rune(s)
+	lower := []rune(strings.ToLower(s))
+	pos := indexRune(lower, 'a')
+	if pos < 0 {
+		pos = indexRune(lower, 'e')
+	}
+	if pos < 0 && strings.Contains(string(lower), "ou") {
+		pos = indexRune(lower, 'o')
+	}
+	for i := len(lower) - 1; pos < 0 && i >= 0; i-- {
+		if _, ok := markedVowels[lower[i]]; ok {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return s
+	}
+	marked := markedVowels[lower[pos]][tone]
+	if unicode.IsUpper(runes[pos]) {
+		marked = unicode.ToUpper(marked)
+	}
+	runes[pos] = marked
+	return string(runes)
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, v := range runes {
+		if v == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Marked converts numbered pinyin like "ni3 hao3" to pinyin with tone marks, "nǐ hǎo".
+func Marked(pinyin string) string {
+	s, tones := syllables(pinyin)
+	for i := range s {
+		s[i] = markSyllable(s[i], tones[i])
+	}
+	return strings.Join(s, " ")
+}
+
+// Word writes the numbered pinyin of a word with tone marks as one word, e.g. "xi1 an1"
+// as "xī'ān".
+func Word(pinyin string) string {
+	s, tones := syllables(pinyin)
+	var b strings.Builder
+	for i := range s {
+		if i > 0 && strings.ContainsRune("aeoāáǎàēéěèōóǒò", unicode.ToLower([]rune(s[i])[0])) {
+			b.WriteRune('\'')
+		}
+		b.WriteString(markSyllable(s[i], tones[i]))
+	}
+	return b.String()
+}
+
+// Numbered converts pinyin with tone marks like "yín háng" to numbered pinyin,
+// "yin2 hang2". The result is lower case with the syllables separated by spaces and 5 for
+// the neutral tone. Marked words like "yínháng" are split into syllables, numbered pinyin
+// like "yin2hang2" by the tone numbers.
+func Numbered(pinyin string) string {
+	var out []string
+	if hasToneMarks(pinyin) {
+		for _, s := range strings.FieldsFunc(strings.ToLower(pinyin), func(r rune) bool {
+			return unicode.IsSpace(r) || r == '\'' || r == '’'
+		}) {
+			if syllables, ok := SplitPinyin(s); ok {
+				out = append(out, syllables...)
+				continue
+			}
+			tone := 5
+			var b strings.Builder
+			for _, r := range s {
+				if m, ok := toneMarks[r]; ok {
+					r, tone = m.vowel, m.tone
+				}
+				b.WriteRune(r)
+			}
+			out = append(out, b.String()+strconv.Itoa(tone))
+		}
+		return strings.Join(out, " ")
+	}
+	s, tones := syllables(strings.ToLower(pinyin))
+	for i := range s {
+		if !unicode.IsLetter([]rune(s[i])[0]) {
+			continue
+		}
+		tone := tones[i]
+		if tone == 0 {
+			tone = 5
+		}
+		out = append(out, s[i]+strconv.Itoa(tone))
+	}
+	return strings.Join(out, " ")
+}
+
+// the syllables of mandarin without tones
+var validSyllables = make(map[string]bool)
+
+func init() {
+	for _, s := range strings.Fields(`
+		a ai an ang ao ba bai ban bang bao bei ben beng bi bian biao bie bin bing bo bu
+		ca cai can cang cao ce cei cen ceng cha chai chan chang chao che chen cheng chi
+		chong chou chu chua chuai chuan chuang chui chun chuo ci cong cou cu cuan cui cun
+		cuo da dai dan dang dao de dei den deng di dia dian diao die ding diu dong dou du
+		duan dui dun duo e ei en eng er fa fan fang fei fen feng fo fou fu ga gai gan gang
+		gao ge gei gen geng gong gou gu gua guai guan guang gui gun guo ha hai han hang hao
+		he hei hen heng hm hng hong hou hu hua huai huan huang hui hun huo ji jia jian jiang
+		jiao jie jin jing jiong jiu ju juan jue jun ka kai kan kang kao ke kei ken keng kong
+		kou ku kua kuai kuan kuang kui kun kuo la lai lan lang lao le lei leng li lia lian
+		liang liao lie lin ling liu lo long lou lu luan lun luo lü lüe ma mai man mang mao
+		me mei men meng mi mian miao mie min ming miu mo mou mu na nai nan nang nao ne nei
+		nen neng ng ni nian niang niao nie nin ning niu nong nou nu nuan nuo nü nüe o ou pa
+		pai pan pang pao pei pen peng pi pian piao pie pin ping po pou pu qi qia qian qiang
+		qiao qie qin qing qiong qiu qu quan que qun ran rang rao re ren reng ri rong rou ru
+		rua ruan rui run ruo sa sai san sang sao se sen seng sha shai shan shang shao she
+		shei shen sheng shi shou shu shua shuai shuan shuang shui shun shuo si song sou su
+		suan sui sun suo ta tai tan tang tao te teng ti tian tiao tie ting tong tou tu tuan
+		tui tun tuo wa wai wan wang wei wen weng wo wu xi xia xian xiang xiao xie xin xing
+		xiong xiu xu xuan xue xun ya yan yang yao ye yi yin ying yo yong you yu yuan yue yun
+		za zai zan zang zao ze zei zen zeng zha zhai zhan zhang zhao zhe zhei zhen zheng zhi
+		zhong zhou zhu zhua zhuai zhuan zhuang zhui zhun zhuo zi zong zou zu zuan zui zun zuo`) {
+		validSyllables[s] = true
+	}
+}
+
+var numberedSyllableRe = regexp.MustCompile(`([a-zü]+)([1-5])?`)
+
+// SplitPinyin splits a pinyin word like "xièxie", "Xī'ān" or "ni3hao3" into numbered
+// syllables, "xie4 xie5". Apostrophes and hyphens separate syllables, otherwise the split
+// with the fewest syllables and at most one tone mark per syllable is taken. It reports
+// false if the word is not pinyin.
+func SplitPinyin(word string) ([]string, bool) {
+	word = strings.NewReplacer("u:", "ü", "v", "ü").Replace(strings.ToLower(word))
+	var out []string
+	for _, part := range strings.FieldsFunc(word, func(r rune) bool {
+		return r == '\'' || r == '’' || r == '-'
+	}) {
+		if strings.IndexFunc(part, unicode.IsDigit) >= 0 {
+			// numbered pinyin, every syllable but the last needs a tone number
+			matches := numberedSyllableRe.FindAllStringSubmatchIndex(part, -1)
+			end := 0
+			for i, m := range matches {
+				if m[0] != end || (m[4] < 0 && i < len(matches)-1) {
+					return nil, false
+				}
+				s, tone := part[m[2]:m[3]], "5"
+				if m[4] >= 0 {
+					tone = part[m[4]:m[5]]
+				}
+				syllables, ok := splitMarked(s)
+				if !ok || len(syllables) != 1 {
+					return nil, false
+				}
+				out = append(out, strings.TrimRight(syllables[0], "5")+tone)
+				end = m[1]
+			}
+			if end != len(part) {
+				return nil, false
+			}
+			continue
+		}
+		syllables, ok := splitMarked(part)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, syllables...)
+	}
+	return out, len(out) > 0
+}
+
+// splitMarked splits lower case pinyin with tone marks and without separators into
+// numbered syllables.
+func splitMarked(s string) ([]string, bool) {
+	var base []rune
+	var tones []int
+	for _, r := range s {
+		tone := 0
+		if m, ok := toneMarks[r]; ok {
+			r, tone = m.vowel, m.tone
+		}
+		base = append(base, r)
+		tones = append(tones, tone)
+	}
+	// best[i] is the fewest syllables of base[:i], from[i] where its last syllable starts
+	n := len(base)
+	best := make([]int, n+1)
+	from := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = -1
+		for j := max(0, i-6); j < i; j++ {
+			if best[j] < 0 || !validSyllables[string(base[j:i])] || marks(tones[j:i]) > 1 {
+				continue
+			}
+			if best[i] < 0 || best[j]+1 < best[i] {
+				best[i], from[i] = best[j]+1, j
+			}
+		}
+	}
+	if n == 0 || best[n] < 0 {
+		return nil, false
+	}
+	var out []string
+	for i := n; i > 0; i = from[i] {
+		tone := 5
+		for _, t := range tones[from[i]:i] {
+			if t > 0 {
+				tone = t
+			}
+		}
+		out = append([]string{string(base[from[i]:i]) + strconv.Itoa(tone)}, out...)
+	}
+	return out, true
+}
+
+func marks(tones []int) int {
+	n := 0
+	for _, t := range tones {
+		if t > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Tones returns the tones of the syllables of a pinyin, numbered like "ni3 hao3" or
+// marked like "nǐ hǎo". Syllables without a tone count as neutral tone, 0. Syllables of
+// marked pinyin have to be separated.
+func Tones(pinyin string) []int {
+	var tones []int
+	if hasToneMarks(pinyin) {
+		for _, s := range strings.Fields(pinyin) {
+			tone := 0
+			for _, r := range s {
+				if m, ok := toneMarks[r]; ok {
+					tone = m.tone
+				}
+			}
+			tones = append(tones, tone)
+		}
+		return tones
+	}
+	s, numbered := syllables(pinyin)
+	for i := range s {
+		if unicode.IsLetter([]rune(s[i])[0]) {
+			tones = append(tones, numbered[i])
+		}
+	}
+	return tones
+}
+
+var toneNames = []string{"neutral tone", "first tone", "second tone", "third tone", "fourth tone"}
+
+// ToneName names a tone like "third tone".
+func ToneName(tone int) string {
+	if tone < 0 || tone >= len(toneNames) {
+		return toneNames[0]
+	}
+	return toneNames[tone]
+}
+
+func hasToneMarks(s string) bool {
+	for _, r := range s {
+		if _, ok := toneMarks[r]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keys of the pinyin index, lower case without spaces
+func numberedKey(pinyin string) string {
+	s, tones := syllables(strings.ToLower(pinyin))
+	var b strings.Builder
+	for i := range s {
+		b.WriteString(s[i])
+		if tones[i] > 0 {
+			b.WriteByte(byte('0' + tones[i]))
+		} else if unicode.IsLetter([]rune(s[i])[0]) {
+			b.WriteByte('5')
+		}
+	}
+	return b.String()
+}
+
+func markedKey(pinyin string) string {
+	if !hasToneMarks(pinyin) {
+		pinyin = Marked(pinyin)
+	}
+	return strings.Join(strings.Fields(strings.ToLower(pinyin)), "")
+}
+
+func tonelessKey(pinyin string) string {
+	var b strings.Builder
+	for _, r := range strings.ReplaceAll(strings.ToLower(pinyin), "u:", "ü") {
+		if m, ok := toneMarks[r]; ok {
+			r = unicode.ToLower(m.vowel)
+		}
+		switch {
+		case r == 'v':
+			r = 'ü'
+		case r == ':' || unicode.IsDigit(r) || unicode.IsSpace(r):
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package dict
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNumbered(t *testing.T) {
+	tests := []struct {
+		pinyin string
+		want   string
+	}{
+		{"yín háng", "yin2 hang2"},
+		{"yínháng", "yin2 hang2"},
+		{"Xī'ān", "xi1 an1"},
+		{"nǚ’ér", "nü3 er2"},
+		{"ma", "ma5"},
+		{"hǎo ma", "hao3 ma5"},
+		{"ni3 hao3", "ni3 hao3"},
+		{"yin2hang2", "yin2 hang2"},
+		{"Ni3 hao5", "ni3 hao5"},
+		{"ma0", "ma5"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Numbered(tt.pinyin); got != tt.want {
+			t.Errorf("Numbered(%q) = %q, want %q", tt.pinyin, got, tt.want)
+		}
+	}
+}
+
+func TestMarked(t *testing.T) {
+	tests := []struct {
+		pinyin string
+		want   string
+	}{
+		{"ni3 hao3", "nǐ hǎo"},
+		{"lu:4", "lǜ"},
+		{"xi1 an1", "xī ān"},
+		{"ma5", "ma"},
+	}
+	for _, tt := range tests {
+		if got := Marked(tt.pinyin); got != tt.want {
+			t.Errorf("Marked(%q) = %q, want %q", tt.pinyin, got, tt.want)
+		}
+	}
+	if got := Word("xi1 an1"); got != "xī'ān" {
+		t.Errorf("Word(xi1 an1) = %q", got)
+	}
+}
+
+func TestSplitPinyin(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+		ok   bool
+	}{
+		{"xièxie", []string{"xie4", "xie5"}, true},
+		{"Xī'ān", []string{"xi1", "an1"}, true},
+		{"nǚ’ér", []string{"nü3", "er2"}, true},
+		{"yínháng", []string{"yin2", "hang2"}, true},
+		{"ni3hao3", []string{"ni3", "hao3"}, true},
+		{"ni3-hao", []string{"ni3", "hao5"}, true},
+		{"lu:4", []string{"lü4"}, true},
+		{"lv4", []string{"lü4"}, true},
+		{"hao", []string{"hao5"}, true},
+		{"nihao3", nil, false},
+		{"hello", nil, false},
+		{"A4", []string{"a4"}, true},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := SplitPinyin(tt.word)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitPinyin(%q) = %v, %v, want %v, %v", tt.word, got, ok, tt.want, tt.ok)
+		}
+	}
+}
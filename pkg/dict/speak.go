@@ -0,0 +1,165 @@
+package dict
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultSenses caps the senses read aloud per word.
+const DefaultSenses = 3
+
+var (
+	// glosses that only point to other entries
+	crossReferenceRe = regexp.MustCompile(`(?i)^(\w+ )?variant of\b|^(see|see also|same as|used in|also written|also pr\.|abbr\. for|abbr\. of|Taiwan pr\.)\s`)
+	// parenthesized cross references within a gloss, e.g. (contraction of 不用[bu4 yong4])
+	crossReferenceNoteRe = regexp.MustCompile(`(?i)\(\s*(contraction of|abbr\. for|abbr\. of|variant of|see|also written|also pr\.)[^)]*\)`)
+	surnameRe            = regexp.MustCompile(`^surname \S+$`)
+	classifierForRe      = regexp.MustCompile(`(?i)^classifier\b`)
+	leadingDotsRe        = regexp.MustCompile(`^(\.\.\.|…)\s*`)
+)
+
+// abbreviations of cedict glosses and how they are read
+var abbreviations = []struct {
+	re   *regexp.Regexp
+	text string
+}{
+	{regexp.MustCompile(`\(lit\.\)|\blit\.`), "literally"},
+	{regexp.MustCompile(`\(fig\.\)|\bfig\.`), "figuratively"},
+	{regexp.MustCompile(`\(coll\.\)|\bcoll\.`), "colloquially"},
+	{regexp.MustCompile(`\(onom\.\)|\bonom\.`), "onomatopoeia"},
+	{regexp.MustCompile(`\(Tw\)`), "in Taiwan"},
+	{regexp.MustCompile(`\(dialect\)`), "in dialect"},
+	{regexp.MustCompile(`\(old\)`), "formerly"},
+	{regexp.MustCompile(`\(bound form\)|\(idiom\)`), ""},
+	{regexp.MustCompile(`\(s\)`), "s"},
+	{regexp.MustCompile(`\bsth\b`), "something"},
+	{regexp.MustCompile(`\bsb\b`), "somebody"},
+	{regexp.MustCompile(`\besp\.`), "especially"},
+	{regexp.MustCompile(`\be\.g\.`), "for example"},
+	{regexp.MustCompile(`\bi\.e\.`), "that is"},
+	{regexp.MustCompile(`\betc\b\.?`), "et cetera"},
+	{regexp.MustCompile(`\bapprox\.`), "approximately"},
+	{regexp.MustCompile(`\bcf\.`), "compare"},
+	{regexp.MustCompile(`\babbr\.`), "abbreviation"},
+	{regexp.MustCompile(`\s&\s`), " and "},
+}
+
+// SplitGlosses splits cedict and hsk definitions like "/to go/to leave/" or
+// "hello; hi" into glosses.
+func SplitGlosses(definition string) []string {
+	var glosses []string
+	for _, g := range strings.Split(definition, "/") {
+		for _, part := range strings.Split(g, "; ") {
+			if part = strings.TrimSpace(part); part != "" {
+				glosses = append(glosses, part)
+			}
+		}
+	}
+	return glosses
+}
+
+// Speakable turns glosses into senses read by the english voice: cross references and
+// variants are dropped, abbreviations expanded and classifier notes read as
+// "measure word 个". At most max senses are kept, DefaultSenses if max is 0. Surnames
+// are only kept if there is no other sense.
+func Speakable(glosses []string, max int) []string {
+	if max <= 0 {
+		max = DefaultSenses
+	}
+	var senses, surnames, classifiers []string
+	seen := make(map[string]bool)
+	for _, g := range glosses {
+		g = strings.TrimSpace(g)
+		if g == "" || crossReferenceRe.MatchString(g) {
+			continue
+		}
+		// classifier notes are read once at the end
+		for _, cl := range (Entry{Glosses: []string{g}}).Classifiers() {
+			if !contains(classifiers, cl) {
+				classifiers = append(classifiers, cl)
+			}
+		}
+		g = speakGloss(g)
+		key := strings.ToLower(g)
+		if g == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if surnameRe.MatchString(g) {
+			surnames = append(surnames, g)
+			continue
+		}
+		senses = append(senses, g)
+	}
+	if len(senses) == 0 {
+		senses = surnames
+	}
+	if len(senses) > max {
+		senses = senses[:max]
+	}
+	if len(classifiers) > 3 {
+		classifiers = classifiers[:3]
+	}
+	switch n := len(classifiers); n {
+	case 0:
+	case 1:
+		senses = append(senses, "measure word "+classifiers[0])
+	default:
+		senses = append(senses, "measure words "+strings.Join(classifiers[:n-1], ", ")+" and "+classifiers[n-1])
+	}
+	return senses
+}
+
+// speakGloss normalizes a single gloss.
+func speakGloss(g string) string {
+	g = crossReferenceNoteRe.ReplaceAllString(g, "")
+	g = glossClassifierRe.ReplaceAllString(g, "")
+	g = glossPinyinRe.ReplaceAllString(g, "")
+	g = glossVariantRe.ReplaceAllString(g, "$1")
+	g = leadingDotsRe.ReplaceAllString(g, "")
+	for _, a := range abbreviations {
+		g = a.re.ReplaceAllString(g, a.text)
+	}
+	if classifierForRe.MatchString(g) {
+		g = "measure word" + g[len("classifier"):]
+	}
+	// parentheses are not read, their content is
+	g = strings.NewReplacer("(", " ", ")", " ").Replace(g)
+	g = strings.Join(strings.Fields(g), " ")
+	return strings.Trim(strings.ReplaceAll(g, " ,", ","), " ,;:")
+}
+
+// CheckSpeakable runs a corpus of glosses and their expected senses, a case per line:
+//
+//	cedict glosses <TAB> max senses <TAB> senses separated by " | "
+//
+// Lines starting with # are comments. It returns a description of every mismatch.
+func CheckSpeakable(r io.Reader) ([]string, error) {
+	var mismatches []string
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Split(text, "\t")
+		if len(parts) != 3 {
+			return mismatches, fmt.Errorf("line %d: expected 3 tab separated columns", line)
+		}
+		max, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return mismatches, fmt.Errorf("line %d: invalid max senses %q", line, parts[1])
+		}
+		got := strings.Join(Speakable(SplitGlosses(parts[0]), max), " | ")
+		if got != parts[2] {
+			mismatches = append(mismatches, fmt.Sprintf("line %d: %s\n  want: %s\n  got:  %s", line, parts[0], parts[2], got))
+		}
+	}
+	return mismatches, scanner.Err()
+}
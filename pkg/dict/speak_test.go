@@ -0,0 +1,65 @@
+package dict
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSpeakableCorpus(t *testing.T) {
+	f, err := os.Open("testdata/speakable.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mismatches, err := CheckSpeakable(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mismatches {
+		t.Error(m)
+	}
+}
+
+func TestCheckSpeakable(t *testing.T) {
+	tests := []struct {
+		name       string
+		corpus     string
+		mismatches int
+		err        bool
+	}{
+		{"match", "# comment\n/to go/to leave/\t3\tto go | to leave\n", 0, false},
+		{"mismatch", "/to go/to leave/\t1\tto go | to leave\n", 1, false},
+		{"columns", "/to go/\t3\n", 0, true},
+		{"max", "/to go/\tthree\tto go\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches, err := CheckSpeakable(strings.NewReader(tt.corpus))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if len(mismatches) != tt.mismatches {
+				t.Errorf("mismatches = %q, want %d", mismatches, tt.mismatches)
+			}
+		})
+	}
+}
+
+func TestSplitGlosses(t *testing.T) {
+	tests := []struct {
+		definition string
+		want       []string
+	}{
+		{"/to go/to leave/", []string{"to go", "to leave"}},
+		{"hello; hi", []string{"hello", "hi"}},
+		{"apple, CL:個|个[ge4]", []string{"apple, CL:個|个[ge4]"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitGlosses(tt.definition); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitGlosses(%q) = %q, want %q", tt.definition, got, tt.want)
+		}
+	}
+}
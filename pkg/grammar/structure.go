@@ -0,0 +1,271 @@
+// Package grammar parses the structures of grammar patterns, formulas like
+// "Subj. + 把 + Obj. + Verb + [Complement]", and reads them in english with the chinese
+// literals read by a chinese voice.
+package grammar
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type Kind int
+
+const (
+	// a slot of the pattern like Subj. or Verb
+	Placeholder Kind = iota
+	// chinese text of the pattern like 把
+	Literal
+	// parts in brackets that can be left out
+	Optional
+	// parts separated by a slash, e.g. 不/没
+	Alternatives
+)
+
+// Part is an element of a structure. Optional parts and alternatives have parts, the
+// others text.
+type Part struct {
+	Kind  Kind
+	Text  string
+	Parts []Part
+}
+
+// Structure is a parsed pattern formula.
+type Structure struct {
+	Source string
+	Parts  []Part
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokHan
+	tokPlus
+	tokSlash
+	tokOpen
+	tokClose
+	tokOpenParen
+	tokCloseParen
+	tokEllipsis
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// quotes around literals and placeholders are not part of the structure
+const quotes = `'"“”‘’「」`
+
+func tokenize(formula string) []token {
+	var toks []token
+	runes := []rune(formula)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || strings.ContainsRune(quotes, r):
+			i++
+			continue
+		case r == '+' || r == '＋':
+			toks = append(toks, token{tokPlus, "+"})
+		case r == '/' || r == '／' || r == '|':
+			toks = append(toks, token{tokSlash, "/"})
+		case r == '[' || r == '［' || r == '【':
+			toks = append(toks, token{tokOpen, "["})
+		case r == ']' || r == '］' || r == '】':
+			toks = append(toks, token{tokClose, "]"})
+		case r == '(' || r == '（':
+			toks = append(toks, token{tokOpenParen, "("})
+		case r == ')' || r == '）':
+			toks = append(toks, token{tokCloseParen, ")"})
+		case r == '…' || r == '~' || r == '～' || strings.HasPrefix(string(runes[i:]), "..."):
+			for i < len(runes) && strings.ContainsRune(".…~～", runes[i]) {
+				i++
+			}
+			toks = append(toks, token{tokEllipsis, "…"})
+			continue
+		case unicode.Is(unicode.Han, r):
+			j := i
+			for j < len(runes) && unicode.Is(unicode.Han, runes[j]) {
+				j++
+			}
+			toks = append(toks, token{tokHan, string(runes[i:j])})
+			i = j
+			continue
+		default:
+			j := i
+			for j < len(runes) && !isSpecial(runes[j]) && !unicode.Is(unicode.Han, runes[j]) &&
+				!strings.HasPrefix(string(runes[j:]), "...") {
+				j++
+			}
+			toks = append(toks, token{tokWord, string(runes[i:j])})
+			i = j
+			continue
+		}
+		i++
+	}
+	return toks
+}
+
+func isSpecial(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(quotes+"+＋/／|[［【]］】(（)）…~～", r)
+}
+
+// Parse parses a formula. Parts are separated by +, optional parts are in brackets and
+// alternatives separated by a slash. Notes in parentheses are dropped unless they hold
+// chinese, which is taken as optional like 很 in "Subj. + (很) + Adj.". Ellipses stand for
+// any text, e.g. in "越…越…".
+func Parse(formula string) (*Structure, error) {
+	p := &parser{toks: tokenize(formula)}
+	parts, err := p.sequence(-1)
+	if err != nil {
+		return nil, fmt.Errorf("parse structure %q: %w", formula, err)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("parse structure %q: no parts", formula)
+	}
+	return &Structure{Source: formula, Parts: parts}, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// sequence parses parts up to the closing token, -1 for the end of the formula.
+func (p *parser) sequence(closing tokenKind) ([]Part, error) {
+	var parts []Part
+	for {
+		t, ok := p.peek()
+		if !ok {
+			if closing >= 0 {
+				return nil, fmt.Errorf("missing closing bracket")
+			}
+			return parts, nil
+		}
+		switch {
+		case t.kind == closing:
+			p.pos++
+			return parts, nil
+		case t.kind == tokClose || t.kind == tokCloseParen:
+			return nil, fmt.Errorf("unexpected %s", t.text)
+		case t.kind == tokPlus:
+			p.pos++
+			continue
+		}
+		part, ok, err := p.alternatives()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			parts = append(parts, part)
+		}
+	}
+}
+
+// alternatives parses a part and the parts following it separated by slashes.
+func (p *parser) alternatives() (Part, bool, error) {
+	var alts []Part
+	for {
+		part, ok, err := p.atom()
+		if err != nil {
+			return Part{}, false, err
+		}
+		if ok {
+			alts = append(alts, part)
+		}
+		if t, more := p.peek(); !more || t.kind != tokSlash {
+			break
+		}
+		p.pos++
+	}
+	switch len(alts) {
+	case 0:
+		return Part{}, false, nil
+	case 1:
+		return alts[0], true, nil
+	}
+	return Part{Kind: Alternatives, Parts: alts}, true, nil
+}
+
+func (p *parser) atom() (Part, bool, error) {
+	t, ok := p.peek()
+	if !ok {
+		return Part{}, false, fmt.Errorf("missing part at the end")
+	}
+	p.pos++
+	switch t.kind {
+	case tokHan:
+		return Part{Kind: Literal, Text: t.text}, true, nil
+	case tokEllipsis:
+		return Part{Kind: Placeholder, Text: t.text}, true, nil
+	case tokWord:
+		// words not separated by + make up one placeholder, e.g. Time Phrase
+		words := []string{t.text}
+		for next, ok := p.peek(); ok && next.kind == tokWord; next, ok = p.peek() {
+			words = append(words, next.text)
+			p.pos++
+		}
+		return Part{Kind: Placeholder, Text: strings.Join(words, " ")}, true, nil
+	case tokOpen:
+		parts, err := p.sequence(tokClose)
+		if err != nil {
+			return Part{}, false, err
+		}
+		return Part{Kind: Optional, Parts: parts}, len(parts) > 0, nil
+	case tokOpenParen:
+		parts, err := p.sequence(tokCloseParen)
+		if err != nil {
+			return Part{}, false, err
+		}
+		if !hasLiteral(parts) {
+			return Part{}, false, nil
+		}
+		return Part{Kind: Optional, Parts: parts}, true, nil
+	}
+	return Part{}, false, fmt.Errorf("unexpected %s", t.text)
+}
+
+func hasLiteral(parts []Part) bool {
+	for _, part := range parts {
+		if part.Kind == Literal || hasLiteral(part.Parts) {
+			return true
+		}
+	}
+	return false
+}
+
+// String writes the structure in its canonical form, e.g. "Subj. + 不/没 + [Obj.]".
+func (s *Structure) String() string {
+	return join(s.Parts)
+}
+
+func join(parts []Part) string {
+	var out []string
+	for _, part := range parts {
+		out = append(out, part.String())
+	}
+	return strings.Join(out, " + ")
+}
+
+func (p Part) String() string {
+	switch p.Kind {
+	case Optional:
+		return "[" + join(p.Parts) + "]"
+	case Alternatives:
+		var alts []string
+		for _, alt := range p.Parts {
+			alts = append(alts, alt.String())
+		}
+		return strings.Join(alts, "/")
+	}
+	return p.Text
+}
@@ -0,0 +1,65 @@
+package grammar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    string
+	}{
+		{"Subj. + 把 + Obj. + Verb + [Complement]", "Subj. + 把 + Obj. + Verb + [Complement]"},
+		{"Subj.+不/没+Verb", "Subj. + 不/没 + Verb"},
+		{"Subj. ＋ 不／没 ＋ Verb", "Subj. + 不/没 + Verb"},
+		{"Subj. + (很) + Adj.", "Subj. + [很] + Adj."},
+		{"Subj. + Verb (transitive) + Obj.", "Subj. + Verb + Obj."},
+		{"越…越…", "越 + … + 越 + …"},
+		{"越...越...", "越 + … + 越 + …"},
+		{"Time Phrase + Subj. + Verb", "Time Phrase + Subj. + Verb"},
+		{"“是”+ Noun", "是 + Noun"},
+		{"【Subj.】+ 在 + Place", "[Subj.] + 在 + Place"},
+		{"Subj. + [也/都 + 不] + Verb", "Subj. + [也/都 + 不] + Verb"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.formula)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.formula, err)
+			continue
+		}
+		if got := s.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestParseParts(t *testing.T) {
+	s, err := Parse("Subj. + 不/没 + [Obj.]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Part{
+		{Kind: Placeholder, Text: "Subj."},
+		{Kind: Alternatives, Parts: []Part{{Kind: Literal, Text: "不"}, {Kind: Literal, Text: "没"}}},
+		{Kind: Optional, Parts: []Part{{Kind: Placeholder, Text: "Obj."}}},
+	}
+	if !reflect.DeepEqual(s.Parts, want) {
+		t.Errorf("parts = %+v, want %+v", s.Parts, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, formula := range []string{
+		"",
+		"+ +",
+		"(note)",
+		"Subj. + [Verb",
+		"Subj. + Verb]",
+		"Subj. + 不/",
+	} {
+		if s, err := Parse(formula); err == nil {
+			t.Errorf("Parse(%q) = %q, want error", formula, s)
+		}
+	}
+}
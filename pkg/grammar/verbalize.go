@@ -0,0 +1,129 @@
+package grammar
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Phrase is a piece of the reading of a structure, chinese phrases are read by a chinese
+// voice.
+type Phrase struct {
+	Text    string
+	Chinese bool
+}
+
+// how abbreviated placeholders are read, keys are lower case without the trailing dot
+var placeholders = map[string]string{
+	"s": "subject", "subj": "subject", "subject": "subject",
+	"o": "object", "obj": "object", "object": "object",
+	"v": "verb", "verb": "verb", "vp": "verb phrase",
+	"n": "noun", "noun": "noun", "np": "noun phrase",
+	"adj": "adjective", "adjective": "adjective", "adjp": "adjective phrase",
+	"adv": "adverb", "adverb": "adverb",
+	"num": "number", "number": "number",
+	"m": "measure word", "mw": "measure word", "cl": "measure word", "measure word": "measure word",
+	"comp": "complement", "complement": "complement",
+	"pron": "pronoun", "pronoun": "pronoun",
+	"prep": "preposition", "preposition": "preposition",
+	"conj": "conjunction", "conjunction": "conjunction",
+	"loc": "location", "place": "place",
+	"qw": "question word", "q": "question",
+	"sb": "somebody", "sth": "something",
+	"phr": "phrase", "clause": "clause",
+	"…": "something",
+}
+
+// Verbalize reads the structure as an english list of its parts, e.g.
+// "Subj. + 把 + Obj. + Verb + [Complement]" as "subject, 把, object, verb and optionally
+// complement". Chinese literals are separate phrases.
+func (s *Structure) Verbalize() []Phrase {
+	return merge(list(s.Parts, ", ", " and "))
+}
+
+// Reading returns the verbalized structure as text, e.g. for transcripts.
+func (s *Structure) Reading() string {
+	var b strings.Builder
+	for _, p := range list(s.Parts, ", ", " and ") {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
+
+// list reads parts separated by sep, the last one by last.
+func list(parts []Part, sep, last string) []Phrase {
+	var out []Phrase
+	for i, part := range parts {
+		switch {
+		case i == 0:
+		case i == len(parts)-1:
+			out = append(out, Phrase{Text: last})
+		default:
+			out = append(out, Phrase{Text: sep})
+		}
+		out = append(out, verbalize(part)...)
+	}
+	return out
+}
+
+func verbalize(p Part) []Phrase {
+	switch p.Kind {
+	case Literal:
+		return []Phrase{{Text: p.Text, Chinese: true}}
+	case Optional:
+		return append([]Phrase{{Text: "optionally "}}, list(p.Parts, " ", " and ")...)
+	case Alternatives:
+		return list(p.Parts, ", ", " or ")
+	}
+	return []Phrase{{Text: readPlaceholder(p.Text)}}
+}
+
+// readPlaceholder reads abbreviations of placeholders in full and separates numbers, e.g.
+// Verb1 as "verb 1". Single capitals like A and B are kept.
+func readPlaceholder(text string) string {
+	var words []string
+	for _, w := range strings.Fields(text) {
+		number := strings.TrimLeftFunc(w, func(r rune) bool { return !unicode.IsDigit(r) })
+		w = strings.TrimSuffix(w, number)
+		key := strings.ToLower(strings.TrimSuffix(w, "."))
+		switch {
+		case placeholders[key] != "":
+			w = placeholders[key]
+		case len(key) == 1:
+			w = strings.ToUpper(key)
+		default:
+			w = strings.ToLower(strings.TrimSuffix(w, "."))
+		}
+		if number != "" {
+			w += " " + number
+		}
+		words = append(words, w)
+	}
+	if r, ok := placeholders[strings.ToLower(strings.Join(words, " "))]; ok {
+		return r
+	}
+	return strings.Join(words, " ")
+}
+
+// merge joins consecutive english phrases and trims the separators around chinese
+// phrases.
+func merge(phrases []Phrase) []Phrase {
+	var out []Phrase
+	for _, p := range phrases {
+		if n := len(out); n > 0 && !p.Chinese && !out[n-1].Chinese {
+			out[n-1].Text += p.Text
+			continue
+		}
+		out = append(out, p)
+	}
+	var trimmed []Phrase
+	for _, p := range out {
+		if !p.Chinese {
+			p.Text = strings.TrimSpace(p.Text)
+			p.Text = strings.TrimSpace(strings.TrimPrefix(p.Text, ","))
+		}
+		if p.Text != "" {
+			trimmed = append(trimmed, p)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,89 @@
+package grammar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVerbalize(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    []Phrase
+	}{
+		{"Subj. + 把 + Obj. + Verb + [Complement]", []Phrase{
+			{Text: "subject,"},
+			{Text: "把", Chinese: true},
+			{Text: "object, verb and optionally complement"},
+		}},
+		{"Subj. + 不/没 + Verb", []Phrase{
+			{Text: "subject,"},
+			{Text: "不", Chinese: true},
+			{Text: "or"},
+			{Text: "没", Chinese: true},
+			{Text: "and verb"},
+		}},
+		{"越…越…", []Phrase{
+			{Text: "越", Chinese: true},
+			{Text: "something,"},
+			{Text: "越", Chinese: true},
+			{Text: "and something"},
+		}},
+		{"A + 比 + B + Adj.", []Phrase{
+			{Text: "A,"},
+			{Text: "比", Chinese: true},
+			{Text: "B and adjective"},
+		}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.formula)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Verbalize(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Verbalize(%q) = %+v, want %+v", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestReading(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    string
+	}{
+		{"Subj. + 把 + Obj. + Verb + [Complement]", "subject, 把, object, verb and optionally complement"},
+		{"Subj. + (很) + Adj.", "subject, optionally 很 and adjective"},
+		{"Verb1 + 了 + Verb2", "verb 1, 了 and verb 2"},
+		{"Subj. + MW + Noun Phrase", "subject, measure word and noun phrase"},
+		{"Sb. + 给 + Sth.", "somebody, 给 and something"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.formula)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Reading(); got != tt.want {
+			t.Errorf("Reading(%q) = %q, want %q", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestReadPlaceholder(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Subj.", "subject"},
+		{"V", "verb"},
+		{"Verb1", "verb 1"},
+		{"A", "A"},
+		{"b", "B"},
+		{"Measure Word", "measure word"},
+		{"Time Phrase", "time phrase"},
+		{"…", "something"},
+	}
+	for _, tt := range tests {
+		if got := readPlaceholder(tt.text); got != tt.want {
+			t.Errorf("readPlaceholder(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
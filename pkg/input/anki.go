@@ -0,0 +1,278 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/anki"
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
+	"golang.org/x/exp/slog"
+)
+
+// AnkiNoteType maps items to the notes of an anki note type. The field values are
+// html templates executed with an AnkiItem.
+type AnkiNoteType struct {
+	anki.NoteType
+	Values []string `json:"values"` // a value per field
+}
+
+// AnkiItem is the data of the field templates.
+type AnkiItem struct {
+	Item  any    // Word, Cloze or Grammar
+	Audio string // [sound:...] of the synthesized clip, empty if there is none
+}
+
+const ankiCSS = `.card { font-family: arial; font-size: 20px; text-align: center; }
+.zh { font-size: 36px; }
+.en { color: #555; }`
+
+// DefaultAnkiNoteTypes are the note types of words, clozes and patterns used if no
+// note types are configured.
+var DefaultAnkiNoteTypes = map[string]*AnkiNoteType{
+	"words": {
+		NoteType: anki.NoteType{
+			Name:   "zh-audio word",
+			Fields: []string{"Chinese", "English", "Tones", "Note", "Examples", "Audio"},
+			Templates: []anki.Template{
+				{
+					Name:  "Listening",
+					Front: `{{Audio}}`,
+					Back:  `{{FrontSide}}<hr id=answer><div class=zh>{{Chinese}}</div><div>{{Tones}}</div><div class=en>{{English}}</div><div>{{Note}}</div><div>{{Examples}}</div>`,
+				},
+				{
+					Name:  "Reading",
+					Front: `<div class=zh>{{Chinese}}</div>`,
+					Back:  `{{FrontSide}}<hr id=answer>{{Audio}}<div>{{Tones}}</div><div class=en>{{English}}</div><div>{{Note}}</div><div>{{Examples}}</div>`,
+				},
+			},
+			CSS: ankiCSS,
+		},
+		Values: []string{
+			`{{.Item.Chinese}}`,
+			`{{meaning .Item}}`,
+			`{{join .Item.Tones ", "}}`,
+			`{{.Item.Note}}`,
+			`{{examples .Item.Examples}}`,
+			`{{.Audio}}`,
+		},
+	},
+	"clozes": {
+		NoteType: anki.NoteType{
+			Name:   "zh-audio cloze",
+			Cloze:  true,
+			Fields: []string{"Text", "English", "Word", "Note", "Audio"},
+			Templates: []anki.Template{
+				{
+					Name:  "Cloze",
+					Front: `<div class=zh>{{cloze:Text}}</div><div class=en>{{English}}</div>`,
+					Back:  `<div class=zh>{{cloze:Text}}</div><div class=en>{{English}}</div><hr id=answer><div>{{Word}}</div><div>{{Note}}</div>{{Audio}}`,
+				},
+			},
+			CSS: ankiCSS + "\n.cloze { font-weight: bold; color: blue; }",
+		},
+		Values: []string{
+			`{{cloze .Item.SentenceBack .Item.Word.Chinese}}`,
+			`{{.Item.English}}`,
+			`{{.Item.Word.Chinese}} {{meaning .Item.Word}}`,
+			`{{.Item.Note}}`,
+			`{{.Audio}}`,
+		},
+	},
+	"patterns": {
+		NoteType: anki.NoteType{
+			Name:   "zh-audio pattern",
+			Fields: []string{"Pattern", "Structure", "Note", "Examples", "Summary", "Audio"},
+			Templates: []anki.Template{
+				{
+					Name:  "Pattern",
+					Front: `<div class=zh>{{Pattern}}</div>`,
+					Back:  `{{FrontSide}}<hr id=answer><div>{{Structure}}</div><div>{{Note}}</div><div>{{Examples}}</div><div class=en>{{Summary}}</div>{{Audio}}`,
+				},
+			},
+			CSS: ankiCSS,
+		},
+		Values: []string{
+			`{{.Item.Pattern}}`,
+			`{{.Item.Structure}}`,
+			`{{.Item.Note}}`,
+			`{{examples .Item.Examples}}`,
+			`{{join .Item.Summary "<br>"}}`,
+			`{{.Audio}}`,
+		},
+	},
+}
+
+// LoadAnkiNoteTypes reads note types by kind from a json file, kinds missing in the
+// file keep their default.
+func LoadAnkiNoteTypes(path string) (map[string]*AnkiNoteType, error) {
+	types := make(map[string]*AnkiNoteType, len(DefaultAnkiNoteTypes))
+	for kind, t := range DefaultAnkiNoteTypes {
+		types[kind] = t
+	}
+	if path == "" {
+		return types, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configured map[string]*AnkiNoteType
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal note types %s: %w", path, err)
+	}
+	for kind, t := range configured {
+		if _, ok := DefaultAnkiNoteTypes[kind]; !ok {
+			return nil, fmt.Errorf("unknown kind %s in %s, expected words, clozes or patterns", kind, path)
+		}
+		if len(t.Values) != len(t.Fields) {
+			return nil, fmt.Errorf("note type %s has %d fields but %d values", t.Name, len(t.Fields), len(t.Values))
+		}
+		types[kind] = t
+	}
+	return types, nil
+}
+
+var ankiFuncs = template.FuncMap{
+	"join":     strings.Join,
+	"meaning":  meaning,
+	"examples": examples,
+	"cloze":    cloze,
+}
+
+// meaning lists the english of a word, hsk translations are preferred over cedict.
+func meaning(w Word) string {
+	var senses []string
+	for _, h := range w.HSK {
+		senses = append(senses, h.HSKEnglish)
+	}
+	if len(senses) == 0 {
+		for _, c := range w.Cedict {
+			for _, g := range dict.SplitGlosses(c.CedictEnglish) {
+				if g = dict.CleanGloss(g); g != "" {
+					senses = append(senses, g)
+				}
+			}
+		}
+	}
+	if len(senses) == 0 {
+		return w.English
+	}
+	return removeWrappingSingleQuotes(strings.Join(senses, "; "))
+}
+
+func examples(examples []Example) template.HTML {
+	var lines []string
+	for _, e := range examples {
+		lines = append(lines, template.HTMLEscapeString(e.Chinese)+" "+template.HTMLEscapeString(removeWrappingSingleQuotes(e.English)))
+	}
+	return template.HTML(strings.Join(lines, "<br>"))
+}
+
+// cloze hides the first occurrence of the word, the whole sentence if the word does not
+// occur so that the note still gets a card.
+func cloze(sentence, word string) template.HTML {
+	sentence = template.HTMLEscapeString(sentence)
+	word = template.HTMLEscapeString(word)
+	if word == "" || !strings.Contains(sentence, word) {
+		return template.HTML("{{c1::" + sentence + "}}")
+	}
+	return template.HTML(strings.Replace(sentence, word, "{{c1::"+word+"}}", 1))
+}
+
+// AnkiExporter builds an anki deck from the json items of a kind, with the clips
+// synthesized for the items attached as media.
+type AnkiExporter struct {
+	Kind      string // words, clozes or patterns
+	NoteType  *AnkiNoteType
+	Deck      string
+	AudioDirs []string // searched in order for the clip of an item
+	Tags      []string
+}
+
+func (a *AnkiExporter) Build(path string) (*anki.Deck, error) {
+	var items []any
+	var keys []string
+	switch a.Kind {
+	case "words":
+		words, err := loadWordsFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			items, keys = append(items, w), append(keys, w.Chinese)
+		}
+	case "clozes":
+		clozes, err := loadClozesFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range clozes {
+			items, keys = append(items, c), append(keys, c.Filename)
+		}
+	case "patterns":
+		patterns, err := loadFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range patterns {
+			items, keys = append(items, p), append(keys, p.Pattern)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %s, expected words, clozes or patterns", a.Kind)
+	}
+
+	values := make([]*template.Template, len(a.NoteType.Values))
+	for i, v := range a.NoteType.Values {
+		t, err := template.New(a.NoteType.Fields[i]).Funcs(ankiFuncs).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of field %s: %w", a.NoteType.Fields[i], err)
+		}
+		values[i] = t
+	}
+
+	deck := &anki.Deck{Name: a.Deck}
+	for i, item := range items {
+		data := AnkiItem{Item: item}
+		if clip := a.findAudio(keys[i]); clip != "" {
+			data.Audio = "[sound:" + anki.MediaName(clip) + "]"
+			deck.Media = append(deck.Media, clip)
+		} else {
+			slog.Warn("no audio found", "item", keys[i])
+		}
+		note := &anki.Note{
+			Type: &a.NoteType.NoteType,
+			// the kind and not the note type names the guid, renaming a note type keeps the notes
+			GUID: anki.GUID("zh-audio", a.Kind, keys[i]),
+			Tags: a.Tags,
+		}
+		for _, t := range values {
+			var b strings.Builder
+			if err := t.Execute(&b, data); err != nil {
+				return nil, fmt.Errorf("failed to render field %s of %s: %w", t.Name(), keys[i], err)
+			}
+			note.Fields = append(note.Fields, b.String())
+		}
+		deck.Notes = append(deck.Notes, note)
+	}
+	return deck, nil
+}
+
+// findAudio returns the clip of an item, mp3 or wav as written by runs without an mp3
+// output.
+func (a *AnkiExporter) findAudio(key string) string {
+	name := strings.TrimSuffix(audio.GetFilename(key), ".mp3")
+	for _, dir := range a.AudioDirs {
+		for _, ext := range []string{".mp3", ".wav"} {
+			p := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
+	return ""
+}
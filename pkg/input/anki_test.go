@@ -0,0 +1,69 @@
+package input
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fbngrm/zh-audio/pkg/anki"
+)
+
+func TestAnkiExporterFindsAudio(t *testing.T) {
+	items, mp3Dir, wavDir := t.TempDir(), t.TempDir(), t.TempDir()
+	for i, w := range []string{"你好", "好", "再见"} {
+		data, err := json.Marshal(Word{Chinese: w, English: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(items, string(rune('a'+i))+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// mp3 clips are preferred over wav clips of the same dir, earlier dirs over later ones
+	for _, clip := range []string{
+		filepath.Join(mp3Dir, "好.mp3"),
+		filepath.Join(mp3Dir, "好.wav"),
+		filepath.Join(wavDir, "好.mp3"),
+		filepath.Join(wavDir, "你好.wav"),
+	} {
+		if err := os.WriteFile(clip, []byte("clip"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := &AnkiExporter{
+		Kind:      "words",
+		NoteType:  DefaultAnkiNoteTypes["words"],
+		Deck:      "zh",
+		AudioDirs: []string{mp3Dir, wavDir},
+	}
+	deck, err := a.Build(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"你好": filepath.Join(wavDir, "你好.wav"),
+		"好":  filepath.Join(mp3Dir, "好.mp3"),
+		"再见": "",
+	}
+	got := make(map[string]string)
+	for _, n := range deck.Notes {
+		audio := n.Fields[len(n.Fields)-1]
+		got[n.Fields[0]] = ""
+		for _, clip := range deck.Media {
+			if audio == "[sound:"+anki.MediaName(clip)+"]" {
+				got[n.Fields[0]] = clip
+			}
+		}
+		if got[n.Fields[0]] == "" && audio != "" {
+			t.Errorf("note %s refers to %s, which is no media of the deck", n.Fields[0], audio)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("clips %v, want %v", got, want)
+	}
+	if len(deck.Media) != 2 {
+		t.Errorf("media %q", deck.Media)
+	}
+}
@@ -0,0 +1,213 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/anki"
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"golang.org/x/exp/slog"
+)
+
+// AnkiFields names the fields of anki notes the parts of words and clozes are read from.
+type AnkiFields struct {
+	Chinese string // the word, or the sentence of clozes
+	English string
+	Word    string // word of clozes, the first cloze deletion if unset or empty
+	Meaning string // english of the word of clozes
+	Note    string
+	Audio   string // field the clip is attached to
+}
+
+var DefaultAnkiFields = map[string]AnkiFields{
+	"words":  {Chinese: "Chinese", English: "English", Note: "Note", Audio: "Audio"},
+	"clozes": {Chinese: "Text", English: "English", Word: "Word", Meaning: "Meaning", Note: "Note", Audio: "Audio"},
+}
+
+// ParseAnkiFields overrides the default fields of a kind by a mapping like
+// "chinese=Hanzi,english=Meaning,audio=Sound".
+func ParseAnkiFields(kind, mapping string) (AnkiFields, error) {
+	fields, ok := DefaultAnkiFields[kind]
+	if !ok {
+		return fields, fmt.Errorf("unknown kind %s, expected words or clozes", kind)
+	}
+	for _, pair := range strings.Split(mapping, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, field, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fields, fmt.Errorf("invalid field mapping %q, expected key=field", pair)
+		}
+		field = strings.TrimSpace(field)
+		switch strings.TrimSpace(key) {
+		case "chinese":
+			fields.Chinese = field
+		case "english":
+			fields.English = field
+		case "word":
+			fields.Word = field
+		case "meaning":
+			fields.Meaning = field
+		case "note":
+			fields.Note = field
+		case "audio":
+			fields.Audio = field
+		default:
+			return fields, fmt.Errorf("unknown key %q in field mapping, expected chinese, english, word, meaning, note or audio", key)
+		}
+	}
+	if fields.Chinese == "" || fields.Audio == "" {
+		return fields, fmt.Errorf("field mapping needs the chinese and audio fields")
+	}
+	return fields, nil
+}
+
+// AnkiChange is an update of the audio field of a note.
+type AnkiChange struct {
+	NoteID int64
+	Item   string
+	Field  string
+	Value  string
+}
+
+// AnkiSync attaches audio to existing notes of a running anki. Notes without a clip in
+// the audio field are synthesized like words or clozes of a json input, the clip is
+// stored in the media folder and added to the audio field.
+type AnkiSync struct {
+	Connect *anki.Connect
+	Kind    string // words or clozes
+	Fields  AnkiFields
+	Words   *WordProcessor
+	Clozes  *ClozeProcessor
+	// DryRun reports the changes without synthesizing or updating anything
+	DryRun bool
+}
+
+// Sync updates the notes matching the query and returns the changes made, or the changes
+// that would be made in a dry-run. Notes that fail are logged and skipped.
+func (s *AnkiSync) Sync(ctx context.Context, query string) ([]AnkiChange, error) {
+	ids, err := s.Connect.FindNotes(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.Connect.NotesInfo(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var changes []AnkiChange
+	for _, n := range notes {
+		if _, ok := n.Fields[s.Fields.Audio]; !ok {
+			slog.Warn("note has no audio field", "note", n.NoteID, "model", n.ModelName, "field", s.Fields.Audio)
+			continue
+		}
+		current := n.Field(s.Fields.Audio)
+		if strings.Contains(current, "[sound:") {
+			continue
+		}
+		key, fetch, err := s.item(n)
+		if err != nil {
+			slog.Warn("skip note", "note", n.NoteID, "err", err)
+			continue
+		}
+		change := AnkiChange{
+			NoteID: n.NoteID,
+			Item:   key,
+			Field:  s.Fields.Audio,
+			Value:  current + "[sound:" + anki.MediaName(audio.GetFilename(key)) + "]",
+		}
+		if s.DryRun {
+			changes = append(changes, change)
+			continue
+		}
+		path, err := fetch()
+		if err != nil {
+			slog.Error("failed to synthesize audio", "note", n.NoteID, "item", key, "err", err)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return changes, err
+		}
+		// the media folder is shared with other decks, a plain 好.mp3 could replace theirs
+		stored, err := s.Connect.StoreMediaFile(ctx, anki.MediaName(path), data)
+		if err != nil {
+			return changes, err
+		}
+		change.Value = current + "[sound:" + stored + "]"
+		if err := s.Connect.UpdateNoteFields(ctx, n.NoteID, map[string]string{change.Field: change.Value}); err != nil {
+			return changes, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// item maps a note onto a word or cloze and returns its key, which names the clip, and
+// the synthesis of the clip.
+func (s *AnkiSync) item(n anki.NoteInfo) (string, func() (string, error), error) {
+	chinese := ankiText(n.Field(s.Fields.Chinese))
+	if chinese == "" {
+		return "", nil, fmt.Errorf("field %s is empty", s.Fields.Chinese)
+	}
+	english := ankiText(n.Field(s.Fields.English))
+	word := Word{
+		Chinese: chinese,
+		English: english,
+		Note:    ankiText(n.Field(s.Fields.Note)),
+	}
+	// the english of the note stands in for the dictionary translations
+	if english != "" {
+		word.HSK = []HSKEntry{{HSKEnglish: english}}
+	}
+
+	switch s.Kind {
+	case "words":
+		return chinese, func() (string, error) { return s.Words.Fetch(word) }, nil
+	case "clozes":
+		sentence := clozeDeletionRe.ReplaceAllString(chinese, "$1")
+		word.Chinese = ankiText(n.Field(s.Fields.Word))
+		if word.Chinese == "" {
+			if m := clozeDeletionRe.FindStringSubmatch(chinese); m != nil {
+				word.Chinese = m[1]
+			}
+		}
+		if word.Chinese == "" {
+			return "", nil, fmt.Errorf("cloze %s has no word", sentence)
+		}
+		// the english of a cloze note translates the sentence, not the word
+		word.English, word.HSK = "", nil
+		if meaning := ankiText(n.Field(s.Fields.Meaning)); meaning != "" {
+			word.HSK = []HSKEntry{{HSKEnglish: meaning}}
+		}
+		cl := Cloze{
+			SentenceBack: sentence,
+			Filename:     sentence,
+			English:      english,
+			Note:         word.Note,
+			Word:         word,
+		}
+		return sentence, func() (string, error) { return s.Clozes.Fetch(cl) }, nil
+	}
+	return "", nil, fmt.Errorf("unknown kind %s, expected words or clozes", s.Kind)
+}
+
+// clozeDeletionRe matches {{c1::text}} and {{c1::text::hint}}
+var clozeDeletionRe = regexp.MustCompile(`{{c\d+::(.*?)(?:::[^}]*)?}}`)
+
+var (
+	ankiBreakRe  = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>`)
+	ankiMarkupRe = regexp.MustCompile(`<[^>]*>|\[sound:[^\]]*\]`)
+)
+
+// ankiText strips the html and sound tags of a field value.
+func ankiText(value string) string {
+	value = ankiBreakRe.ReplaceAllString(value, " ")
+	value = ankiMarkupRe.ReplaceAllString(value, "")
+	value = strings.ReplaceAll(html.UnescapeString(value), "\u00a0", " ")
+	return strings.Join(strings.Fields(value), " ")
+}
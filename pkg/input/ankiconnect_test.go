@@ -0,0 +1,169 @@
+package input
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fbngrm/zh-audio/pkg/anki"
+	"github.com/fbngrm/zh-audio/pkg/audio"
+)
+
+// fakeAnkiConnect serves the actions of the AnkiConnect api the sync uses from a map of
+// notes, stored media and field updates are recorded.
+type fakeAnkiConnect struct {
+	notes   map[int64]anki.NoteInfo
+	media   map[string][]byte
+	updates map[int64]map[string]string
+	actions []string
+}
+
+func newFakeAnkiConnect(t *testing.T, notes ...anki.NoteInfo) (*fakeAnkiConnect, *anki.Connect) {
+	f := &fakeAnkiConnect{
+		notes:   make(map[int64]anki.NoteInfo),
+		media:   make(map[string][]byte),
+		updates: make(map[int64]map[string]string),
+	}
+	for _, n := range notes {
+		f.notes[n.NoteID] = n
+	}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, anki.NewConnect(srv.URL, "")
+}
+
+func (f *fakeAnkiConnect) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action  string          `json:"action"`
+		Version int             `json:"version"`
+		Params  json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version != 6 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	f.actions = append(f.actions, req.Action)
+	var result any
+	var params struct {
+		Notes    []int64 `json:"notes"`
+		Filename string  `json:"filename"`
+		Data     string  `json:"data"`
+		Note     struct {
+			ID     int64             `json:"id"`
+			Fields map[string]string `json:"fields"`
+		} `json:"note"`
+	}
+	json.Unmarshal(req.Params, &params)
+	switch req.Action {
+	case "findNotes":
+		var ids []int64
+		for id := range f.notes {
+			ids = append(ids, id)
+		}
+		result = ids
+	case "notesInfo":
+		var notes []anki.NoteInfo
+		for _, id := range params.Notes {
+			notes = append(notes, f.notes[id])
+		}
+		result = notes
+	case "storeMediaFile":
+		data, _ := base64.StdEncoding.DecodeString(params.Data)
+		f.media[params.Filename] = data
+		result = params.Filename
+	case "updateNoteFields":
+		f.updates[params.Note.ID] = params.Note.Fields
+	default:
+		json.NewEncoder(w).Encode(map[string]any{"result": nil, "error": "unsupported action " + req.Action})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"result": result, "error": nil})
+}
+
+func wordNote(id int64, chinese, english, sound string) anki.NoteInfo {
+	return anki.NoteInfo{
+		NoteID:    id,
+		ModelName: "zh",
+		Fields: map[string]anki.NoteField{
+			"Chinese": {Value: chinese},
+			"English": {Value: english},
+			"Audio":   {Value: sound},
+		},
+	}
+}
+
+func newTestAnkiSync(t *testing.T, connect *anki.Connect) *AnkiSync {
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(azure.Close)
+	client, err := audio.NewAzureClient("key", azure.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AnkiSync{
+		Connect: connect,
+		Kind:    "words",
+		Fields:  DefaultAnkiFields["words"],
+		Words:   &WordProcessor{AzureDownloader: client},
+	}
+}
+
+func TestAnkiSync(t *testing.T) {
+	fake, connect := newFakeAnkiConnect(t,
+		wordNote(1, "好", "good", ""),
+		wordNote(2, "你好", "hello", "[sound:你好.mp3]"),
+		wordNote(3, "", "empty", ""),
+	)
+	sync := newTestAnkiSync(t, connect)
+	changes, err := sync.Sync(context.Background(), "deck:zh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := anki.MediaName("好.mp3")
+	if len(changes) != 1 || changes[0].NoteID != 1 || changes[0].Value != "[sound:"+name+"]" {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if _, ok := fake.media[name]; !ok || len(fake.media) != 1 {
+		t.Errorf("stored media %v, want %s", mediaNames(fake.media), name)
+	}
+	if _, ok := fake.media["好.mp3"]; ok {
+		t.Error("clip stored under its plain name")
+	}
+	if got := fake.updates[1]["Audio"]; got != "[sound:"+name+"]" {
+		t.Errorf("audio field of note 1 = %q", got)
+	}
+	if len(fake.updates) != 1 {
+		t.Errorf("updated notes %v, want only 1", fake.updates)
+	}
+}
+
+func TestAnkiSyncDryRun(t *testing.T) {
+	fake, connect := newFakeAnkiConnect(t, wordNote(1, "好", "good", ""))
+	sync := newTestAnkiSync(t, connect)
+	sync.DryRun = true
+	changes, err := sync.Sync(context.Background(), "deck:zh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Value != "[sound:"+anki.MediaName("好.mp3")+"]" {
+		t.Errorf("changes = %+v", changes)
+	}
+	for _, action := range fake.actions {
+		if action != "findNotes" && action != "notesInfo" {
+			t.Errorf("dry-run called %s", action)
+		}
+	}
+}
+
+func mediaNames(m map[string][]byte) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,79 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/google"
+	"golang.org/x/exp/slog"
+)
+
+// GetBilingualAudio renders a dialog line by line as chinese, english, chinese. Lines without
+// an inline translation get translated one by one. Next to one file per line, a combined file
+// and a transcript of the chinese and english pairs is written for each dialog.
+func (p *DialogProcessor) GetBilingualAudio(path string) error {
+	dialogs, err := p.loadDialogues(path)
+	if err != nil {
+		return err
+	}
+	for _, dialog := range dialogs {
+		if len(dialog.Lines) == 0 {
+			continue
+		}
+		dialogText := strings.ReplaceAll(dialog.Text, "。", "")
+		outDir := filepath.Join(p.OutDir, "bilingual", strings.TrimSuffix(audio.GetFilename(dialogText), ".mp3"))
+		if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+			return err
+		}
+
+		lines, err := p.fetchLines(dialog)
+		if err != nil {
+			return err
+		}
+
+		combined := audio.NewConcatenatorWithOptions(p.Render)
+		var transcript strings.Builder
+		for i, line := range dialog.Lines {
+			english := line.English
+			if english == "" {
+				english, err = google.Translate(line.Text)
+				if err != nil {
+					return err
+				}
+			}
+			englishPath, err := p.fetchCached(english, "", p.AzureDownloader.PrepareEnglishQuery(english, "0ms"))
+			if err != nil {
+				return err
+			}
+
+			single := audio.NewConcatenatorWithOptions(p.Render)
+			for _, c := range []*audio.Concatenator{single, combined} {
+				text := audio.SegmentText{Chinese: strings.TrimSpace(line.Text), English: english}
+				c.AddWithText(lines[i], 1000, text)
+				c.AddCue(audio.CueEnglish, 200)
+				c.AddWithText(englishPath, 1000, text)
+				c.AddWithText(lines[i], 1500, text)
+			}
+			linePath := audio.OutputPath(filepath.Join(outDir, fmt.Sprintf("%02d_%s", i+1, audio.GetFilename(line.Text))))
+			if err := single.Merge(linePath); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(&transcript, "%s: %s\n%s: %s\n\n", line.Speaker, strings.TrimSpace(line.Text), line.Speaker, english)
+		}
+
+		combinedPath := audio.OutputPath(filepath.Join(outDir, audio.GetFilename(dialogText)))
+		if err := combined.Merge(combinedPath); err != nil {
+			return err
+		}
+		transcriptPath := filepath.Join(outDir, "transcript.txt")
+		if err := os.WriteFile(transcriptPath, []byte(transcript.String()), 0644); err != nil {
+			return err
+		}
+		slog.Info("bilingual audio generated", "path", combinedPath, "transcript", transcriptPath)
+	}
+	return nil
+}
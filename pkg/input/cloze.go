@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
 )
 
 type CedictEntry struct {
+	// the glosses of an entry as in the dictionary, joined by "/", e.g.
+	// "apple/CL:個|个[ge4],顆|颗[ke1]". Readers clean them, see dict.SplitGlosses.
 	CedictEnglish string `json:"cedict_en"`
 }
 
@@ -34,6 +36,7 @@ type Word struct {
 	Translation string        `json:"translation"` // this is coming from data/translations file
 	Examples    []Example     `json:"examples"`
 	Tones       []string      `json:"tones"`
+	Pinyin      string        `json:"pinyin,omitempty"` // optional, overrides the reading of the word, e.g. hang2 for 行
 }
 
 type Cloze struct {
@@ -47,6 +50,13 @@ type Cloze struct {
 
 type ClozeProcessor struct {
 	AzureDownloader *audio.AzureClient
+	// optional, fills in missing definitions and tones
+	Dict *dict.Dict
+	// senses of the meaning read aloud, dict.DefaultSenses if 0
+	Senses int
+	// optional, synthesizes every voice on its own and renders them with these options,
+	// so that the clips get subtitles, otherwise azure synthesizes them in one piece
+	Render *audio.RenderOptions
 }
 
 func (c *ClozeProcessor) GetAzureAudio(path string) error {
@@ -55,93 +65,74 @@ func (c *ClozeProcessor) GetAzureAudio(path string) error {
 		return err
 	}
 	for _, cl := range clozes {
-		if len(cl.Word.HSK) == 0 && len(cl.Word.Cedict) == 0 {
-			return fmt.Errorf("word %s has no translation", cl.Word.Chinese)
+		if _, err := c.Fetch(cl); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		query := ""
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.Word.Chinese, "2000ms", false)
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.Word.Chinese, "1000ms", false)
-
-		tones := ""
-		for i, t := range cl.Word.Tones {
-			tones += t
-			if i < len(cl.Word.Tones)-1 {
-				tones += ", followed by "
-			}
-		}
-		if len(cl.Word.Tones) == 1 {
-			query += c.AzureDownloader.PrepareEnglishQuery("The tone is the "+tones, "1000ms")
-		} else if len(cl.Word.Tones) > 1 {
-			query += c.AzureDownloader.PrepareEnglishQuery("The tones are "+tones, "1000ms")
-		}
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.Word.Chinese, "1000ms", false)
-
-		wordEng := ""
-		if len(cl.Word.HSK) != 0 {
-			for i, h := range cl.Word.HSK {
-				wordEng += h.HSKEnglish + " "
-				if i < len(cl.Word.HSK)-1 {
-					wordEng += "or "
-				}
-			}
-		}
-		// Regex to match ", CL" followed by anything until the next whitespace
-		re := regexp.MustCompile(`, CL[^\s]*`)
-		if len(cl.Word.HSK) == 0 && len(cl.Word.Cedict) != 0 {
-			for i, h := range cl.Word.Cedict {
-				wordEng += re.ReplaceAllString(h.CedictEnglish, "") + " "
-				if i < len(cl.Word.Cedict)-1 {
-					wordEng += "or "
-				}
-			}
-		}
-		query += c.replaceTextWithAudio(removeWrappingSingleQuotes(wordEng), "1000ms")
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.Word.Chinese, "1500ms", true)
-		query += c.replaceTextWithAudio(removeWrappingSingleQuotes(cl.Word.Note), "200ms")
-		query += c.AzureDownloader.PrepareEnglishQuery("Here are a few example sentences", "1000ms")
-
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.SentenceBack, "2000ms", true)
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.SentenceBack, "2000ms", true)
-		query += c.AzureDownloader.PrepareEnglishQuery(cl.English, "2000ms")
-		query += c.AzureDownloader.PrepareQueryWithRandomVoice(cl.SentenceBack, "2000ms", true)
-
-		for _, e := range cl.Word.Examples {
-			query += c.AzureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
-			query += c.AzureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
-			query += c.AzureDownloader.PrepareEnglishQuery(removeWrappingSingleQuotes(e.English), "2000ms")
-			query += c.AzureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+// Fetch synthesizes the audio of a cloze and returns the path of the clip.
+func (c *ClozeProcessor) Fetch(cl Cloze) (string, error) {
+	if c.Dict != nil {
+		fillFromDict(c.Dict, &cl.Word, cl.Word.Pinyin)
+	}
+	if len(cl.Word.HSK) == 0 && len(cl.Word.Cedict) == 0 {
+		return "", fmt.Errorf("word %s has no translation", cl.Word.Chinese)
+	}
+	// the pinyin of the item overrides the reading of its word in this clip only
+	azure := c.AzureDownloader
+	if cl.Word.Pinyin != "" {
+		var err error
+		azure, err = azure.WithOverride(cl.Word.Chinese, cl.Word.Pinyin)
+		if err != nil {
+			return "", fmt.Errorf("cloze %s: %w", cl.SentenceBack, err)
 		}
+	}
 
-		query = cleanQuery(query)
-		fmt.Println(strings.Count(query, "<voice"))
-		// fmt.Println(query)
-		if _, err := c.AzureDownloader.Fetch(context.Background(), query, audio.GetFilename(cl.Filename)); err != nil {
-			return err
+	query := ""
+	query += azure.PrepareQueryWithRandomVoice(cl.Word.Chinese, "2000ms", false)
+	query += azure.PrepareQueryWithRandomVoice(cl.Word.Chinese, "1000ms", false)
+
+	tones := ""
+	for i, t := range cl.Word.Tones {
+		tones += t
+		if i < len(cl.Word.Tones)-1 {
+			tones += ", followed by "
 		}
 	}
-	return nil
-}
+	if len(cl.Word.Tones) == 1 {
+		query += azure.PrepareEnglishQuery("The tone is the "+tones, "1000ms")
+	} else if len(cl.Word.Tones) > 1 {
+		query += azure.PrepareEnglishQuery("The tones are "+tones, "1000ms")
+	}
+	query += azure.PrepareQueryWithRandomVoice(cl.Word.Chinese, "1000ms", false)
+
+	wordEng := spokenMeaning(cl.Word, c.Senses)
+	query += azure.PrepareMixedQuery(wordEng, "1000ms")
+	query += azure.PrepareQueryWithRandomVoice(cl.Word.Chinese, "1500ms", true)
+	query += azure.PrepareMixedQuery(removeWrappingSingleQuotes(cl.Word.Note), "200ms")
+	query += azure.PrepareEnglishQuery("Here are a few example sentences", "1000ms")
+
+	query += azure.PrepareQueryWithRandomVoice(cl.SentenceBack, "2000ms", true)
+	query += azure.PrepareQueryWithRandomVoice(cl.SentenceBack, "2000ms", true)
+	query += azure.PrepareEnglishQuery(cl.English, "2000ms")
+	query += azure.PrepareQueryWithRandomVoice(cl.SentenceBack, "2000ms", true)
+
+	for _, e := range cl.Word.Examples {
+		query += azure.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+		query += azure.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+		query += azure.PrepareEnglishQuery(removeWrappingSingleQuotes(e.English), "2000ms")
+		query += azure.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+	}
 
-func (c *ClozeProcessor) replaceTextWithAudio(text, pause string) string {
-	// Define a regex pattern to match sequences of Chinese characters
-	chineseRe := regexp.MustCompile(`[\p{Han}]+`)
-	// Update the regex pattern to match English phrases with surrounding punctuation included
-	englishRe := regexp.MustCompile(`[A-Za-z]+(?:'[A-Za-z]+)?(?:[\s]*[,!?;:.]*[\s]*[A-Za-z]+(?:'[A-Za-z]+)?)*[,.!?;:]*`)
-
-	// Replace English text with audio
-	text = englishRe.ReplaceAllStringFunc(text, func(englishText string) string {
-		audio := c.AzureDownloader.PrepareEnglishQuery(englishText, pause)
-		return audio
-	})
-
-	// Replace Chinese text with audio
-	text = chineseRe.ReplaceAllStringFunc(text, func(chineseText string) string {
-		audio := c.AzureDownloader.PrepareQueryWithRandomVoice(chineseText, pause, false)
-		return audio
-	})
-
-	return text
+	query = cleanQuery(query)
+	fmt.Println(strings.Count(query, "<voice"))
+	// fmt.Println(query)
+	if c.Render != nil {
+		return azure.FetchSegments(context.Background(), query, audio.GetFilename(cl.Filename), *c.Render)
+	}
+	return azure.Fetch(context.Background(), query, audio.GetFilename(cl.Filename))
 }
 
 func loadClozesFromDir(dir string) ([]Cloze, error) {
@@ -5,15 +5,19 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/fbngrm/zh-audio/pkg/audio"
 	"github.com/fbngrm/zh-audio/pkg/google"
+	"golang.org/x/exp/slog"
 )
 
 type DialogLine struct {
 	Speaker string
 	Text    string
+	English string // optional inline translation, separated from the text by a pipe
 }
 
 type RawDialog struct {
@@ -27,6 +31,9 @@ type RawDialog struct {
 type DialogProcessor struct {
 	GCPDownloader   *audio.GCPDownloader
 	AzureDownloader *audio.AzureClient
+	Cache           *audio.Cache
+	OutDir          string
+	Render          audio.RenderOptions
 }
 
 func (p *DialogProcessor) GetAzureAudio(path string) error {
@@ -50,7 +57,13 @@ func (p *DialogProcessor) GetAzureAudio(path string) error {
 			query = p.AzureDownloader.PrepareQueryWithRandomVoice(dialogText, "0.0", false)
 		}
 
-		if _, err := p.AzureDownloader.Fetch(context.Background(), query, audio.GetFilename(dialogText)); err != nil {
+		// with subtitles every line is synthesized on its own, so that its timings are known
+		if p.Render.Subtitles {
+			_, err = p.AzureDownloader.FetchSegments(context.Background(), query, audio.GetFilename(dialogText), p.Render)
+		} else {
+			_, err = p.AzureDownloader.Fetch(context.Background(), query, audio.GetFilename(dialogText))
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -190,7 +203,56 @@ func (p *DialogProcessor) loadDialogues(path string) ([]RawDialog, error) {
 	return dialogs, nil
 }
 
+// fetchCached returns the path of the cached audio for text read by voice or downloads it
+// with query from azure. The voice is part of the key, the same line of two speakers is
+// read by the voice of each.
+func (p *DialogProcessor) fetchCached(text, voice, query string) (string, error) {
+	cachePath := p.Cache.GetVoiceCachePath(text, voice)
+	if p.Cache.IsInCache(cachePath) {
+		return cachePath, nil
+	}
+	slog.Debug("not in cache, download with azure", "query", query)
+	return p.AzureDownloader.Fetch(context.Background(), query, filepath.Base(cachePath))
+}
+
+// fetchLines returns the audio of every line of the dialog, spoken by the voice of its speaker.
+func (p *DialogProcessor) fetchLines(dialog RawDialog) ([]string, error) {
+	voices := p.AzureDownloader.GetVoices(dialog.Speakers)
+	lines := make([]string, len(dialog.Lines))
+	for i, line := range dialog.Lines {
+		voice, ok := voices[line.Speaker]
+		if !ok {
+			fmt.Printf("could not find voice for speaker: %s\n", line.Speaker)
+		}
+		lineText := strings.ReplaceAll(line.Text, "。", "")
+		query := p.AzureDownloader.PrepareQuery(lineText, voice, "0ms", false)
+		path, err := p.fetchCached(lineText, voice, query)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = path
+	}
+	return lines, nil
+}
+
+func sortedSpeakers(speakers map[string]struct{}) []string {
+	s := make([]string, 0, len(speakers))
+	for speaker := range speakers {
+		s = append(s, speaker)
+	}
+	sort.Strings(s)
+	return s
+}
+
 func splitSpeakerAndText(line string) DialogLine {
+	var english string
+	for _, sep := range []string{"|", "｜"} {
+		if i := strings.Index(line, sep); i != -1 {
+			english = strings.TrimSpace(line[i+len(sep):])
+			line = line[:i]
+			break
+		}
+	}
 	parts := []string{line}
 	if strings.Contains(line, ":") {
 		parts = strings.Split(line, ":")
@@ -201,10 +263,12 @@ func splitSpeakerAndText(line string) DialogLine {
 		return DialogLine{
 			"A",
 			parts[0],
+			english,
 		}
 	}
 	return DialogLine{
 		parts[0],
 		parts[1],
+		english,
 	}
 }
@@ -0,0 +1,200 @@
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+)
+
+// fakeAzure synthesizes every query as a tone of 100ms per character of its text and
+// records the queries.
+type fakeAzure struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+var ssmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+func newFakeAzure(t *testing.T) (*fakeAzure, *audio.AzureClient) {
+	f := &fakeAzure{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.queries = append(f.queries, string(body))
+		f.mu.Unlock()
+		text := strings.Join(strings.Fields(ssmlTagRe.ReplaceAllString(string(body), "")), "")
+		w.Write(toneWAV(time.Duration(len([]rune(text))) * 100 * time.Millisecond))
+	}))
+	t.Cleanup(srv.Close)
+	client, err := audio.NewAzureClient("key", srv.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client
+}
+
+// toneWAV returns a 16 bit mono wav file of a 440Hz tone at 16kHz.
+func toneWAV(d time.Duration) []byte {
+	const rate = 16000
+	n := int(d.Seconds() * rate)
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+2*n))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(rate), uint32(2 * rate), uint16(2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(2*n))
+	for i := 0; i < n; i++ {
+		binary.Write(&b, binary.LittleEndian, int16(0.5*math.MaxInt16*math.Sin(2*math.Pi*440*float64(i)/rate)))
+	}
+	return b.Bytes()
+}
+
+// newTestDialogProcessor returns a processor synthesizing with a fake azure and recording
+// the outputs in a manifest.
+func newTestDialogProcessor(t *testing.T) (*DialogProcessor, *fakeAzure) {
+	fake, client := newFakeAzure(t)
+	manifest := audio.NewManifest("test")
+	return &DialogProcessor{
+		AzureDownloader: client,
+		Cache:           &audio.Cache{AudioCacheDir: t.TempDir(), Manifest: manifest},
+		OutDir:          t.TempDir(),
+		Render:          audio.RenderOptions{Manifest: manifest},
+	}, fake
+}
+
+func writeDialog(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dialog.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// output returns the segments of the output the manifest recorded under name.
+func output(t *testing.T, m *audio.Manifest, name string) []audio.Segment {
+	t.Helper()
+	for _, o := range m.Outputs {
+		if o.File == name {
+			return o.Segments
+		}
+	}
+	var names []string
+	for _, o := range m.Outputs {
+		names = append(names, o.File)
+	}
+	t.Fatalf("no output %s in %v", name, names)
+	return nil
+}
+
+func TestSplitSpeakerAndText(t *testing.T) {
+	tests := []struct {
+		line string
+		want DialogLine
+	}{
+		{"A:你好", DialogLine{Speaker: "A", Text: "你好"}},
+		{"B：你好吗", DialogLine{Speaker: "B", Text: "你好吗"}},
+		{"你好", DialogLine{Speaker: "A", Text: "你好"}},
+		{"A:你好|hello", DialogLine{Speaker: "A", Text: "你好", English: "hello"}},
+		{"A:你好 | hello, how are you?", DialogLine{Speaker: "A", Text: "你好 ", English: "hello, how are you?"}},
+		{"B：谢谢｜thanks", DialogLine{Speaker: "B", Text: "谢谢", English: "thanks"}},
+		{"谢谢|thanks: a lot", DialogLine{Speaker: "A", Text: "谢谢", English: "thanks: a lot"}},
+		{"A:好|", DialogLine{Speaker: "A", Text: "好"}},
+	}
+	for _, tt := range tests {
+		if got := splitSpeakerAndText(tt.line); got != tt.want {
+			t.Errorf("splitSpeakerAndText(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFetchLinesKeyedByVoice(t *testing.T) {
+	p, _ := newTestDialogProcessor(t)
+	dialogs, err := p.loadDialogues(writeDialog(t, "A:你好", "B:你好", "A:再见"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := p.fetchLines(dialogs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	voices := p.AzureDownloader.GetVoices(dialogs[0].Speakers)
+	if voices["A"] == voices["B"] {
+		t.Fatalf("speakers share the voice %s", voices["A"])
+	}
+	if lines[0] == lines[1] {
+		t.Errorf("the line of A and B is one clip %s", lines[0])
+	}
+	for i, speaker := range []string{"A", "B", "A"} {
+		if !strings.HasSuffix(lines[i], "_"+voices[speaker]+".mp3") {
+			t.Errorf("line %d of %s is %s, want it keyed by %s", i, speaker, lines[i], voices[speaker])
+		}
+	}
+	// the voices do not depend on the order the speakers are ranged over
+	for i := 0; i < 10; i++ {
+		if again := p.AzureDownloader.GetVoices(dialogs[0].Speakers); !reflect.DeepEqual(again, voices) {
+			t.Fatalf("voices %v, then %v", voices, again)
+		}
+	}
+}
+
+func TestGetBilingualAudio(t *testing.T) {
+	p, _ := newTestDialogProcessor(t)
+	path := writeDialog(t, "A:你好|hello", "B:谢谢|thank you")
+	if err := p.GetBilingualAudio(path); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(p.OutDir, "bilingual", "你好谢谢")
+	var files []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		files = append(files, e.Name())
+	}
+	ext := filepath.Ext(audio.OutputPath("x.mp3"))
+	want := []string{"01_你好" + ext, "02_谢谢" + ext, "transcript.txt", "你好谢谢" + ext}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files %v, want %v", files, want)
+	}
+	transcript, err := os.ReadFile(filepath.Join(dir, "transcript.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(transcript), "A: 你好\nA: hello\n\nB: 谢谢\nB: thank you\n\n"; got != want {
+		t.Errorf("transcript %q, want %q", got, want)
+	}
+
+	// every line is read chinese, english, chinese, the combined file has all lines
+	var texts []string
+	for _, s := range output(t, p.Render.Manifest, "你好谢谢"+ext) {
+		text := s.Chinese
+		if strings.HasSuffix(s.File, "hello.mp3") || strings.HasSuffix(s.File, "thankyou.mp3") {
+			text = s.English
+		}
+		texts = append(texts, text)
+	}
+	if want := []string{"你好", "hello", "你好", "谢谢", "thank you", "谢谢"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("combined reads %v, want %v", texts, want)
+	}
+	if n := len(output(t, p.Render.Manifest, "02_谢谢"+ext)); n != 3 {
+		t.Errorf("line file has %d segments, want 3", n)
+	}
+}
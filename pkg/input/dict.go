@@ -0,0 +1,62 @@
+package input
+
+import (
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/dict"
+)
+
+// fillFromDict adds the missing cedict entries and tones of a word. Tones are taken from
+// the given pinyin, from the common dictionary entry if it is empty or has not a syllable
+// per character, e.g. marked pinyin without spaces.
+func fillFromDict(d *dict.Dict, w *Word, pinyin string) {
+	if len(w.Cedict) == 0 && d != nil {
+		for _, e := range d.Lookup(w.Chinese) {
+			if len(e.Definitions()) > 0 {
+				w.Cedict = append(w.Cedict, cedictEntry(e))
+			}
+		}
+	}
+	if len(w.Tones) == 0 {
+		for _, t := range d.WordTones(w.Chinese, pinyin) {
+			w.Tones = append(w.Tones, dict.ToneName(t))
+		}
+	}
+}
+
+// cedictEntry keeps the glosses as in cedict, cleaning is left to the readers since the
+// classifier notes are read as measure words.
+func cedictEntry(e dict.Entry) CedictEntry {
+	return CedictEntry{CedictEnglish: strings.Join(e.Glosses, "/")}
+}
+
+// spokenMeaning returns the english read for a word, the hsk translations or otherwise
+// the cedict definitions, normalized for speech and capped at senses.
+func spokenMeaning(w Word, senses int) string {
+	return strings.Join(dict.Speakable(meaningGlosses(w), senses), ", ")
+}
+
+// promptMeaning returns the spoken meaning of a word without the measure words, which
+// are chinese and would give the answer away in a drill prompt.
+func promptMeaning(w Word, senses int) string {
+	var out []string
+	for _, s := range dict.Speakable(meaningGlosses(w), senses) {
+		if dict.HanCount(s) == 0 {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+func meaningGlosses(w Word) []string {
+	var glosses []string
+	for _, h := range w.HSK {
+		glosses = append(glosses, dict.SplitGlosses(h.HSKEnglish)...)
+	}
+	if len(glosses) == 0 {
+		for _, c := range w.Cedict {
+			glosses = append(glosses, dict.SplitGlosses(c.CedictEnglish)...)
+		}
+	}
+	return glosses
+}
@@ -0,0 +1,64 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fbngrm/zh-audio/pkg/dict"
+)
+
+func TestFillFromDict(t *testing.T) {
+	d, err := dict.Read(strings.NewReader(`曾 曾 [Zeng1] /surname Zeng/
+曾 曾 [ceng2] /once/already/
+蘋果 苹果 [ping2 guo3] /apple/CL:個|个[ge4],顆|颗[ke1]/
+個 个 [ge4] /variant of 個|个[ge4]/
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		chinese string
+		pinyin  string
+		cedict  []string
+		tones   []string
+	}{
+		{"苹果", "", []string{"apple/CL:個|个[ge4],顆|颗[ke1]"}, []string{"second tone", "third tone"}},
+		{"曾", "", []string{"surname Zeng", "once/already"}, []string{"second tone"}},
+		{"曾", "zeng1", []string{"surname Zeng", "once/already"}, []string{"first tone"}},
+		{"个", "ge4", []string{"variant of 個|个[ge4]"}, []string{"fourth tone"}},
+		{"坏", "huai4", nil, []string{"fourth tone"}},
+	}
+	for _, tt := range tests {
+		w := Word{Chinese: tt.chinese}
+		fillFromDict(d, &w, tt.pinyin)
+		var cedict []string
+		for _, c := range w.Cedict {
+			cedict = append(cedict, c.CedictEnglish)
+		}
+		if !reflect.DeepEqual(cedict, tt.cedict) {
+			t.Errorf("%s: cedict = %q, want %q", tt.chinese, cedict, tt.cedict)
+		}
+		if !reflect.DeepEqual(w.Tones, tt.tones) {
+			t.Errorf("%s: tones = %q, want %q", tt.chinese, w.Tones, tt.tones)
+		}
+	}
+}
+
+func TestPromptMeaning(t *testing.T) {
+	tests := []struct {
+		word Word
+		want string
+	}{
+		{Word{Cedict: []CedictEntry{{CedictEnglish: "apple/CL:個|个[ge4],顆|颗[ke1]"}}}, "apple"},
+		{Word{Cedict: []CedictEntry{{CedictEnglish: "person/CL:個|个[ge4],位[wei4]"}}}, "person"},
+		{Word{Cedict: []CedictEntry{{CedictEnglish: "classifier for people"}}}, "measure word for people"},
+		{Word{HSK: []HSKEntry{{HSKEnglish: "good; well"}}}, "good, well"},
+		{Word{Cedict: []CedictEntry{{CedictEnglish: "CL:個|个[ge4]"}}}, ""},
+	}
+	for _, tt := range tests {
+		if got := promptMeaning(tt.word, 0); got != tt.want {
+			t.Errorf("promptMeaning(%+v) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
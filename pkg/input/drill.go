@@ -0,0 +1,228 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
+	"github.com/fbngrm/zh-audio/pkg/google"
+	"golang.org/x/exp/slog"
+)
+
+// the learner gets the length of the answer times this factor to say it, plus a fixed
+// amount of time to recall it.
+const (
+	drillGapFactor = 1.5
+	drillMinGap    = 1500 // ms
+)
+
+// Prompt is a step of the production drill, the english prompt and the chinese answer.
+type Prompt struct {
+	English string
+	Chinese string
+	// optional, reads Word by Pinyin in the answer
+	Word   string
+	Pinyin string
+}
+
+// drillItem is an input item and its prompts, rendered to one file.
+type drillItem struct {
+	name    string
+	prompts []Prompt
+}
+
+// DrillProcessor renders production drills: the english prompt is played first, followed
+// by a gap for the learner to say the chinese, then the chinese answer at normal speed and
+// slowly word by word, and optionally the english once more.
+type DrillProcessor struct {
+	AzureDownloader *audio.AzureClient
+	Cache           *audio.Cache
+	OutDir          string
+	Render          audio.RenderOptions
+	// optional, fills in meanings of words and splits answers into words for the slow reading
+	Dict *dict.Dict
+	// senses of the meaning of words read as prompt, dict.DefaultSenses if 0
+	Senses int
+	// play the english prompt again after the answer
+	RepeatEnglish bool
+}
+
+// GetDrillAudio renders a drill per item of an input of the words, clozes, sentences or
+// patterns mode.
+func (p *DrillProcessor) GetDrillAudio(kind, path string) error {
+	items, err := p.drillItems(kind, path)
+	if err != nil {
+		return err
+	}
+	outDir := filepath.Join(p.OutDir, "drill")
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+items:
+	for _, item := range items {
+		concatenator := audio.NewConcatenatorWithOptions(p.Render)
+		for _, prompt := range item.prompts {
+			if err := p.addPrompt(concatenator, prompt); err != nil {
+				slog.Error("failed to add prompt, skip item", "item", item.name, "chinese", prompt.Chinese, "err", err)
+				continue items
+			}
+		}
+		if len(concatenator.Files) == 0 {
+			continue
+		}
+		outPath := audio.OutputPath(filepath.Join(outDir, audio.GetFilename(item.name)))
+		if err := concatenator.Merge(outPath); err != nil {
+			slog.Error("concat files", "item", item.name, "error", err)
+			continue
+		}
+		slog.Debug("drill audio generated", "item", item.name, "path", outPath)
+	}
+	return nil
+}
+
+func (p *DrillProcessor) addPrompt(concatenator *audio.Concatenator, prompt Prompt) error {
+	if prompt.English == "" || prompt.Chinese == "" {
+		slog.Warn("prompt without english or chinese, skip", "chinese", prompt.Chinese, "english", prompt.English)
+		return nil
+	}
+	// the pinyin of the item overrides the reading of its word in this prompt only, the
+	// clips are cached by the overridden reading
+	azure := p.AzureDownloader
+	if prompt.Pinyin != "" {
+		var err error
+		azure, err = azure.WithOverride(prompt.Word, prompt.Pinyin)
+		if err != nil {
+			return fmt.Errorf("prompt %s: %w", prompt.Chinese, err)
+		}
+	}
+	cache := p.Cache.WithLexicon(azure.Lexicon)
+	text := audio.SegmentText{Chinese: prompt.Chinese, English: prompt.English}
+
+	// chinese in the prompt, like a word the translation refers to, is not read by the
+	// english voice
+	english, err := p.fetchCached(azure, cache, prompt.English, azure.PrepareMixedQuery(prompt.English, "0ms"))
+	if err != nil {
+		return err
+	}
+	// the answers are cached apart from the clips of the other modes, those read the
+	// chinese twice or are the audio of the whole item, like the words mode
+	speaker := azure.GetRandomVoice()
+	answer, err := p.fetchCached(azure, cache, prompt.Chinese+"_answer", azure.PrepareQuery(prompt.Chinese, speaker, "0ms", false))
+	if err != nil {
+		return err
+	}
+	slow, err := p.fetchCached(azure, cache, prompt.Chinese+"_slow", azure.PrepareSlowQuery(p.words(prompt.Chinese), speaker, "0ms"))
+	if err != nil {
+		return err
+	}
+	d, err := audio.Duration(answer)
+	if err != nil {
+		return err
+	}
+	gap := int(float64(d/time.Millisecond)*drillGapFactor) + drillMinGap
+
+	concatenator.AddCue(audio.CueStart, 300)
+	concatenator.AddWithText(english, 0, text)
+	concatenator.AddCue(audio.CueGap, 0)
+	concatenator.AddSilence(gap)
+	concatenator.AddWithText(answer, 1000, text)
+	concatenator.AddWithText(slow, 1500, text)
+	if p.RepeatEnglish {
+		concatenator.AddCue(audio.CueEnglish, 200)
+		concatenator.AddWithText(english, 1500, text)
+	}
+	return nil
+}
+
+func (p *DrillProcessor) fetchCached(azure *audio.AzureClient, cache *audio.Cache, text, query string) (string, error) {
+	if query == "" {
+		return "", fmt.Errorf("nothing to read in %q", text)
+	}
+	cachePath := cache.GetCachePath(text)
+	if cache.IsInCache(cachePath) {
+		return cachePath, nil
+	}
+	slog.Debug("not in cache, download with azure", "query", query)
+	return azure.Fetch(context.Background(), cleanQuery(query), filepath.Base(cachePath))
+}
+
+// words splits an answer into words for the slow reading: by its spaces if it is
+// segmented already, otherwise by the dictionary. Without a dictionary the answer is read
+// as one word.
+func (p *DrillProcessor) words(chinese string) []string {
+	if strings.Contains(strings.TrimSpace(chinese), " ") || p.Dict == nil {
+		return strings.Fields(chinese)
+	}
+	return p.Dict.Segment(chinese)
+}
+
+// drillItems returns the prompts of the items of an input: words are prompted by their
+// meaning followed by their examples, clozes by the sentence, sentences by their
+// translation and patterns by their examples.
+func (p *DrillProcessor) drillItems(kind, path string) ([]drillItem, error) {
+	var items []drillItem
+	switch kind {
+	case "words":
+		words, err := loadWordsFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			if p.Dict != nil {
+				fillFromDict(p.Dict, &w, w.Pinyin)
+			}
+			item := drillItem{name: w.Chinese}
+			item.prompts = append(item.prompts, Prompt{English: promptMeaning(w, p.Senses), Chinese: w.Chinese, Word: w.Chinese, Pinyin: w.Pinyin})
+			for _, e := range w.Examples {
+				item.prompts = append(item.prompts, Prompt{English: removeWrappingSingleQuotes(e.English), Chinese: e.Chinese, Word: w.Chinese, Pinyin: w.Pinyin})
+			}
+			items = append(items, item)
+		}
+	case "clozes":
+		clozes, err := loadClozesFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range clozes {
+			name := c.Filename
+			if name == "" {
+				name = c.SentenceBack
+			}
+			items = append(items, drillItem{name: name, prompts: []Prompt{
+				{English: c.English, Chinese: c.SentenceBack, Word: c.Word.Chinese, Pinyin: c.Word.Pinyin},
+			}})
+		}
+	case "sentences":
+		sentences, err := new(SentenceProcessor).loadSentences(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sentences {
+			translation, err := google.Translate(s)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, drillItem{name: s, prompts: []Prompt{{English: translation, Chinese: s}}})
+		}
+	case "patterns":
+		patterns, err := loadFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, pa := range patterns {
+			item := drillItem{name: pa.Pattern}
+			for _, e := range pa.Examples {
+				item.prompts = append(item.prompts, Prompt{English: removeWrappingSingleQuotes(e.English), Chinese: e.Chinese})
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %s, expected words, clozes, sentences or patterns", kind)
+	}
+	return items, nil
+}
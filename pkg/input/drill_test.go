@@ -0,0 +1,149 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+)
+
+func TestGetDrillAudioSkipsFailedItems(t *testing.T) {
+	// the fake azure echoes the queries, which are no mp3 and fail the rendering
+	var mu sync.Mutex
+	var queries []string
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		queries = append(queries, string(body))
+		mu.Unlock()
+		w.Write(body)
+	}))
+	defer azure.Close()
+	client, err := audio.NewAzureClient("key", azure.URL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := t.TempDir()
+	words := map[string]string{
+		"apple.json":  `{"chinese": "苹果", "cedict": [{"cedict_en": "apple/CL:個|个[ge4],顆|颗[ke1]"}]}`,
+		"person.json": `{"chinese": "人", "cedict": [{"cedict_en": "person"}]}`,
+	}
+	for name, word := range words {
+		if err := os.WriteFile(filepath.Join(in, name), []byte(word), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := &DrillProcessor{
+		AzureDownloader: client,
+		Cache:           &audio.Cache{AudioCacheDir: t.TempDir()},
+		OutDir:          t.TempDir(),
+	}
+	if err := p.GetDrillAudio("words", in); err != nil {
+		t.Fatalf("failed items abort the drill: %v", err)
+	}
+	rendered, _ := os.ReadDir(filepath.Join(p.OutDir, "drill"))
+	if len(rendered) != 0 {
+		t.Errorf("rendered %d drills of failed items", len(rendered))
+	}
+	var prompts int
+	for _, q := range queries {
+		if !strings.Contains(q, "en-US") {
+			continue
+		}
+		prompts++
+		if strings.Contains(q, "个") || strings.Contains(q, "measure word") {
+			t.Errorf("english prompt gives the measure word away: %s", q)
+		}
+	}
+	if prompts != 2 {
+		t.Errorf("%d english prompts synthesized, want one per item", prompts)
+	}
+}
+
+func TestGetDrillAudio(t *testing.T) {
+	for _, repeat := range []bool{false, true} {
+		t.Run(fmt.Sprintf("repeat english %v", repeat), func(t *testing.T) {
+			_, client := newFakeAzure(t)
+			in := t.TempDir()
+			words := map[string]string{
+				"person.json": `{"chinese": "人", "cedict": [{"cedict_en": "person"}]}`,
+				"tree.json":   `{"chinese": "苹果树", "cedict": [{"cedict_en": "apple tree"}]}`,
+			}
+			for name, word := range words {
+				if err := os.WriteFile(filepath.Join(in, name), []byte(word), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			manifest := audio.NewManifest("drill")
+			p := &DrillProcessor{
+				AzureDownloader: client,
+				Cache:           &audio.Cache{AudioCacheDir: t.TempDir()},
+				OutDir:          t.TempDir(),
+				Render:          audio.RenderOptions{Manifest: manifest},
+				RepeatEnglish:   repeat,
+			}
+			if err := p.GetDrillAudio("words", in); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range []struct{ chinese, english string }{{"人", "person"}, {"苹果树", "apple tree"}} {
+				// the silent gap and cues carry no text and are left out of the manifest
+				segments := output(t, manifest, tt.chinese+".mp3")
+				files := []string{audio.GetFilename(tt.english), tt.chinese + "_answer.mp3", tt.chinese + "_slow.mp3"}
+				if repeat {
+					files = append(files, audio.GetFilename(tt.english))
+				}
+				var got []string
+				for _, s := range segments {
+					got = append(got, filepath.Base(s.File))
+					if s.Chinese != tt.chinese || s.English != tt.english {
+						t.Errorf("segment %+v of %s", s, tt.chinese)
+					}
+				}
+				if !reflect.DeepEqual(got, files) {
+					t.Fatalf("clips %q, want %q", got, files)
+				}
+
+				// the fake reads 100ms per character, the gap lets the learner say the answer
+				prompt, answer, slow := segments[0], segments[1], segments[2]
+				d := answer.End - answer.Start
+				if want := time.Duration(len([]rune(tt.chinese))) * 100 * time.Millisecond; !near(d, want) {
+					t.Errorf("answer of %v, want %v", d, want)
+				}
+				gap := time.Duration(float64(d)*drillGapFactor) + drillMinGap*time.Millisecond
+				pauses := []struct {
+					name      string
+					got, want time.Duration
+				}{
+					{"gap", answer.Start - prompt.End, gap},
+					{"pause after the answer", slow.Start - answer.End, time.Second},
+				}
+				if repeat {
+					pauses = append(pauses, struct {
+						name      string
+						got, want time.Duration
+					}{"pause after the slow answer", segments[3].Start - slow.End, 1500 * time.Millisecond})
+				}
+				for _, pause := range pauses {
+					if !near(pause.got, pause.want) {
+						t.Errorf("%s of %s is %v, want %v", pause.name, tt.chinese, pause.got, pause.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// near compares durations of the timeline, which are rounded to samples.
+func near(got, want time.Duration) bool {
+	return got > want-time.Millisecond && got < want+time.Millisecond
+}
@@ -0,0 +1,287 @@
+package input
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
+	"golang.org/x/exp/slog"
+)
+
+// import formats of word lists
+const (
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+	FormatPleco = "pleco"
+	FormatList  = "list"
+)
+
+// WordImporter reads word lists into words. Missing cedict entries and tones are filled
+// from the dictionary if one is set.
+type WordImporter struct {
+	Format string // csv, tsv, pleco or list, detected from the file extension if empty
+	// Columns maps chinese, pinyin, english and note to columns of csv and tsv files, by
+	// 1-based index or by header name. A header line is expected if any column is named.
+	Columns map[string]string
+	Header  bool // skip the first line of csv and tsv files
+	Dict    *dict.Dict
+}
+
+// DefaultColumns of csv and tsv files.
+var DefaultColumns = map[string]string{"chinese": "1", "pinyin": "2", "english": "3"}
+
+// ParseColumns parses a column mapping like "chinese=2,english=Meaning".
+func ParseColumns(mapping string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for _, pair := range strings.Split(mapping, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, column, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("invalid column mapping %q, expected key=column", pair)
+		}
+		switch key {
+		case "chinese", "pinyin", "english", "note":
+			columns[key] = strings.TrimSpace(column)
+		default:
+			return nil, fmt.Errorf("unknown key %q in column mapping, expected chinese, pinyin, english or note", key)
+		}
+	}
+	if _, ok := columns["chinese"]; !ok {
+		return nil, fmt.Errorf("column mapping needs the chinese column")
+	}
+	return columns, nil
+}
+
+// importedWord is a word with the pinyin of the list, which is only used for the tones.
+type importedWord struct {
+	Word
+	pinyin string
+}
+
+func (i *WordImporter) Import(path string) ([]Word, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := i.Format
+	if format == "" {
+		format = formatOf(path)
+	}
+	var imported []importedWord
+	switch format {
+	case FormatCSV:
+		imported, err = i.readTable(f, ',')
+	case FormatTSV:
+		imported, err = i.readTable(f, '\t')
+	case FormatPleco:
+		imported, err = readPleco(f)
+	case FormatList:
+		imported, err = readList(f)
+	default:
+		return nil, fmt.Errorf("unknown format %s, expected csv, tsv, pleco or list", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+
+	var words []Word
+	for _, w := range imported {
+		fillFromDict(i.Dict, &w.Word, w.pinyin)
+		// the english of the list stands in for the dictionary translations
+		if len(w.HSK) == 0 && len(w.Cedict) == 0 && w.English != "" {
+			w.HSK = []HSKEntry{{HSKEnglish: w.English}}
+		}
+		if len(w.HSK) == 0 && len(w.Cedict) == 0 {
+			slog.Warn("word has no translation", "word", w.Chinese)
+		}
+		words = append(words, w.Word)
+	}
+	return words, nil
+}
+
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".tsv":
+		return FormatTSV
+	}
+	return FormatList
+}
+
+func (i *WordImporter) readTable(r io.Reader, sep rune) ([]importedWord, error) {
+	reader := csv.NewReader(trimBOM(r))
+	reader.Comma = sep
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	columns := i.Columns
+	if columns == nil {
+		columns = DefaultColumns
+	}
+
+	header := i.Header
+	for _, c := range columns {
+		if _, err := strconv.Atoi(c); err != nil {
+			header = true
+		}
+	}
+	index := make(map[string]int)
+	for key, c := range columns {
+		if n, err := strconv.Atoi(c); err == nil {
+			index[key] = n - 1
+			continue
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		found := false
+		for j, name := range rows[0] {
+			if strings.EqualFold(strings.TrimSpace(name), c) {
+				index[key], found = j, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no column %s in header %v", c, rows[0])
+		}
+	}
+	if header && len(rows) > 0 {
+		rows = rows[1:]
+	}
+
+	var words []importedWord
+	for _, row := range rows {
+		value := func(key string) string {
+			j, ok := index[key]
+			if !ok || j < 0 || j >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[j])
+		}
+		w := importedWord{
+			Word:   Word{Chinese: value("chinese"), English: value("english"), Note: value("note")},
+			pinyin: value("pinyin"),
+		}
+		if w.Chinese != "" {
+			words = append(words, w)
+		}
+	}
+	return words, nil
+}
+
+// trimBOM skips the byte order mark spreadsheet apps write at the start of csv files,
+// which would otherwise be part of the first header name.
+func trimBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+	return br
+}
+
+// pleco formatting, e.g. bold and colored text, is exported as private use characters
+var plecoPrivateRe = regexp.MustCompile(`[\x{E000}-\x{F8FF}]`)
+
+// readPleco reads a flashcard export of pleco: a card per line with headword, pinyin and
+// definition separated by tabs. The headword may carry the traditional form in brackets,
+// lines starting with // name categories.
+func readPleco(r io.Reader) ([]importedWord, error) {
+	var words []importedWord
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		headword, _, _ := strings.Cut(parts[0], "[")
+		w := importedWord{Word: Word{Chinese: strings.TrimSpace(headword)}}
+		if len(parts) > 1 {
+			w.pinyin = strings.TrimSpace(parts[1])
+		}
+		if len(parts) > 2 {
+			w.English = strings.Join(strings.Fields(plecoPrivateRe.ReplaceAllString(parts[2], " ")), " ")
+		}
+		if w.Chinese != "" {
+			words = append(words, w)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// numbering of list lines, e.g. 1. or 2、
+var listNumberRe = regexp.MustCompile(`^\d+[.)、:：]\s*`)
+
+// readList reads a word per line, lines starting with # are comments. The first field
+// with chinese characters is taken, other fields like the numbers of a numbered list are
+// ignored.
+func readList(r io.Reader) ([]importedWord, error) {
+	var words []importedWord
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = listNumberRe.ReplaceAllString(line, "")
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || r == ',' || r == '，' || r == '、'
+		}) {
+			if dict.HanCount(field) > 0 {
+				words = append(words, importedWord{Word: Word{Chinese: field}})
+				break
+			}
+		}
+	}
+	return words, scanner.Err()
+}
+
+// WriteWords writes a json file per word, the input of the words mode. Words are named
+// like their clips, a word listed twice is written once.
+func WriteWords(dir string, words []Word) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, w := range words {
+		name := wordFilename(w.Chinese)
+		if seen[name] {
+			slog.Warn("skipping duplicate word", "word", w.Chinese)
+			continue
+		}
+		seen[name] = true
+		data, err := json.MarshalIndent(w, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wordFilename names the json file of a word after the file name of its clip, without
+// the path separators a list entry like 的/地 contains.
+func wordFilename(chinese string) string {
+	name := strings.TrimSuffix(audio.GetFilename(chinese), ".mp3")
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(name) + ".json"
+}
@@ -0,0 +1,220 @@
+package input
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func imported(chinese, pinyin, english string) importedWord {
+	return importedWord{Word: Word{Chinese: chinese, English: english}, pinyin: pinyin}
+}
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		mapping string
+		want    map[string]string
+		err     bool
+	}{
+		{mapping: "chinese=1", want: map[string]string{"chinese": "1"}},
+		{mapping: " chinese = 2 , english=Meaning,note=Notes,", want: map[string]string{"chinese": "2", "english": "Meaning", "note": "Notes"}},
+		{mapping: "pinyin=2", err: true},
+		{mapping: "chinese", err: true},
+		{mapping: "chinese=", err: true},
+		{mapping: "chinese=1,tones=2", err: true},
+		{mapping: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			got, err := ParseColumns(tt.mapping)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		sep     rune
+		columns map[string]string
+		header  bool
+		want    []importedWord
+		err     bool
+	}{
+		{
+			name: "default columns",
+			data: "你好,nǐ hǎo,hello\n再见,zàijiàn,goodbye\n,,empty\n",
+			sep:  ',',
+			want: []importedWord{imported("你好", "nǐ hǎo", "hello"), imported("再见", "zàijiàn", "goodbye")},
+		},
+		{
+			name:   "skipped header",
+			data:   "Hanzi\tPinyin\tMeaning\n你好\tnǐ hǎo\thello\n",
+			sep:    '\t',
+			header: true,
+			want:   []importedWord{imported("你好", "nǐ hǎo", "hello")},
+		},
+		{
+			name:    "index columns",
+			data:    "1,hello,你好\n2,short\n",
+			sep:     ',',
+			columns: map[string]string{"chinese": "3", "english": "2"},
+			want:    []importedWord{imported("你好", "", "hello")},
+		},
+		{
+			name:    "header names",
+			data:    "Meaning,Pinyin, Hanzi ,Notes\nhello,\"nǐ hǎo\",你好,\"greeting, informal\"\n",
+			sep:     ',',
+			columns: map[string]string{"chinese": "hanzi", "pinyin": "Pinyin", "english": "meaning", "note": "Notes"},
+			want:    []importedWord{{Word: Word{Chinese: "你好", English: "hello", Note: "greeting, informal"}, pinyin: "nǐ hǎo"}},
+		},
+		{
+			name:    "header with byte order mark",
+			data:    "\ufeffHanzi,Meaning\n你好,hello\n",
+			sep:     ',',
+			columns: map[string]string{"chinese": "Hanzi", "english": "Meaning"},
+			want:    []importedWord{imported("你好", "", "hello")},
+		},
+		{
+			name:    "quoted header with byte order mark",
+			data:    "\ufeff\"Hanzi\";\"Meaning\"\n你好;hello\n",
+			sep:     ';',
+			columns: map[string]string{"chinese": "Hanzi", "english": "Meaning"},
+			want:    []importedWord{imported("你好", "", "hello")},
+		},
+		{
+			name:    "missing header name",
+			data:    "Hanzi,Meaning\n你好,hello\n",
+			sep:     ',',
+			columns: map[string]string{"chinese": "Characters"},
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &WordImporter{Columns: tt.columns, Header: tt.header}
+			got, err := i.readTable(strings.NewReader(tt.data), tt.sep)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("words\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPleco(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []importedWord
+	}{
+		{
+			name: "simplified and traditional headword",
+			data: "\ufeff// HSK 1\n学习[學習]\txue2xi2\tverb study; learn\n\n// HSK 2\n书[書]\tshu1\tnoun book\n",
+			want: []importedWord{imported("学习", "xue2xi2", "verb study; learn"), imported("书", "shu1", "noun book")},
+		},
+		{
+			name: "private use formatting",
+			data: "好\thao3\t\ue010adj\ue011 good \ue012\ue013 well\n",
+			want: []importedWord{imported("好", "hao3", "adj good well")},
+		},
+		{
+			name: "headword only",
+			data: "你好\n[再見]\tzai4jian4\n",
+			want: []importedWord{imported("你好", "", "")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readPleco(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("words\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadList(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "a word per line", data: "\ufeff你好\n 再见 \n\n", want: []string{"你好", "再见"}},
+		{name: "comments", data: "# hsk 1\n你好\n  # 再见\n", want: []string{"你好"}},
+		{name: "numbered", data: "1. 你好\n2.再见\n3、谢谢\n4) 不客气\n5 对不起\n", want: []string{"你好", "再见", "谢谢", "不客气", "对不起"}},
+		{name: "numbers in words", data: "3月\n10 一月\n", want: []string{"3月", "一月"}},
+		{name: "first chinese field", data: "hello, 你好, nǐ hǎo\ngoodbye 再见 再会\nno chinese\n", want: []string{"你好", "再见"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words, err := readList(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, w := range words {
+				got = append(got, w.Chinese)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("words %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteWords(t *testing.T) {
+	dir := t.TempDir()
+	words := []Word{
+		{Chinese: "的/地", English: "particle"},
+		{Chinese: "你好", English: "hello"},
+		{Chinese: "你 好", English: "hi"},
+		{Chinese: "再见", English: "goodbye"},
+	}
+	if err := WriteWords(dir, words); err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	if want := []string{"你好.json", "再见.json", "的_地.json"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("files %q, want %q", names, want)
+	}
+	// the first of the duplicates is kept
+	data, err := os.ReadFile(filepath.Join(dir, "你好.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w Word
+	if err := json.Unmarshal(data, &w); err != nil {
+		t.Fatal(err)
+	}
+	if w.English != "hello" {
+		t.Errorf("kept %+v", w)
+	}
+	loaded, err := loadWordsFromDir(dir)
+	if err != nil || len(loaded) != 3 {
+		t.Errorf("loaded %+v: %v", loaded, err)
+	}
+}
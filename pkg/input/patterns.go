@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/grammar"
 	"golang.org/x/exp/slog"
 )
 
@@ -24,6 +25,16 @@ type Grammar struct {
 	Summary         []string  `json:"summary"`
 }
 
+// narration phrases shared by all patterns
+const (
+	narrationExamples = "Here are a few examples"
+	narrationSummary  = "The most important points when using the pattern are:"
+)
+
+// Narration lists the texts of the clips shared by all items, they should never be evicted
+// from the cache. They are keyed like all clips, see Cache.GetCachePath.
+var Narration = []string{narrationExamples, narrationSummary}
+
 type PatternProcessor struct {
 	azureDownloader *audio.AzureClient
 	concatenator    *audio.Concatenator
@@ -44,25 +55,35 @@ func NewPatternProcessor(downloader *audio.AzureClient, concatenator *audio.Conc
 	}, nil
 }
 
-func (p *PatternProcessor) replaceTextWithAudio(text, pause string) string {
-	// Define a regex pattern to match sequences of Chinese characters
-	chineseRe := regexp.MustCompile(`[\p{Han}]+`)
-	// Update the regex pattern to match English phrases with surrounding punctuation included
-	englishRe := regexp.MustCompile(`[A-Za-z]+(?:'[A-Za-z]+)?(?:[\s]*[,!?;:.]*[\s]*[A-Za-z]+(?:'[A-Za-z]+)?)*[,.!?;:]*`)
-
-	// Replace English text with audio
-	text = englishRe.ReplaceAllStringFunc(text, func(englishText string) string {
-		audio := p.azureDownloader.PrepareEnglishQuery(englishText, pause)
-		return audio
-	})
-
-	// Replace Chinese text with audio
-	text = chineseRe.ReplaceAllStringFunc(text, func(chineseText string) string {
-		audio := p.azureDownloader.PrepareQueryWithRandomVoice(chineseText, pause, false)
-		return audio
-	})
-
-	return text
+// structureQuery reads the structure of a pattern, the placeholders in english and the
+// chinese literals by a chinese voice. It returns the query and the text of the transcript,
+// the canonical structure and its reading. Structures that do not parse are read as they
+// are.
+func (p *PatternProcessor) structureQuery(pa Grammar, pause string) (string, audio.SegmentText) {
+	if strings.TrimSpace(pa.Structure) == "" {
+		return "", audio.SegmentText{}
+	}
+	structure, err := grammar.Parse(pa.Structure)
+	if err != nil {
+		slog.Warn("read structure as is", "pattern", pa.Pattern, "error", err)
+		text := removeAllQuotes(removeBracketsInclText(replaceSpecialChars(pa.Structure)))
+		return p.azureDownloader.PrepareMixedQuery(text, pause), audio.SegmentText{English: text}
+	}
+	speaker := p.azureDownloader.GetRandomVoice()
+	phrases := structure.Verbalize()
+	query := ""
+	for i, phrase := range phrases {
+		gap := "0ms"
+		if i == len(phrases)-1 {
+			gap = pause
+		}
+		if phrase.Chinese {
+			query += p.azureDownloader.PrepareQuery(phrase.Text, speaker, gap, false)
+			continue
+		}
+		query += p.azureDownloader.PrepareEnglishQuery(phrase.Text, gap)
+	}
+	return query, audio.SegmentText{Chinese: structure.String(), English: structure.Reading()}
 }
 
 func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
@@ -72,8 +93,9 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 	}
 
 	for _, pa := range patterns {
+		p.concatenator.AddCue(audio.CueStart, 300)
 		cachePath := p.cache.GetCachePath(pa.Pattern)
-		tmpFile := audio.GetFilename(pa.Pattern)
+		tmpFile := filepath.Base(cachePath)
 		if !p.cache.IsInCache(cachePath) {
 			query := cleanQuery(p.azureDownloader.PrepareQueryWithRandomVoice(pa.Pattern, "0ms", true))
 			slog.Debug("pattern not in cache, download with azure", "query", query)
@@ -81,46 +103,48 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 			if err != nil {
 				return err
 			}
-			p.concatenator.AddWithPause(tmpPath, 1500)
-			p.concatenator.AddWithPause(tmpPath, 1500)
+			p.concatenator.AddWithText(tmpPath, 1500, audio.SegmentText{Chinese: pa.Pattern})
+			p.concatenator.AddWithText(tmpPath, 1500, audio.SegmentText{Chinese: pa.Pattern})
 		} else {
-			p.concatenator.AddWithPause(cachePath, 1500)
-			p.concatenator.AddWithPause(cachePath, 1500)
+			p.concatenator.AddWithText(cachePath, 1500, audio.SegmentText{Chinese: pa.Pattern})
+			p.concatenator.AddWithText(cachePath, 1500, audio.SegmentText{Chinese: pa.Pattern})
 		}
 
 		note := removeDots(removeBracketsInclText(pa.Note))
 		cachePath = p.cache.GetCachePath(note)
-		tmpFile = audio.GetFilename(note)
+		tmpFile = filepath.Base(cachePath)
 		if !p.cache.IsInCache(cachePath) {
-			query := cleanQuery(p.replaceTextWithAudio(note, "0ms"))
+			query := cleanQuery(p.azureDownloader.PrepareMixedQuery(note, "0ms"))
 			slog.Debug("note not in cache, download with azure", "query", query)
 			tmpPath, err := p.azureDownloader.Fetch(context.Background(), query, tmpFile)
 			if err != nil {
 				return err
 			}
-			p.concatenator.AddWithPause(tmpPath, 200)
+			p.concatenator.AddWithText(tmpPath, 200, audio.SegmentText{English: note})
 		} else {
-			p.concatenator.AddWithPause(cachePath, 200)
+			p.concatenator.AddWithText(cachePath, 200, audio.SegmentText{English: note})
 		}
 
-		structure := removeAllQuotes(removeBracketsInclText(replaceSpecialChars(pa.Structure)))
-		cachePath = p.cache.GetCachePath(structure)
-		tmpFile = audio.GetFilename(structure)
-		if !p.cache.IsInCache(cachePath) {
-			query := cleanQuery(p.replaceTextWithAudio(structure, "0ms"))
-			slog.Debug("structure not in cache, download with azure", "query", query)
-			tmpPath, err := p.azureDownloader.Fetch(context.Background(), query, tmpFile)
-			if err != nil {
-				return err
+		if structure, text := p.structureQuery(pa, "0ms"); structure != "" {
+			cachePath = p.cache.GetCachePath(text.English)
+			tmpFile = filepath.Base(cachePath)
+			if !p.cache.IsInCache(cachePath) {
+				query := cleanQuery(structure)
+				slog.Debug("structure not in cache, download with azure", "query", query)
+				tmpPath, err := p.azureDownloader.Fetch(context.Background(), query, tmpFile)
+				if err != nil {
+					return err
+				}
+				p.concatenator.AddWithText(tmpPath, 500, text)
+			} else {
+				p.concatenator.AddWithText(cachePath, 500, text)
 			}
-			p.concatenator.AddWithPause(tmpPath, 500)
-		} else {
-			p.concatenator.AddWithPause(cachePath, 500)
 		}
 
-		eng := "Here are a few examples"
+		eng := narrationExamples
+		p.concatenator.AddCue(audio.CueEnglish, 200)
 		cachePath = p.cache.GetCachePath(eng)
-		tmpFile = audio.GetFilename(eng)
+		tmpFile = filepath.Base(cachePath)
 		if !p.cache.IsInCache(cachePath) {
 			query := p.azureDownloader.PrepareEnglishQuery(eng, "0ms")
 			slog.Debug("english not in cache, download with azure", "query", query)
@@ -128,14 +152,15 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 			if err != nil {
 				return err
 			}
-			p.concatenator.AddWithPause(tmpPath, 1000)
+			p.concatenator.AddWithText(tmpPath, 1000, audio.SegmentText{English: eng})
 		} else {
-			p.concatenator.AddWithPause(cachePath, 1000)
+			p.concatenator.AddWithText(cachePath, 1000, audio.SegmentText{English: eng})
 		}
 
 		for _, e := range pa.Examples {
+			text := audio.SegmentText{Chinese: e.Chinese, English: removeWrappingSingleQuotes(e.English)}
 			cachePath := p.cache.GetCachePath(e.Chinese)
-			tmpFile := audio.GetFilename(e.Chinese)
+			tmpFile := filepath.Base(cachePath)
 			if !p.cache.IsInCache(cachePath) {
 				query := cleanQuery(p.azureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "0ms", true))
 				slog.Debug("example not in cache, download with azure", "query", query)
@@ -143,16 +168,17 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 				if err != nil {
 					return err
 				}
-				p.concatenator.AddWithPause(tmpPath, 2000)
-				p.concatenator.AddWithPause(tmpPath, 2000)
+				p.concatenator.AddWithText(tmpPath, 2000, text)
+				p.concatenator.AddWithText(tmpPath, 2000, text)
 			} else {
-				p.concatenator.AddWithPause(cachePath, 2000)
-				p.concatenator.AddWithPause(cachePath, 2000)
+				p.concatenator.AddWithText(cachePath, 2000, text)
+				p.concatenator.AddWithText(cachePath, 2000, text)
 			}
 
 			eng := removeWrappingSingleQuotes(e.English)
+			p.concatenator.AddCue(audio.CueEnglish, 200)
 			cachePath = p.cache.GetCachePath(eng)
-			tmpFile = audio.GetFilename(eng)
+			tmpFile = filepath.Base(cachePath)
 			if !p.cache.IsInCache(cachePath) {
 				query := p.azureDownloader.PrepareEnglishQuery(eng, "0ms")
 				slog.Debug("english not in cache, download with azure", "query", query)
@@ -160,13 +186,13 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 				if err != nil {
 					return err
 				}
-				p.concatenator.AddWithPause(tmpPath, 2000)
+				p.concatenator.AddWithText(tmpPath, 2000, text)
 			} else {
-				p.concatenator.AddWithPause(cachePath, 2000)
+				p.concatenator.AddWithText(cachePath, 2000, text)
 			}
 
 			cachePath = p.cache.GetCachePath(e.Chinese)
-			tmpFile = audio.GetFilename(e.Chinese)
+			tmpFile = filepath.Base(cachePath)
 			if !p.cache.IsInCache(cachePath) {
 				query := cleanQuery(p.azureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "0ms", true))
 				slog.Debug("example not in cache, download with azure", "query", query)
@@ -174,15 +200,16 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 				if err != nil {
 					return err
 				}
-				p.concatenator.AddWithPause(tmpPath, 2000)
+				p.concatenator.AddWithText(tmpPath, 2000, text)
 			} else {
-				p.concatenator.AddWithPause(cachePath, 2000)
+				p.concatenator.AddWithText(cachePath, 2000, text)
 			}
 		}
 
-		eng = "The most important points when using the pattern are:"
+		eng = narrationSummary
+		p.concatenator.AddCue(audio.CueEnglish, 200)
 		cachePath = p.cache.GetCachePath(eng)
-		tmpFile = audio.GetFilename(eng)
+		tmpFile = filepath.Base(cachePath)
 		if !p.cache.IsInCache(cachePath) {
 			query := p.azureDownloader.PrepareEnglishQuery(eng, "0ms")
 			slog.Debug("english not in cache, download with azure", "query", query)
@@ -190,14 +217,14 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 			if err != nil {
 				return err
 			}
-			p.concatenator.AddWithPause(tmpPath, 2000)
+			p.concatenator.AddWithText(tmpPath, 2000, audio.SegmentText{English: eng})
 		} else {
-			p.concatenator.AddWithPause(cachePath, 2000)
+			p.concatenator.AddWithText(cachePath, 2000, audio.SegmentText{English: eng})
 		}
 
 		eng = strings.Join(pa.Summary, "\n")
 		cachePath = p.cache.GetCachePath(eng)
-		tmpFile = audio.GetFilename(eng)
+		tmpFile = filepath.Base(cachePath)
 		if !p.cache.IsInCache(cachePath) {
 			query := p.azureDownloader.PrepareEnglishQuery(eng, "0ms")
 			slog.Debug("english not in cache, download with azure", "query", query)
@@ -205,20 +232,15 @@ func (p *PatternProcessor) ConcatAudioFromCache(path string) error {
 			if err != nil {
 				return err
 			}
-			p.concatenator.AddWithPause(tmpPath, 1500)
-		} else {
-			p.concatenator.AddWithPause(cachePath, 1500)
-		}
-
-		// add beep
-		cachePath = p.cache.GetCachePath("peep")
-		if !p.cache.IsInCache(cachePath) {
-			slog.Error("missing peep file in cache", "path", cachePath)
+			p.concatenator.AddWithText(tmpPath, 1500, audio.SegmentText{English: eng})
 		} else {
-			p.concatenator.AddWithPause(cachePath, 1500)
+			p.concatenator.AddWithText(cachePath, 1500, audio.SegmentText{English: eng})
 		}
 
-		if err := p.concatenator.Merge(filepath.Join(p.outDir, audio.GetFilename(pa.Pattern))); err != nil {
+		// the end-of-item beep is added by the concatenator, see audio.RenderOptions
+		err := p.concatenator.Merge(filepath.Join(p.outDir, audio.GetFilename(pa.Pattern)))
+		p.concatenator.Reset()
+		if err != nil {
 			slog.Error("concat files", "pattern", pa.Pattern, "error", err)
 			continue
 		}
@@ -236,8 +258,9 @@ func (p *PatternProcessor) GetAzureAudio(path string) error {
 		note := removeDots(removeBracketsInclText(pa.Note))
 		query := p.azureDownloader.PrepareQueryWithRandomVoice(pa.Pattern, "1500ms", true)
 		query += p.azureDownloader.PrepareQueryWithRandomVoice(pa.Pattern, "1500ms", true)
-		query += p.replaceTextWithAudio(note, "200ms")
-		query += p.replaceTextWithAudio(removeAllQuotes(removeBracketsInclText(replaceSpecialChars(pa.Structure))), "500ms")
+		query += p.azureDownloader.PrepareMixedQuery(note, "200ms")
+		structure, _ := p.structureQuery(pa, "500ms")
+		query += structure
 		query += p.azureDownloader.PrepareEnglishQuery("Here are a few examples", "1000ms")
 		for _, e := range pa.Examples {
 			query += p.azureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
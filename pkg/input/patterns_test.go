@@ -0,0 +1,36 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+)
+
+func TestNarrationPinsSynthesizedClips(t *testing.T) {
+	_, client := newFakeAzure(t)
+	in := t.TempDir()
+	pattern := `{"pattern": "越来越", "note": "more and more", "structure": "越来越 + Adj.",
+		"examples": [{"chinese": "天气越来越冷。", "english": "It is getting colder."}],
+		"summary": ["used with adjectives"]}`
+	if err := os.WriteFile(filepath.Join(in, "pattern.json"), []byte(pattern), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache := &audio.Cache{AudioCacheDir: t.TempDir()}
+	p, err := NewPatternProcessor(client, audio.NewConcatenator(), cache, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ConcatAudioFromCache(in); err != nil {
+		t.Fatal(err)
+	}
+	// the clips of the run are exported into the cache under their names, the pins of the
+	// narration have to name them
+	for _, text := range Narration {
+		name := filepath.Base(cache.GetCachePath(text))
+		if _, err := os.Stat(filepath.Join(client.AudioDir, name)); err != nil {
+			t.Errorf("pin %q names no clip of the run: %v", text, err)
+		}
+	}
+}
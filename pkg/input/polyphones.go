@@ -0,0 +1,161 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fbngrm/zh-audio/pkg/dict"
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
+)
+
+// Polyphone is a polyphonic character of an input item that is read without an override.
+type Polyphone struct {
+	Item     string   // the item, e.g. the word or sentence
+	Word     string   // the word containing the character
+	Char     string   // the polyphonic character
+	Readings []string // readings of the character in the dictionary
+}
+
+func (p Polyphone) String() string {
+	s := fmt.Sprintf("%s: %s in %s", p.Item, p.Char, p.Word)
+	if len(p.Readings) > 0 {
+		s += " (" + strings.Join(p.Readings, ", ") + ")"
+	}
+	return s
+}
+
+// itemText is a text of an input item with the pinyin overrides of the item.
+type itemText struct {
+	item      string
+	text      string
+	overrides map[string]string
+}
+
+// CheckPolyphones lists the polyphonic characters of the items of an input that are not
+// covered by the lexicon or the pinyin of the item. With a dictionary, characters of
+// words that have a single reading are not listed, azure reads those right.
+func CheckPolyphones(kind, path string, lexicon *textnorm.Lexicon, d *dict.Dict) ([]Polyphone, error) {
+	texts, err := inputTexts(kind, path)
+	if err != nil {
+		return nil, err
+	}
+	var polyphones []Polyphone
+	for _, t := range texts {
+		runes := []rune(t.text)
+		for i := 0; i < len(runes); {
+			if n := matchOverride(runes[i:], t.overrides); n > 0 {
+				i += n
+				continue
+			}
+			if n := lexicon.Match(runes[i:]); n > 0 {
+				i += n
+				continue
+			}
+			// the word at i, a single character if it is not in the dictionary
+			word := string(runes[i])
+			if d != nil {
+				if w := d.Segment(string(runes[i:]))[0]; len(d.Lookup(w)) > 0 {
+					word = w
+				}
+			}
+			i += len([]rune(word))
+			if d != nil && len([]rune(word)) > 1 && len(d.Readings(word)) == 1 {
+				continue
+			}
+			for _, r := range word {
+				if !textnorm.IsPolyphone(r) {
+					continue
+				}
+				p := Polyphone{Item: t.item, Word: word, Char: string(r)}
+				if d != nil {
+					for _, reading := range d.Readings(string(r)) {
+						p.Readings = append(p.Readings, dict.Marked(reading))
+					}
+				}
+				polyphones = append(polyphones, p)
+			}
+		}
+	}
+	return polyphones, nil
+}
+
+func matchOverride(runes []rune, overrides map[string]string) int {
+	for word := range overrides {
+		if strings.HasPrefix(string(runes), word) {
+			return len([]rune(word))
+		}
+	}
+	return 0
+}
+
+// inputTexts returns the chinese texts of the items of an input of the words, clozes,
+// patterns, sentences or dialog mode.
+func inputTexts(kind, path string) ([]itemText, error) {
+	var texts []itemText
+	add := func(item string, overrides map[string]string, chinese ...string) {
+		for _, c := range chinese {
+			if c != "" {
+				texts = append(texts, itemText{item: item, text: c, overrides: overrides})
+			}
+		}
+	}
+	word := func(w Word) map[string]string {
+		if w.Pinyin == "" {
+			return nil
+		}
+		return map[string]string{w.Chinese: w.Pinyin}
+	}
+	switch kind {
+	case "words":
+		words, err := loadWordsFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			add(w.Chinese, word(w), w.Chinese)
+			for _, e := range w.Examples {
+				add(w.Chinese, word(w), e.Chinese)
+			}
+		}
+	case "clozes":
+		clozes, err := loadClozesFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range clozes {
+			add(c.SentenceBack, word(c.Word), c.SentenceBack, c.Word.Chinese)
+		}
+	case "patterns":
+		patterns, err := loadFromDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range patterns {
+			add(p.Pattern, nil, p.Pattern, p.SentenceBack)
+			for _, e := range p.Examples {
+				add(p.Pattern, nil, e.Chinese)
+			}
+		}
+	case "sentences":
+		sentences, err := new(SentenceProcessor).loadSentences(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sentences {
+			add(s, nil, s)
+		}
+	case "dialog":
+		dialogs, err := new(DialogProcessor).loadDialogues(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dialogs {
+			for _, l := range d.Lines {
+				add(l.Text, nil, l.Text)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %s, expected words, clozes, patterns, sentences or dialog", kind)
+	}
+	return texts, nil
+}
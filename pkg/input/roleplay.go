@@ -0,0 +1,86 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/google"
+	"golang.org/x/exp/slog"
+)
+
+// the learner gets the length of the original line times this factor to speak,
+// plus a fixed amount of time to recall the line.
+const (
+	rolePlayGapFactor = 1.5
+	rolePlayMinGap    = 1000 // ms
+)
+
+// GetRolePlayAudio renders a dialog for speaking practice. Lines of the speaker played by
+// the learner are replaced by a silent gap, optionally preceded by an English cue, followed
+// by the original line as confirmation. If role is empty, one file per speaker is rendered.
+func (p *DialogProcessor) GetRolePlayAudio(path, role string, withCue bool) error {
+	dialogs, err := p.loadDialogues(path)
+	if err != nil {
+		return err
+	}
+	outDir := filepath.Join(p.OutDir, "roleplay")
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, dialog := range dialogs {
+		if len(dialog.Lines) == 0 {
+			continue
+		}
+		roles := []string{role}
+		if role == "" {
+			roles = sortedSpeakers(dialog.Speakers)
+		} else if _, ok := dialog.Speakers[role]; !ok {
+			slog.Warn("speaker not part of dialog, skip", "role", role, "dialog", dialog.Text)
+			continue
+		}
+
+		lines, err := p.fetchLines(dialog)
+		if err != nil {
+			return err
+		}
+
+		dialogText := strings.ReplaceAll(dialog.Text, "。", "")
+		for _, r := range roles {
+			concatenator := audio.NewConcatenatorWithOptions(p.Render)
+			for i, line := range dialog.Lines {
+				if line.Speaker != r {
+					concatenator.AddWithText(lines[i], 500, audio.SegmentText{Chinese: line.Text})
+					continue
+				}
+				d, err := audio.Duration(lines[i])
+				if err != nil {
+					return err
+				}
+				gap := int(float64(d/time.Millisecond)*rolePlayGapFactor) + rolePlayMinGap
+				if withCue {
+					translation, err := google.Translate(line.Text)
+					if err != nil {
+						return err
+					}
+					cue, err := p.fetchCached(translation, "", p.AzureDownloader.PrepareEnglishQuery(translation, "0ms"))
+					if err != nil {
+						return err
+					}
+					concatenator.AddWithText(cue, 300, audio.SegmentText{English: translation})
+				}
+				concatenator.AddCue(audio.CueGap, 0)
+				concatenator.AddSilence(gap)
+				concatenator.AddWithText(lines[i], 1000, audio.SegmentText{Chinese: line.Text})
+			}
+			outPath := audio.OutputPath(filepath.Join(outDir, r+"_"+audio.GetFilename(dialogText)))
+			if err := concatenator.Merge(outPath); err != nil {
+				return err
+			}
+			slog.Info("role-play audio generated", "role", r, "path", outPath)
+		}
+	}
+	return nil
+}
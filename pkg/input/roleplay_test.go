@@ -0,0 +1,62 @@
+package input
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+)
+
+func TestGetRolePlayAudio(t *testing.T) {
+	p, _ := newTestDialogProcessor(t)
+	path := writeDialog(t, "A:你好", "B:你好", "A:再见")
+	if err := p.GetRolePlayAudio(path, "", false); err != nil {
+		t.Fatal(err)
+	}
+	dialogs, err := p.loadDialogues(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voices := p.AzureDownloader.GetVoices(dialogs[0].Speakers)
+	ext := filepath.Ext(audio.OutputPath("x.mp3"))
+
+	tests := []struct {
+		role string
+		// speaker of each line read in the output, the lines of the role follow a gap
+		speakers []string
+		gaps     []bool
+	}{
+		{"A", []string{"A", "B", "A"}, []bool{true, false, true}},
+		{"B", []string{"A", "B", "A"}, []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		segments := output(t, p.Render.Manifest, tt.role+"_你好你好再见"+ext)
+		if len(segments) != len(tt.speakers) {
+			t.Fatalf("%s: %d segments, want %d", tt.role, len(segments), len(tt.speakers))
+		}
+		var end time.Duration
+		for i, s := range segments {
+			// every line is read by the voice of its speaker, the role of the learner too
+			if voice := voices[tt.speakers[i]]; !strings.HasSuffix(s.File, "_"+voice+".mp3") {
+				t.Errorf("%s: line %d read from %s, want the voice %s", tt.role, i, s.File, voice)
+			}
+			pause := 500 * time.Millisecond
+			if i == 0 {
+				pause = 0
+			} else if tt.gaps[i-1] {
+				pause = time.Second
+			}
+			if tt.gaps[i] {
+				// the gap lasts the line times 1.5 plus a second, the muted line is not read
+				d := s.End - s.Start
+				pause += time.Duration(int(float64(d/time.Millisecond)*rolePlayGapFactor)+rolePlayMinGap) * time.Millisecond
+			}
+			if got := s.Start - end; got < pause-time.Millisecond || got > pause+time.Millisecond {
+				t.Errorf("%s: line %d starts %v after the one before, want %v", tt.role, i, got, pause)
+			}
+			end = s.End
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/fbngrm/zh-audio/pkg/audio"
 	"github.com/fbngrm/zh-audio/pkg/google"
+	"github.com/fbngrm/zh-audio/pkg/textnorm"
+	"golang.org/x/exp/slog"
 )
 
 type SentenceProcessor struct {
@@ -51,8 +53,10 @@ func (s *SentenceProcessor) ConcatAudioFromCache(path string) error {
 			return err
 		}
 
+		text := audio.SegmentText{Chinese: sentence, English: translation}
+		s.concatenator.AddCue(audio.CueStart, 300)
 		cachePath := s.cache.GetCachePath(sentence)
-		tmpFile := audio.GetFilename(sentence)
+		tmpFile := filepath.Base(cachePath)
 		if !s.cache.IsInCache(cachePath) {
 			query := s.azureDownloader.PrepareQueryWithRandomVoice(sentence, "0ms", true)
 			tmpPath, err := s.azureDownloader.Fetch(
@@ -62,27 +66,27 @@ func (s *SentenceProcessor) ConcatAudioFromCache(path string) error {
 			if err != nil {
 				return err
 			}
-			s.concatenator.AddWithPause(tmpPath, 1500)
-			s.concatenator.AddWithPause(tmpPath, 1500)
+			s.concatenator.AddWithText(tmpPath, 1500, text)
+			s.concatenator.AddWithText(tmpPath, 1500, text)
 		} else {
-			s.concatenator.AddWithPause(cachePath, 1500)
-			s.concatenator.AddWithPause(cachePath, 1500)
+			s.concatenator.AddWithText(cachePath, 1500, text)
+			s.concatenator.AddWithText(cachePath, 1500, text)
 		}
 
+		s.concatenator.AddCue(audio.CueEnglish, 200)
 		cachePath = s.cache.GetCachePath(translation)
-		tmpFile = audio.GetFilename(translation)
 		if !s.cache.IsInCache(cachePath) {
-			tmpPath, err := s.gcpDownloader.Fetch(context.Background(), tmpFile)
+			tmpPath, err := s.gcpDownloader.Fetch(context.Background(), translation)
 			if err != nil {
 				return err
 			}
-			s.concatenator.AddWithPause(tmpPath, 1500)
+			s.concatenator.AddWithText(tmpPath, 1500, text)
 		} else {
-			s.concatenator.AddWithPause(cachePath, 1500)
+			s.concatenator.AddWithText(cachePath, 1500, text)
 		}
 
 		cachePath = s.cache.GetCachePath(sentence)
-		tmpFile = audio.GetFilename(sentence)
+		tmpFile = filepath.Base(cachePath)
 		if !s.cache.IsInCache(cachePath) {
 			query := s.azureDownloader.PrepareQueryWithRandomVoice(sentence, "0ms", true)
 			tmpPath, err := s.azureDownloader.Fetch(
@@ -92,10 +96,18 @@ func (s *SentenceProcessor) ConcatAudioFromCache(path string) error {
 			if err != nil {
 				return err
 			}
-			s.concatenator.AddWithPause(tmpPath, 1500)
+			s.concatenator.AddWithText(tmpPath, 1500, text)
 		} else {
-			s.concatenator.AddWithPause(cachePath, 1500)
+			s.concatenator.AddWithText(cachePath, 1500, text)
 		}
+
+		err = s.concatenator.Merge(filepath.Join(s.outDir, audio.GetFilename(sentence)))
+		s.concatenator.Reset()
+		if err != nil {
+			slog.Error("concat files", "sentence", sentence, "error", err)
+			continue
+		}
+		slog.Debug("concat files", "sentence", sentence)
 	}
 	return nil
 }
@@ -176,15 +188,14 @@ func (p *SentenceProcessor) loadSentences(path string) ([]string, error) {
 	defer file.Close()
 
 	var sentences []string
-	var sentence string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		sentence = scanner.Text()
-		if sentence == "" {
+		sentence := strings.TrimSpace(strings.ReplaceAll(scanner.Text(), " 。", ""))
+		// blank lines and lines of punctuation only are skipped
+		if !textnorm.Speakable(sentence) {
 			continue
 		}
-		sentence = strings.ReplaceAll(sentence, " 。", "")
-		sentences = append(sentences, strings.TrimSpace(sentence))
+		sentences = append(sentences, sentence)
 	}
-	return append(sentences, sentence), nil
+	return sentences, scanner.Err()
 }
@@ -10,10 +10,18 @@ import (
 	"strings"
 
 	"github.com/fbngrm/zh-audio/pkg/audio"
+	"github.com/fbngrm/zh-audio/pkg/dict"
 )
 
 type WordProcessor struct {
 	AzureDownloader *audio.AzureClient
+	// optional, fills in missing definitions and tones
+	Dict *dict.Dict
+	// senses of the meaning read aloud, dict.DefaultSenses if 0
+	Senses int
+	// optional, synthesizes every voice on its own and renders them with these options,
+	// so that the clips get subtitles, otherwise azure synthesizes them in one piece
+	Render *audio.RenderOptions
 }
 
 func (w *WordProcessor) GetAzureAudio(path string) error {
@@ -22,89 +30,70 @@ func (w *WordProcessor) GetAzureAudio(path string) error {
 		return err
 	}
 	for _, wd := range words {
-		if len(wd.HSK) == 0 && len(wd.Cedict) == 0 {
-			return fmt.Errorf("word %s has no translation", wd.Chinese)
+		if _, err := w.Fetch(wd); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		query := ""
-		query += w.AzureDownloader.PrepareQueryWithRandomVoice(wd.Chinese, "1000ms", true)
-		query += w.AzureDownloader.PrepareQueryWithRandomVoice(wd.Chinese, "1000ms", true)
-
-		tones := ""
-		for i, t := range wd.Tones {
-			tones += t
-			if i < len(wd.Tones)-1 {
-				tones += ", followed by "
-			}
-		}
-		if len(wd.Tones) == 1 {
-			query += w.AzureDownloader.PrepareEnglishQuery("The tone is the "+tones, "1000ms")
-		} else if len(wd.Tones) > 1 {
-			query += w.AzureDownloader.PrepareEnglishQuery("The tones are "+tones, "1000ms")
-		}
-		query += w.AzureDownloader.PrepareQueryWithRandomVoice(wd.Chinese, "1000ms", true)
-
-		wordEng := ""
-		if len(wd.HSK) != 0 {
-			for i, h := range wd.HSK {
-				wordEng += h.HSKEnglish + " "
-				if i < len(wd.HSK)-1 {
-					wordEng += "or "
-				}
-			}
-		}
-		// Regex to match ", CL" followed by anything until the next whitespace
-		re := regexp.MustCompile(`, CL[^\s]*`)
-		if len(wd.HSK) == 0 && len(wd.Cedict) != 0 {
-			for i, h := range wd.Cedict {
-				wordEng += re.ReplaceAllString(h.CedictEnglish, "") + " "
-				if i < len(wd.Cedict)-1 {
-					wordEng += "or "
-				}
-			}
-		}
-		query += w.replaceTextWithAudio(wordEng, "1000ms")
-		query += w.AzureDownloader.PrepareQueryWithRandomVoice(wd.Chinese, "1500ms", true)
-		query += w.AzureDownloader.PrepareQueryWithRandomVoice(wd.Chinese, "1500ms", true)
-		query += w.replaceTextWithAudio(removeWrappingSingleQuotes(wd.Note), "200ms")
-		query += w.AzureDownloader.PrepareEnglishQuery("Here are a few example sentences", "1000ms")
-
-		for _, e := range wd.Examples {
-			query += w.AzureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
-			query += w.AzureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
-			query += w.AzureDownloader.PrepareEnglishQuery(removeWrappingSingleQuotes(e.English), "2000ms")
-			query += w.AzureDownloader.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+// Fetch synthesizes the audio of a word and returns the path of the clip.
+func (w *WordProcessor) Fetch(wd Word) (string, error) {
+	if w.Dict != nil {
+		fillFromDict(w.Dict, &wd, wd.Pinyin)
+	}
+	if len(wd.HSK) == 0 && len(wd.Cedict) == 0 {
+		return "", fmt.Errorf("word %s has no translation", wd.Chinese)
+	}
+	// the pinyin of the item overrides the reading of its word in this clip only
+	azure := w.AzureDownloader
+	if wd.Pinyin != "" {
+		var err error
+		azure, err = azure.WithOverride(wd.Chinese, wd.Pinyin)
+		if err != nil {
+			return "", fmt.Errorf("word %s: %w", wd.Chinese, err)
 		}
+	}
 
-		query = cleanQuery(query)
-		fmt.Println(strings.Count(query, "<voice"))
-		// fmt.Println(query)
-		if _, err := w.AzureDownloader.Fetch(context.Background(), query, audio.GetFilename(wd.Chinese)); err != nil {
-			return err
+	query := ""
+	query += azure.PrepareQueryWithRandomVoice(wd.Chinese, "1000ms", true)
+	query += azure.PrepareQueryWithRandomVoice(wd.Chinese, "1000ms", true)
+
+	tones := ""
+	for i, t := range wd.Tones {
+		tones += t
+		if i < len(wd.Tones)-1 {
+			tones += ", followed by "
 		}
 	}
-	return nil
-}
+	if len(wd.Tones) == 1 {
+		query += azure.PrepareEnglishQuery("The tone is the "+tones, "1000ms")
+	} else if len(wd.Tones) > 1 {
+		query += azure.PrepareEnglishQuery("The tones are "+tones, "1000ms")
+	}
+	query += azure.PrepareQueryWithRandomVoice(wd.Chinese, "1000ms", true)
+
+	wordEng := spokenMeaning(wd, w.Senses)
+	query += azure.PrepareMixedQuery(wordEng, "1000ms")
+	query += azure.PrepareQueryWithRandomVoice(wd.Chinese, "1500ms", true)
+	query += azure.PrepareQueryWithRandomVoice(wd.Chinese, "1500ms", true)
+	query += azure.PrepareMixedQuery(removeWrappingSingleQuotes(wd.Note), "200ms")
+	query += azure.PrepareEnglishQuery("Here are a few example sentences", "1000ms")
+
+	for _, e := range wd.Examples {
+		query += azure.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+		query += azure.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+		query += azure.PrepareEnglishQuery(removeWrappingSingleQuotes(e.English), "2000ms")
+		query += azure.PrepareQueryWithRandomVoice(e.Chinese, "2000ms", true)
+	}
 
-func (w *WordProcessor) replaceTextWithAudio(text, pause string) string {
-	// Define a regex pattern to match sequences of Chinese characters
-	chineseRe := regexp.MustCompile(`[\p{Han}]+`)
-	// Update the regex pattern to match English phrases with surrounding punctuation included
-	englishRe := regexp.MustCompile(`[A-Za-z]+(?:'[A-Za-z]+)?(?:[\s]*[,!?;:.]*[\s]*[A-Za-z]+(?:'[A-Za-z]+)?)*[,.!?;:]*`)
-
-	// Replace English text with audio
-	text = englishRe.ReplaceAllStringFunc(text, func(englishText string) string {
-		audio := w.AzureDownloader.PrepareEnglishQuery(englishText, pause)
-		return audio
-	})
-
-	// Replace Chinese text with audio
-	text = chineseRe.ReplaceAllStringFunc(text, func(chineseText string) string {
-		audio := w.AzureDownloader.PrepareQueryWithRandomVoice(chineseText, pause, false)
-		return audio
-	})
-
-	return text
+	query = cleanQuery(query)
+	fmt.Println(strings.Count(query, "<voice"))
+	// fmt.Println(query)
+	if w.Render != nil {
+		return azure.FetchSegments(context.Background(), query, audio.GetFilename(wd.Chinese), *w.Render)
+	}
+	return azure.Fetch(context.Background(), query, audio.GetFilename(wd.Chinese))
 }
 
 func loadWordsFromDir(dir string) ([]Word, error) {
@@ -0,0 +1,62 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-audio/pkg/audio"
+)
+
+func TestWordFetchSegments(t *testing.T) {
+	fake, client := newFakeAzure(t)
+	manifest := audio.NewManifest("test")
+	w := WordProcessor{
+		AzureDownloader: client,
+		Render:          &audio.RenderOptions{Subtitles: true, Manifest: manifest},
+	}
+	path, err := w.Fetch(Word{
+		Chinese: "好",
+		Cedict:  []CedictEntry{{CedictEnglish: "good"}},
+		Tones:   []string{"third tone"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(client.AudioDir, "好.mp3"); path != want {
+		t.Errorf("rendered %s, want %s", path, want)
+	}
+	for _, ext := range []string{".mp3", ".lrc", ".vtt"} {
+		if _, err := os.Stat(filepath.Join(client.AudioDir, "好"+ext)); err != nil {
+			t.Error(err)
+		}
+	}
+	// every voice is synthesized on its own, its silence becomes the pause after it
+	for _, q := range fake.queries {
+		if strings.Count(q, "<voice") != 1 || !strings.Contains(q, `value="0ms"`) {
+			t.Errorf("query of more than a voice or with silence:\n%s", q)
+		}
+	}
+
+	var texts []string
+	var pauses []time.Duration
+	segments := output(t, manifest, "好.mp3")
+	for i, s := range segments {
+		texts = append(texts, s.Chinese+s.English)
+		if i > 0 {
+			pauses = append(pauses, s.Start-segments[i-1].End)
+		}
+	}
+	wantTexts := []string{"好", "好", "好", "好", "The tone is the third tone", "好", "好", "good", "好", "好", "好", "好", "Here are a few example sentences"}
+	if !reflect.DeepEqual(texts, wantTexts) {
+		t.Errorf("segments %q, want %q", texts, wantTexts)
+	}
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	wantPauses := []time.Duration{ms(1000), ms(1000), ms(1000), ms(1000), ms(1000), ms(1000), ms(1000), ms(1000), ms(1500), ms(1500), ms(1500), ms(1500)}
+	if !reflect.DeepEqual(pauses, wantPauses) {
+		t.Errorf("pauses %v, want %v", pauses, wantPauses)
+	}
+}
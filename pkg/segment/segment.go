@@ -0,0 +1,226 @@
+// Package segment splits text of mixed languages, like the notes of words and patterns,
+// into spans of english, chinese, pinyin, numbers and punctuation so that every span is
+// read by a voice of its language.
+package segment
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/fbngrm/zh-audio/pkg/dict"
+)
+
+type Kind int
+
+const (
+	English Kind = iota
+	Chinese
+	Pinyin
+	Numeric
+	Punctuation
+)
+
+func (k Kind) String() string {
+	switch k {
+	case English:
+		return "english"
+	case Chinese:
+		return "chinese"
+	case Pinyin:
+		return "pinyin"
+	case Numeric:
+		return "numeric"
+	case Punctuation:
+		return "punctuation"
+	}
+	return "unknown"
+}
+
+// Span is a run of text of one kind.
+type Span struct {
+	Kind Kind
+	Text string
+	// numbered pinyin of pinyin spans, e.g. "ni3 hao3"
+	Pinyin string
+}
+
+type token int
+
+const (
+	han token = iota
+	word
+	number
+	space
+	cjkPunct
+	punct
+)
+
+var tokenRes = []struct {
+	token token
+	re    *regexp.Regexp
+}{
+	{han, regexp.MustCompile(`^\p{Han}+`)},
+	{word, regexp.MustCompile(`^\p{Latin}+\d*(?:['’\-]?\p{Latin}+\d*)*`)},
+	{number, regexp.MustCompile(`^\d+(?:[.,:]\d+)*%?`)},
+	{space, regexp.MustCompile(`^\s+`)},
+	{cjkPunct, regexp.MustCompile(`^[\x{3000}-\x{303F}\x{FF00}-\x{FFEF}]+`)},
+}
+
+// unmarked syllables read as pinyin next to other pinyin, the neutral tone particles
+// and suffixes, e.g. le in "chī le"
+var neutralSyllables = map[string]bool{
+	"de": true, "le": true, "ma": true, "ne": true, "ba": true, "zi": true, "men": true,
+	"me": true, "ge": true, "tou": true, "zhe": true, "la": true, "ya": true, "wa": true,
+}
+
+type tok struct {
+	token  token
+	text   string
+	kind   Kind
+	pinyin []string
+}
+
+// Split splits text into spans: han characters and chinese punctuation are chinese,
+// words with tone marks or tone numbers that are valid pinyin are pinyin, other latin
+// words english. Numbers attached to chinese are chinese, numbers next to english words
+// english, others numeric. Spaces join spans of the same kind.
+func Split(text string) []Span {
+	toks := tokenize(text)
+	for i := range toks {
+		t := &toks[i]
+		switch t.token {
+		case han, cjkPunct:
+			t.kind = Chinese
+		case word:
+			t.kind = English
+			if syllables, ok := dict.SplitPinyin(t.text); ok && (isMarked(t.text) || isReading(toks, i)) {
+				t.kind, t.pinyin = Pinyin, syllables
+			}
+		default:
+			t.kind = Punctuation
+		}
+	}
+	// neutral tone syllables next to pinyin
+	for changed := true; changed; {
+		changed = false
+		for i := range toks {
+			t := &toks[i]
+			if t.token != word || t.kind != English || !neutralSyllables[strings.ToLower(t.text)] {
+				continue
+			}
+			if neighbourKind(toks, i, -1, true) == Pinyin || neighbourKind(toks, i, 1, true) == Pinyin {
+				t.kind, t.pinyin = Pinyin, []string{strings.ToLower(t.text) + "5"}
+				changed = true
+			}
+		}
+	}
+	for i := range toks {
+		t := &toks[i]
+		switch t.token {
+		case number:
+			switch {
+			case neighbourKind(toks, i, -1, false) == Chinese || neighbourKind(toks, i, 1, false) == Chinese:
+				t.kind = Chinese
+			case neighbourKind(toks, i, -1, true) == English || neighbourKind(toks, i, 1, true) == English:
+				t.kind = English
+			default:
+				t.kind = Numeric
+			}
+		case punct:
+			// punctuation is read as part of the english or chinese text before it
+			if k := neighbourKind(toks, i, -1, false); k == English || k == Chinese {
+				t.kind = k
+			}
+		}
+	}
+	for i := range toks {
+		if toks[i].token != space {
+			continue
+		}
+		if prev, next := neighbourKind(toks, i, -1, false), neighbourKind(toks, i, 1, false); prev == next {
+			toks[i].kind = prev
+		}
+	}
+	var spans []Span
+	for _, t := range toks {
+		if t.token == space && t.kind == Punctuation {
+			continue
+		}
+		if n := len(spans); n > 0 && spans[n-1].Kind == t.kind {
+			spans[n-1].Text += t.text
+			if len(t.pinyin) > 0 {
+				spans[n-1].Pinyin = strings.TrimSpace(spans[n-1].Pinyin + " " + strings.Join(t.pinyin, " "))
+			}
+			continue
+		}
+		spans = append(spans, Span{Kind: t.kind, Text: t.text, Pinyin: strings.Join(t.pinyin, " ")})
+	}
+	for i := range spans {
+		spans[i].Text = strings.TrimSpace(spans[i].Text)
+	}
+	return spans
+}
+
+// tokenize splits text into runs of han characters, words, numbers, spaces and
+// punctuation.
+func tokenize(text string) []tok {
+	var toks []tok
+	for text != "" {
+		t := tok{token: punct}
+		for _, r := range tokenRes {
+			if m := r.re.FindString(text); m != "" {
+				t.token, t.text = r.token, m
+				break
+			}
+		}
+		if t.text == "" {
+			// a single rune of other punctuation
+			for _, r := range text {
+				t.text = string(r)
+				break
+			}
+		}
+		toks = append(toks, t)
+		text = text[len(t.text):]
+	}
+	return toks
+}
+
+// neighbourKind returns the kind of the token next to i in direction dir, -1 if there is
+// none. Spaces are skipped if skipSpace is set, otherwise a space has no kind.
+func neighbourKind(toks []tok, i, dir int, skipSpace bool) Kind {
+	for j := i + dir; j >= 0 && j < len(toks); j += dir {
+		if toks[j].token != space {
+			return toks[j].kind
+		}
+		if !skipSpace {
+			break
+		}
+	}
+	return -1
+}
+
+// isReading reports whether the word at i is in parentheses after chinese, like the
+// reading of 了 (le).
+func isReading(toks []tok, i int) bool {
+	if i < 2 || i+1 >= len(toks) || toks[i-1].text != "(" || toks[i+1].text != ")" {
+		return false
+	}
+	j := i - 2
+	if toks[j].token == space && j > 0 {
+		j--
+	}
+	return toks[j].token == han
+}
+
+// isMarked reports whether a word carries tone marks or tone numbers, e.g. "hǎo" or
+// "hao3". Words like A4 are not taken as numbered pinyin.
+func isMarked(word string) bool {
+	if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+		return len(word) > 2
+	}
+	return strings.IndexFunc(word, func(r rune) bool {
+		return r > unicode.MaxASCII && r != 'ü' && r != 'Ü'
+	}) >= 0
+}
@@ -0,0 +1,67 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Span
+	}{
+		{"", nil},
+		{"你好", []Span{{Kind: Chinese, Text: "你好"}}},
+		{"hello world", []Span{{Kind: English, Text: "hello world"}}},
+		{"了 (le) marks a change", []Span{
+			{Kind: Chinese, Text: "了"},
+			{Kind: Punctuation, Text: "("},
+			{Kind: Pinyin, Text: "le", Pinyin: "le5"},
+			{Kind: Punctuation, Text: ")"},
+			{Kind: English, Text: "marks a change"},
+		}},
+		{"nǐ hǎo means hello", []Span{
+			{Kind: Pinyin, Text: "nǐ hǎo", Pinyin: "ni3 hao3"},
+			{Kind: English, Text: "means hello"},
+		}},
+		{"chī le", []Span{{Kind: Pinyin, Text: "chī le", Pinyin: "chi1 le5"}}},
+		{"use 个 with people", []Span{
+			{Kind: English, Text: "use"},
+			{Kind: Chinese, Text: "个"},
+			{Kind: English, Text: "with people"},
+		}},
+		{"3个人", []Span{{Kind: Chinese, Text: "3个人"}}},
+		{"page 3", []Span{{Kind: English, Text: "page 3"}}},
+		{"A4 paper", []Span{{Kind: English, Text: "A4 paper"}}},
+		{"2024 - 2025", []Span{
+			{Kind: Numeric, Text: "2024"},
+			{Kind: Punctuation, Text: "-"},
+			{Kind: Numeric, Text: "2025"},
+		}},
+		{"好。ok", []Span{{Kind: Chinese, Text: "好。"}, {Kind: English, Text: "ok"}}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestKindString(t *testing.T) {
+	tests := []struct {
+		kind Kind
+		want string
+	}{
+		{English, "english"},
+		{Chinese, "chinese"},
+		{Pinyin, "pinyin"},
+		{Numeric, "numeric"},
+		{Punctuation, "punctuation"},
+		{Kind(-1), "unknown"},
+	}
+	for _, tt := range tests {
+		if got := tt.kind.String(); got != tt.want {
+			t.Errorf("Kind(%d).String() = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package textnorm
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fbngrm/zh-audio/pkg/dict"
+)
+
+// Lexicon overrides the reading of words, e.g. 行 as hang2 in 银行. Words are matched by
+// the longest entry.
+type Lexicon struct {
+	entries map[string]string // numbered pinyin by word
+	maxLen  int
+}
+
+func NewLexicon() *Lexicon {
+	return &Lexicon{entries: make(map[string]string)}
+}
+
+// LoadLexicon reads a lexicon file, an entry per line with the word followed by its
+// pinyin, numbered like "银行 yin2 hang2" or marked like "银行 yín háng". Lines starting
+// with # are comments.
+func LoadLexicon(path string) (*Lexicon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l := NewLexicon()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		word, pinyin, ok := strings.Cut(strings.Replace(text, "\t", " ", 1), " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected a word and its pinyin", path, line)
+		}
+		if err := l.Add(word, pinyin); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Add sets the reading of a word, the pinyin needs a syllable per character.
+func (l *Lexicon) Add(word, pinyin string) error {
+	word = strings.TrimSpace(word)
+	numbered := dict.Numbered(pinyin)
+	if n := len(strings.Fields(numbered)); n != len([]rune(word)) {
+		return fmt.Errorf("pinyin %q of %s has %d syllables, expected one per character", pinyin, word, n)
+	}
+	l.entries[word] = numbered
+	if n := len([]rune(word)); n > l.maxLen {
+		l.maxLen = n
+	}
+	return nil
+}
+
+// With returns a copy of the lexicon that reads word by pinyin, the lexicon itself is not
+// changed. A nil lexicon is extended like an empty one.
+func (l *Lexicon) With(word, pinyin string) (*Lexicon, error) {
+	c := NewLexicon()
+	if l != nil {
+		for w, p := range l.entries {
+			c.entries[w] = p
+		}
+		c.maxLen = l.maxLen
+	}
+	if err := c.Add(word, pinyin); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Lookup returns the numbered pinyin of a word.
+func (l *Lexicon) Lookup(word string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	p, ok := l.entries[word]
+	return p, ok
+}
+
+// Words returns the words of the lexicon, sorted.
+func (l *Lexicon) Words() []string {
+	if l == nil {
+		return nil
+	}
+	words := make([]string, 0, len(l.entries))
+	for w := range l.entries {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Key identifies the readings the lexicon gives a text: a hash of the words of the
+// lexicon in the text and their pinyin, empty if there are none. Clips are keyed by it,
+// so that a changed reading is synthesized anew.
+func (l *Lexicon) Key(text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), ""))
+	h := sha256.New()
+	found := false
+	for i := 0; i < len(runes); {
+		n := l.Match(runes[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		word := string(runes[i : i+n])
+		fmt.Fprintf(h, "%s %s\n", word, l.entries[word])
+		found = true
+		i += n
+	}
+	if !found {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// Match returns the length in runes of the longest word of the lexicon at the start of
+// runes, 0 if there is none.
+func (l *Lexicon) Match(runes []rune) int {
+	if l == nil {
+		return 0
+	}
+	for n := min(l.maxLen, len(runes)); n > 0; n-- {
+		if _, ok := l.entries[string(runes[:n])]; ok {
+			return n
+		}
+	}
+	return 0
+}
+
+// Sapi writes numbered pinyin in the phone set of the sapi alphabet of azure, e.g.
+// "lü4 se4" as "lv 4 se 4".
+func Sapi(pinyin string) string {
+	var phones []string
+	for _, s := range strings.Fields(dict.Numbered(pinyin)) {
+		i := strings.IndexFunc(s, unicode.IsDigit)
+		phones = append(phones, strings.ReplaceAll(s[:i], "ü", "v"), s[i:])
+	}
+	return strings.Join(phones, " ")
+}
+
+// WritePLS writes the lexicon as a pronunciation lexicon for azure custom lexicons.
+func (l *Lexicon) WritePLS(w io.Writer) error {
+	type lexeme struct {
+		Grapheme string `xml:"grapheme"`
+		Phoneme  string `xml:"phoneme"`
+	}
+	type lexicon struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2005/01/pronunciation-lexicon lexicon"`
+		Version  string   `xml:"version,attr"`
+		Alphabet string   `xml:"alphabet,attr"`
+		Lang     string   `xml:"xml:lang,attr"`
+		Lexemes  []lexeme `xml:"lexeme"`
+	}
+	pls := lexicon{Version: "1.0", Alphabet: "sapi", Lang: "zh-CN"}
+	for _, word := range l.Words() {
+		pls.Lexemes = append(pls.Lexemes, lexeme{Grapheme: word, Phoneme: Sapi(l.entries[word])})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(pls); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// common polyphonic characters, azure often picks the wrong reading for them without
+// context
+const polyphones = "行长了还得觉重好乐为都地的着只差数便调处分干教种相空少几发难假间当省传藏背薄参朝称冲曾待弹倒更供号和划会降将角结卷看落没模宁片强切曲散上舍盛似宿提系鲜兴要应载扎正中转作大奇量露率冒蒙埋泊铺骑亲圈任扇胜属说挑帖吓削血咽叶与晕粘殖轴撞钻区单仔给佛解累哄混缝尽济卡壳恶"
+
+// IsPolyphone reports whether r is a common polyphonic character.
+func IsPolyphone(r rune) bool {
+	return strings.ContainsRune(polyphones, r)
+}
@@ -0,0 +1,112 @@
+package textnorm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadLexicon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lexicon.txt")
+	data := "# overrides\n银行 yin2 hang2\n\n行长\tháng zhǎng\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadLexicon(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Words(); !reflect.DeepEqual(got, []string{"行长", "银行"}) {
+		t.Errorf("words = %v", got)
+	}
+	if p, _ := l.Lookup("行长"); p != "hang2 zhang3" {
+		t.Errorf("行长 read as %q", p)
+	}
+	if err := os.WriteFile(path, []byte("银行 yin2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLexicon(path); err == nil {
+		t.Error("pinyin without a syllable per character accepted")
+	}
+}
+
+func TestLexiconWith(t *testing.T) {
+	l := NewLexicon()
+	if err := l.Add("银行", "yin2 hang2"); err != nil {
+		t.Fatal(err)
+	}
+	o, err := l.With("行", "xing2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Lookup("行"); ok {
+		t.Error("With changed the lexicon")
+	}
+	if p, _ := o.Lookup("行"); p != "xing2" {
+		t.Errorf("override read as %q", p)
+	}
+	if p, _ := o.Lookup("银行"); p != "yin2 hang2" {
+		t.Errorf("entries not copied: %q", p)
+	}
+	var empty *Lexicon
+	if o, err := empty.With("行", "xing2"); err != nil || o.Match([]rune("行")) != 1 {
+		t.Errorf("With of a nil lexicon: %v", err)
+	}
+	if _, err := l.With("行", "xing2 hang2"); err == nil {
+		t.Error("override without a syllable per character accepted")
+	}
+}
+
+func TestLexiconKey(t *testing.T) {
+	l := NewLexicon()
+	if err := l.Add("银行", "yin2 hang2"); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := l.With("银行", "yin2 xing2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := l.With("长", "zhang3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		a, b string // keys compared
+		same bool
+	}{
+		{"no lexicon word", l.Key("你好"), "", true},
+		{"nil lexicon", (*Lexicon)(nil).Key("去银行"), "", true},
+		{"stable", l.Key("去银行"), l.Key("去银行"), true},
+		{"spaces", l.Key("去 银 行"), l.Key("去银行"), true},
+		{"changed reading", l.Key("去银行"), changed.Key("去银行"), false},
+		{"entry not in text", l.Key("去银行"), other.Key("去银行"), true},
+		{"other words", l.Key("去银行"), l.Key("银行关门"), true},
+	}
+	for _, tt := range tests {
+		if (tt.a == tt.b) != tt.same {
+			t.Errorf("%s: keys %q and %q", tt.name, tt.a, tt.b)
+		}
+	}
+	if key := l.Key("去银行"); len(key) != 8 {
+		t.Errorf("key %q", key)
+	}
+}
+
+func TestSapi(t *testing.T) {
+	tests := []struct {
+		pinyin string
+		want   string
+	}{
+		{"yin2 hang2", "yin 2 hang 2"},
+		{"lü4 se4", "lv 4 se 4"},
+		{"yínháng", "yin 2 hang 2"},
+		{"ma5", "ma 5"},
+	}
+	for _, tt := range tests {
+		if got := Sapi(tt.pinyin); got != tt.want {
+			t.Errorf("Sapi(%s) = %q, want %q", tt.pinyin, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package textnorm
+
+import (
+	"strconv"
+	"strings"
+)
+
+var digitNames = []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+// Digits reads a number digit by digit, e.g. 2024 as 二零二四. Characters other than
+// digits are dropped.
+func Digits(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteString(digitNames[r-'0'])
+		}
+	}
+	return b.String()
+}
+
+// phoneDigits reads a phone number digit by digit with 幺 for one, groups are separated
+// by a pause.
+func phoneDigits(number string) string {
+	var groups []string
+	for _, g := range strings.FieldsFunc(number, func(r rune) bool { return r < '0' || r > '9' }) {
+		groups = append(groups, strings.ReplaceAll(Digits(g), "一", "幺"))
+	}
+	return strings.Join(groups, "，")
+}
+
+// Cardinal reads an integer like 10305 as 一万零三百零五. Thousands separators are
+// ignored, numbers with a leading zero or more than 16 digits are read digit by digit.
+func Cardinal(number string) string {
+	number = strings.ReplaceAll(number, ",", "")
+	if number == "0" {
+		return digitNames[0]
+	}
+	if strings.HasPrefix(number, "0") || len(number) > 16 {
+		return Digits(number)
+	}
+	// groups of four digits, the lowest last
+	var groups []int
+	for len(number) > 0 {
+		n := max(len(number)-4, 0)
+		g, err := strconv.Atoi(number[n:])
+		if err != nil {
+			return Digits(number)
+		}
+		groups = append([]int{g}, groups...)
+		number = number[:n]
+	}
+	units := []string{"", "万", "亿", "万亿"}
+	var b strings.Builder
+	zero := false
+	for i, g := range groups {
+		unit := units[len(groups)-1-i]
+		if g == 0 {
+			zero = b.Len() > 0
+			continue
+		}
+		if zero || (b.Len() > 0 && g < 1000) {
+			b.WriteString(digitNames[0])
+		}
+		b.WriteString(group(g, b.Len() == 0))
+		b.WriteString(unit)
+		zero = false
+	}
+	s := b.String()
+	// 两 is read for a leading two of hundreds and larger units
+	for _, unit := range []string{"百", "千", "万", "亿"} {
+		if strings.HasPrefix(s, "二"+unit) {
+			return "两" + strings.TrimPrefix(s, "二")
+		}
+	}
+	return s
+}
+
+// group reads a number below 10000, 十 instead of 一十 at the start of a number.
+func group(n int, leading bool) string {
+	units := []string{"千", "百", "十", ""}
+	digits := []int{n / 1000, n / 100 % 10, n / 10 % 10, n % 10}
+	var b strings.Builder
+	started, zero := false, false
+	for i, d := range digits {
+		if d == 0 {
+			zero = started
+			continue
+		}
+		if zero {
+			b.WriteString(digitNames[0])
+			zero = false
+		}
+		if !(d == 1 && units[i] == "十" && !started && leading) {
+			b.WriteString(digitNames[d])
+		}
+		b.WriteString(units[i])
+		started = true
+	}
+	return b.String()
+}
+
+// Decimal reads a number with decimals like 3.14 as 三点一四.
+func Decimal(number string) string {
+	integer, fraction, ok := strings.Cut(number, ".")
+	if !ok {
+		return Cardinal(integer)
+	}
+	return Cardinal(integer) + "点" + Digits(fraction)
+}
+
+// Count reads the number of a quantity: a single 2 before a measure word is 两.
+func Count(number string) string {
+	if number == "2" {
+		return "两"
+	}
+	return Decimal(number)
+}
@@ -0,0 +1,60 @@
+package textnorm
+
+import "testing"
+
+func TestCardinal(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"0", "零"},
+		{"5", "五"},
+		{"10", "十"},
+		{"15", "十五"},
+		{"20", "二十"},
+		{"22", "二十二"},
+		{"105", "一百零五"},
+		{"110", "一百一十"},
+		{"200", "两百"},
+		{"1000", "一千"},
+		{"2222", "两千二百二十二"},
+		{"1,234", "一千二百三十四"},
+		{"10010", "一万零一十"},
+		{"10305", "一万零三百零五"},
+		{"20000", "两万"},
+		{"100000", "十万"},
+		{"100000000", "一亿"},
+		{"200000001", "两亿零一"},
+		{"0123", "零一二三"},
+		{"12345678901234567", "一二三四五六七八九零一二三四五六七"},
+	}
+	for _, tt := range tests {
+		if got := Cardinal(tt.number); got != tt.want {
+			t.Errorf("Cardinal(%s) = %s, want %s", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestDigitsDecimalCount(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(string) string
+		in   string
+		want string
+	}{
+		{"digits", Digits, "2024", "二零二四"},
+		{"digits drop others", Digits, "10-1", "一零一"},
+		{"decimal", Decimal, "3.14", "三点一四"},
+		{"decimal integer", Decimal, "12", "十二"},
+		{"decimal zero", Decimal, "0.5", "零点五"},
+		{"count two", Count, "2", "两"},
+		{"count twelve", Count, "12", "十二"},
+		{"count decimal", Count, "2.5", "二点五"},
+		{"phone", phoneDigits, "010-12345678", "零幺零，幺二三四五六七八"},
+	}
+	for _, tt := range tests {
+		if got := tt.read(tt.in); got != tt.want {
+			t.Errorf("%s: %s read as %s, want %s", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
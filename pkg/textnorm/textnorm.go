@@ -0,0 +1,269 @@
+// Package textnorm normalizes chinese text before synthesis: numbers get their chinese
+// reading by context and latin tokens are marked up so that voices read them as
+// intended.
+package textnorm
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// a span of the text, read as alias or by its phonemes if they are set
+type span struct {
+	text    string
+	alias   string
+	phoneme string // numbered pinyin
+	latin   bool
+	done    bool
+}
+
+// Options of the normalization.
+type Options struct {
+	// latin words are read by the english voice, supported by multilingual voices only
+	Multilingual bool
+	// optional, overrides the reading of words
+	Lexicon *Lexicon
+}
+
+// a rule reads the spans matched by re
+type rule struct {
+	re   *regexp.Regexp
+	read func(m []string) string
+}
+
+// number with optional thousands separators
+const num = `(\d{1,3}(?:,\d{3})+|\d+)`
+
+// measure words after which a single 2 is read 两
+const measureWords = `个|位|只|本|次|天|年|岁|点|件|张|块|条|斤|公斤|公里|米|小时|分钟|秒|秒钟|倍|家|台|辆|杯|瓶|碗|口|双|对|种|遍|周|星期|个月|份|层|节|门|句|篇|首|部|场|顿|趟|套|座|间|把|支|棵|匹|头|片|名|元|毛|分`
+
+var rules = []rule{
+	// phone numbers
+	{regexp.MustCompile(`1[3-9]\d{9}|\d{3,4}-\d{7,8}|\d{3}-\d{3,4}-\d{4}`), func(m []string) string {
+		return phoneDigits(m[0])
+	}},
+	{regexp.MustCompile(`(电话|手机|号码|热线)(是|：|:)?\s*(\d[\d\- ]{2,}\d)`), func(m []string) string {
+		return m[1] + m[2] + phoneDigits(m[3])
+	}},
+	// dates, years are read digit by digit
+	{regexp.MustCompile(`(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})`), func(m []string) string {
+		return Digits(m[1]) + "年" + Cardinal(strings.TrimLeft(m[2], "0")) + "月" + Cardinal(strings.TrimLeft(m[3], "0")) + "日"
+	}},
+	{regexp.MustCompile(`(\d{4})(年)`), func(m []string) string {
+		return Digits(m[1]) + m[2]
+	}},
+	// times
+	{regexp.MustCompile(`([01]?\d|2[0-4])[:：]([0-5]\d)(?:[:：]([0-5]\d))?`), func(m []string) string {
+		s := Count(strings.TrimPrefix(m[1], "0")) + "点"
+		if m[1] == "0" || m[1] == "00" {
+			s = "零点"
+		}
+		switch minutes := m[2]; {
+		case minutes == "00" && m[3] == "":
+		case minutes == "30" && m[3] == "":
+			s += "半"
+		case minutes[0] == '0':
+			s += "零" + Digits(minutes[1:]) + "分"
+		default:
+			s += Cardinal(minutes) + "分"
+		}
+		if m[3] != "" {
+			s += Cardinal(strings.TrimPrefix(m[3], "0")) + "秒"
+		}
+		return s
+	}},
+	// percentages and per mille
+	{regexp.MustCompile(num + `(\.\d+)?\s*[%％]`), func(m []string) string {
+		return "百分之" + Decimal(m[1]+m[2])
+	}},
+	{regexp.MustCompile(num + `(\.\d+)?\s*‰`), func(m []string) string {
+		return "千分之" + Decimal(m[1]+m[2])
+	}},
+	// currency
+	{regexp.MustCompile(`([¥￥$€£])\s*` + num + `(\.\d+)?`), func(m []string) string {
+		currency := map[string]string{"¥": "元", "￥": "元", "$": "美元", "€": "欧元", "£": "英镑"}[m[1]]
+		return Count(strings.ReplaceAll(m[2], ",", "")+m[3]) + currency
+	}},
+	// temperatures
+	{regexp.MustCompile(`(-?)` + num + `(\.\d+)?\s*(°C|℃|°)`), func(m []string) string {
+		s := Decimal(m[2]+m[3]) + "度"
+		if m[1] == "-" {
+			s = "零下" + s
+		}
+		return s
+	}},
+	// fractions and ranges
+	{regexp.MustCompile(`(\d+)/(\d+)`), func(m []string) string {
+		return Cardinal(m[2]) + "分之" + Cardinal(m[1])
+	}},
+	{regexp.MustCompile(num + `\s*[-~～–—]\s*` + num), func(m []string) string {
+		return Cardinal(m[1]) + "到" + Cardinal(m[2])
+	}},
+	// rooms, flights and trains are read digit by digit
+	{regexp.MustCompile(`(房间|房号|门牌|编号|航班|车次)(号)?\s*([A-Z]*)(\d{3,})`), func(m []string) string {
+		return m[1] + m[2] + m[3] + Digits(m[4])
+	}},
+	{regexp.MustCompile(`([A-Z]*)(\d{3,})(房间|号房|室|次|航班)`), func(m []string) string {
+		return m[1] + Digits(m[2]) + m[3]
+	}},
+	// ordinals
+	{regexp.MustCompile(`第\s*` + num), func(m []string) string {
+		return "第" + Cardinal(m[1])
+	}},
+	// quantities and other numbers
+	{regexp.MustCompile(num + `(\.\d+)?(` + measureWords + `)`), func(m []string) string {
+		return Count(strings.ReplaceAll(m[1], ",", "")+m[2]) + m[3]
+	}},
+	{regexp.MustCompile(num + `(\.\d+)?`), func(m []string) string {
+		return Decimal(m[1] + m[2])
+	}},
+}
+
+var latinRe = regexp.MustCompile(`[A-Za-z](?:[A-Za-z'’.&+\-]*[A-Za-z+])?`)
+
+// acronyms spelled letter by letter, e.g. CEO or KTV
+var acronymRe = regexp.MustCompile(`^[A-Z]{1,5}$`)
+
+// latin words read as words although written in capitals
+var latinWords = map[string]bool{"OK": true}
+
+// normalize splits the text into spans of lexicon words, numbers with their reading, latin
+// tokens and other text.
+func normalize(text string, lexicon *Lexicon) []span {
+	spans := lookup(text, lexicon)
+	for _, r := range rules {
+		var next []span
+		for _, s := range spans {
+			if s.done {
+				next = append(next, s)
+				continue
+			}
+			next = append(next, r.apply(s.text)...)
+		}
+		spans = next
+	}
+	var out []span
+	for _, s := range spans {
+		if s.done {
+			out = append(out, s)
+			continue
+		}
+		last := 0
+		for _, loc := range latinRe.FindAllStringIndex(s.text, -1) {
+			if loc[0] > last {
+				out = append(out, span{text: s.text[last:loc[0]]})
+			}
+			out = append(out, span{text: s.text[loc[0]:loc[1]], latin: true, done: true})
+			last = loc[1]
+		}
+		if last < len(s.text) {
+			out = append(out, span{text: s.text[last:]})
+		}
+	}
+	return out
+}
+
+// lookup splits text into the words of the lexicon and the rest.
+func lookup(text string, lexicon *Lexicon) []span {
+	var spans []span
+	runes := []rune(text)
+	last := 0
+	for i := 0; i < len(runes); {
+		n := lexicon.Match(runes[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		if i > last {
+			spans = append(spans, span{text: string(runes[last:i])})
+		}
+		word := string(runes[i : i+n])
+		phoneme, _ := lexicon.Lookup(word)
+		spans = append(spans, span{text: word, phoneme: phoneme, done: true})
+		i += n
+		last = i
+	}
+	if last < len(runes) {
+		spans = append(spans, span{text: string(runes[last:])})
+	}
+	return spans
+}
+
+// apply splits text into the matched spans and the rest. Matches that continue a number,
+// e.g. 024年 of 12024年, are skipped.
+func (r rule) apply(text string) []span {
+	var spans []span
+	last := 0
+	for _, loc := range r.re.FindAllStringSubmatchIndex(text, -1) {
+		if (loc[0] > 0 && isDigit(text[loc[0]-1])) || (loc[1] < len(text) && isDigit(text[loc[1]])) {
+			continue
+		}
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = text[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		if loc[0] > last {
+			spans = append(spans, span{text: text[last:loc[0]]})
+		}
+		spans = append(spans, span{text: m[0], alias: r.read(m), done: true})
+		last = loc[1]
+	}
+	if last < len(text) {
+		spans = append(spans, span{text: text[last:]})
+	}
+	return spans
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// SSML normalizes text for a chinese voice and returns it as ssml: words of the lexicon
+// are read by their phonemes, numbers by their chinese reading but keep the written form,
+// acronyms are spelled and, for multilingual voices, other latin words are read by the
+// english voice.
+func SSML(text string, opts Options) string {
+	var b strings.Builder
+	for _, s := range normalize(text, opts.Lexicon) {
+		escaped := html.EscapeString(s.text)
+		switch {
+		case s.phoneme != "":
+			b.WriteString(`<phoneme alphabet="sapi" ph="` + Sapi(s.phoneme) + `">` + escaped + `</phoneme>`)
+		case s.alias != "":
+			b.WriteString(`<sub alias="` + html.EscapeString(s.alias) + `">` + escaped + `</sub>`)
+		case s.latin && acronymRe.MatchString(s.text) && !latinWords[s.text]:
+			b.WriteString(`<say-as interpret-as="characters">` + escaped + `</say-as>`)
+		case s.latin && opts.Multilingual:
+			b.WriteString(`<lang xml:lang="en-US">` + escaped + `</lang>`)
+		default:
+			b.WriteString(escaped)
+		}
+	}
+	return b.String()
+}
+
+// Text normalizes text for voices that take plain text, numbers are replaced by their
+// chinese reading.
+func Text(text string) string {
+	var b strings.Builder
+	for _, s := range normalize(text, nil) {
+		if s.alias != "" {
+			b.WriteString(s.alias)
+			continue
+		}
+		b.WriteString(s.text)
+	}
+	return b.String()
+}
+
+// Speakable reports whether text has anything to read, text of punctuation and spaces
+// only is not synthesized.
+func Speakable(text string) bool {
+	return strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	}) >= 0
+}
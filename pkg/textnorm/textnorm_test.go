@@ -0,0 +1,79 @@
+package textnorm
+
+import "testing"
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"我有2个苹果", "我有两个苹果"},
+		{"他22岁", "他二十二岁"},
+		{"2024年", "二零二四年"},
+		{"2024-03-01", "二零二四年三月一日"},
+		{"3:30", "三点半"},
+		{"8:05", "八点零五分"},
+		{"打折50%", "打折百分之五十"},
+		{"¥25", "二十五元"},
+		{"-5℃", "零下五度"},
+		{"1/2", "二分之一"},
+		{"3-5天", "三到五天"},
+		{"第2次", "第二次"},
+		{"手机13812345678", "手机幺三八幺二三四五六七八"},
+		{"房间305", "房间三零五"},
+		{"12024年", "一万二千零二十四年"},
+		{"没有数字", "没有数字"},
+	}
+	for _, tt := range tests {
+		if got := Text(tt.text); got != tt.want {
+			t.Errorf("Text(%s) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSSML(t *testing.T) {
+	lexicon := NewLexicon()
+	if err := lexicon.Add("银行", "yin2 hang2"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		text string
+		opts Options
+		want string
+	}{
+		{"plain", "你好", Options{}, "你好"},
+		{"number", "我有2个", Options{}, `我有<sub alias="两个">2个</sub>`},
+		{"acronym", "他是CEO", Options{}, `他是<say-as interpret-as="characters">CEO</say-as>`},
+		{"ok", "OK", Options{}, "OK"},
+		{"latin", "用email", Options{}, "用email"},
+		{"multilingual", "用email", Options{Multilingual: true}, `用<lang xml:lang="en-US">email</lang>`},
+		{"lexicon", "去银行", Options{Lexicon: lexicon}, `去<phoneme alphabet="sapi" ph="yin 2 hang 2">银行</phoneme>`},
+		{"escaped", "a&b", Options{}, "a&amp;b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SSML(tt.text, tt.opts); got != tt.want {
+				t.Errorf("SSML(%s) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeakable(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"你好", true},
+		{"2", true},
+		{"，。！", false},
+		{" ", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Speakable(tt.text); got != tt.want {
+			t.Errorf("Speakable(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}